@@ -9,7 +9,9 @@ import (
 	"github.com/bcbchain/bcbchain/abciapp/softforks"
 	"github.com/bcbchain/bcbchain/common/builderhelper"
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/common/txindex"
 	"github.com/bcbchain/bcbchain/smcrunctl/adapter"
+	"github.com/bcbchain/bcbchain/statedb"
 	"github.com/bcbchain/bcbchain/version"
 	"github.com/bcbchain/bclib/algorithm"
 	"github.com/bcbchain/bclib/jsoniter"
@@ -17,6 +19,7 @@ import (
 	"github.com/bcbchain/sdk/sdk/std"
 	"github.com/bcbchain/bclib/tendermint/go-crypto"
 	"strings"
+	"time"
 
 	appv1 "github.com/bcbchain/bcbchain/abciapp_v1.0/app"
 	"github.com/bcbchain/bclib/tendermint/abci/types"
@@ -45,7 +48,18 @@ type BCChainApplication struct {
 //NewBCChainApplication create an application object
 func NewBCChainApplication(config common.Config, logger log.Loggerf) *BCChainApplication {
 	logger.Info("Init bcchain begin", "version", version.Version)
-	statedbhelper.Init(config.DBName, 100)
+	statedb.SetLogger(logger)
+	statedbhelper.InitWithBackend(config.DBBackend, config.DBName, config.MaxSnapshotCount())
+	if config.ChangeSetOutbox != "" {
+		if err := statedbhelper.OpenChangeSetOutbox(config.ChangeSetOutbox, config.OutboxRetain); err != nil {
+			panic(err)
+		}
+	}
+	if config.TxIndexDB != "" {
+		if err := txindex.Init(config.DBBackend, config.TxIndexDB); err != nil {
+			panic(err)
+		}
+	}
 
 	app := BCChainApplication{
 		connQuery:   &query.QueryConnection{},
@@ -57,17 +71,26 @@ func NewBCChainApplication(config common.Config, logger log.Loggerf) *BCChainApp
 	softforks.Init()
 
 	app.connQuery.SetLogger(logger)
+	app.connQuery.SetQueryRules(config.QueryACL)
 	app.connCheck.SetLogger(logger)
 	app.connDeliver.SetLogger(logger)
 
 	chainID := statedbhelper.GetChainID()
 	app.connCheck.SetChainID(chainID)
+	app.connCheck.SetPolicy(check.Policy{
+		MinGasPrice: config.CheckTxMinGasPrice,
+		MaxTxBytes:  config.CheckTxMaxBytes,
+		RateLimit:   config.CheckTxRateLimit,
+		RateWindow:  time.Duration(config.CheckTxRateWindow) * time.Second,
+	})
 	app.connDeliver.SetChainID(chainID)
+	app.connDeliver.SetParallel(config.ParallelDeliver)
 	crypto.SetChainId(chainID)
 
 	adapterIns := adapter.GetInstance()
 	adapterIns.Init(logger, 32333)
 	adapter.SetSdbCallback(statedbhelper.AdapterGetCallBack, statedbhelper.AdapterSetCallBack, builderhelper.AdapterBuildCallBack)
+	adapter.SetSdbKeysCallback(statedbhelper.AdapterKeysCallBack)
 
 	if checkGenesisChainVersion() == 0 {
 		app.appv1 = appv1.NewBCChainApplication(logger)
@@ -118,7 +141,9 @@ func (app *BCChainApplication) CheckTx(tx []byte) types.ResponseCheckTx {
 	var res types.ResponseCheckTx
 
 	splitTx := strings.Split(string(tx), ".")
-	if len(splitTx) == 5 {
+	if app.isSponsoredTx(splitTx) {
+		res = app.connCheck.CheckTx(tx)
+	} else if len(splitTx) == 5 {
 		if splitTx[1] == "v1" && app.appv1 != nil {
 			var connV2 *check.AppCheck
 			if app.ChainVersion() == 2 {
@@ -149,7 +174,9 @@ func (app *BCChainApplication) DeliverTx(tx []byte) types.ResponseDeliverTx {
 	var res types.ResponseDeliverTx
 
 	splitTx := strings.Split(string(tx), ".")
-	if len(splitTx) == 5 {
+	if app.isSponsoredTx(splitTx) {
+		res, _ = app.connDeliver.DeliverTx(tx)
+	} else if len(splitTx) == 5 {
 		if splitTx[1] == "v1" && app.appv1 != nil {
 			// if chain version never upgrade, give appv2 nil.
 			var connV2 *deliver.AppDeliver
@@ -174,6 +201,40 @@ func (app *BCChainApplication) DeliverTx(tx []byte) types.ResponseDeliverTx {
 	return res
 }
 
+//DeliverTxs delivers consecutive txs of block, v2 and v3 txs among them are delivered in batch
+func (app *BCChainApplication) DeliverTxs(txs [][]byte) []types.ResponseDeliverTx {
+	responses := make([]types.ResponseDeliverTx, 0, len(txs))
+
+	batch := make([][]byte, 0, len(txs))
+	deliverBatch := func() {
+		for i, res := range app.connDeliver.DeliverTxs(batch) {
+			res.TxHash = algorithm.CalcCodeHash(string(batch[i]))
+			responses = append(responses, res)
+		}
+		batch = make([][]byte, 0, len(txs))
+	}
+
+	for _, tx := range txs {
+		splitTx := strings.Split(string(tx), ".")
+		if (len(splitTx) == 5 && (splitTx[1] == "v2" || splitTx[1] == "v3") && app.ChainVersion() == 2) || app.isSponsoredTx(splitTx) {
+			batch = append(batch, tx)
+			continue
+		}
+
+		deliverBatch()
+		responses = append(responses, app.DeliverTx(tx))
+	}
+	deliverBatch()
+
+	return responses
+}
+
+// isSponsoredTx returns whether tx is a v2 or v3 tx with sponsorship as the 6th part
+func (app *BCChainApplication) isSponsoredTx(splitTx []string) bool {
+	return len(splitTx) == 6 && (splitTx[1] == "v2" || splitTx[1] == "v3") && app.ChainVersion() == 2 &&
+		softforks.IsActive(softforks.Sponsorship, statedbhelper.GetWorldAppState(0, 0).BlockHeight+1)
+}
+
 //Flush flush interface
 func (app *BCChainApplication) Flush(req types.RequestFlush) types.ResponseFlush {
 
@@ -190,6 +251,7 @@ func (app *BCChainApplication) Commit() types.ResponseCommit {
 		res = app.appv1.Commit()
 	} else if app.ChainVersion() == 2 {
 		res = app.connDeliver.Commit()
+		app.connCheck.Commit(statedbhelper.GetWorldAppState(0, 0).BlockHeight)
 	} else {
 		panic("invalid chain version in state")
 	}
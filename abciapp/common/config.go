@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/statedb"
 	"github.com/spf13/viper"
 )
 
@@ -13,20 +15,33 @@ var TmCoreURL string
 
 //Config 具体含义请参考 bcchain.yaml
 type Config struct {
-	Address          string `yaml:"address"`        //default "tcp://127.0.0.1:46658"
-	QueryDBAddress   string `yaml:"queryDBAddress"` //default "0.0.0.0:46666"
-	ABCI             string `yaml:"abci"`           //default "socket"
-	LogLevel         string `yaml:"logLevel"`       //default "debug"
-	LogScreen        bool   `yaml:"logScreen"`
-	LogFile          bool   `yaml:"logFile"`
-	LogAsync         bool   `yaml:"logAsync"`
-	LogSize          int    `yaml:"logFileSize"`
-	DBName           string `yaml:"dbName"`
-	DBIP             string `yaml:"dbIP"`
-	DBPort           string `yaml:"dbPort"`
-	ChainID          string `yaml:"chainID"`
-	ContainerTimeout int64  `yaml:"containerTimeout"`
-	Path             string
+	Address            string `yaml:"address"`        //default "tcp://127.0.0.1:46658"
+	QueryDBAddress     string `yaml:"queryDBAddress"` //default "0.0.0.0:46666"
+	AdminAddress       string `yaml:"adminAddress"`   //default "127.0.0.1:46659"
+	ABCI               string `yaml:"abci"`           //default "socket"
+	LogLevel           string `yaml:"logLevel"`       //default "debug"
+	LogScreen          bool   `yaml:"logScreen"`
+	LogFile            bool   `yaml:"logFile"`
+	LogAsync           bool   `yaml:"logAsync"`
+	LogSize            int    `yaml:"logFileSize"`
+	DBName             string `yaml:"dbName"`
+	DBBackend          string `yaml:"dbBackend"` //default "goleveldb"
+	DBIP               string `yaml:"dbIP"`
+	DBPort             string `yaml:"dbPort"`
+	ArchiveMode        bool   `yaml:"archiveMode"`        //keep snapshots of all blocks for historical query
+	ChangeSetOutbox    string `yaml:"changeSetOutbox"`    //file of committed change sets for indexers, default "" is disabled
+	OutboxRetain       int    `yaml:"outboxRetain"`       //change sets of the last blocks kept in outbox at least, default 0 keeps all
+	ParallelDeliver    bool   `yaml:"parallelDeliver"`    //invoke txs of block in parallel, default false invokes them one by one
+	TxIndexDB          string `yaml:"txIndexDB"`          //db of tx index by hash, sender, contract and receipt name, default "" is disabled
+	CheckTxMaxBytes    int    `yaml:"checkTxMaxBytes"`    //max size of tx accepted by CheckTx, default 0 is unlimited
+	CheckTxMinGasPrice int64  `yaml:"checkTxMinGasPrice"` //min fee per gas of tx accepted by CheckTx, default 0 is unlimited
+	CheckTxRateLimit   int    `yaml:"checkTxRateLimit"`   //max count of new txs of a sender in CheckTxRateWindow, default 0 is unlimited
+	CheckTxRateWindow  int64  `yaml:"checkTxRateWindow"`  //seconds of window of CheckTxRateLimit, default 60
+	ChainID            string `yaml:"chainID"`
+	ContainerTimeout   int64  `yaml:"containerTimeout"`
+	Path               string
+
+	QueryACL []statedbhelper.QueryRule `yaml:"queryACL"` //access of keys by prefix, rules set by governance take precedence
 }
 
 //GetConfig read config to struct
@@ -73,14 +88,28 @@ func (c *Config) GetConfig() error {
 	if len(c.QueryDBAddress) == 0 {
 		c.Address = "0.0.0.0:46666"
 	}
+	if len(c.AdminAddress) == 0 {
+		c.AdminAddress = "127.0.0.1:46659"
+	}
 	if len(c.ABCI) == 0 || c.ABCI == "" {
 		c.ABCI = "socket"
 	}
 	if len(c.DBName) == 0 || c.DBName == "" {
 		c.DBName = ".appstate"
 	}
+	if c.DBBackend == "" {
+		c.DBBackend = "goleveldb"
+	}
 	if c.ChainID == "" {
 		c.ChainID = "local"
 	}
 	return nil
 }
+
+//MaxSnapshotCount returns count of snapshots kept by state db, all of them are kept in archive mode
+func (c *Config) MaxSnapshotCount() int {
+	if c.ArchiveMode {
+		return statedb.KeepAllSnapshots
+	}
+	return 100
+}
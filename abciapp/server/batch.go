@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bufio"
+
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+)
+
+// BatchApplication delivers consecutive txs in batch, responses are in the order of txs.
+type BatchApplication interface {
+	types.Application
+	DeliverTxs(txs [][]byte) []types.ResponseDeliverTx
+}
+
+// requestBatch collects DeliverTx requests pipelined by tendermint on a connection and
+// delivers them in batch if app is a BatchApplication. It's the only change of SocketServer
+// to the socket server of bclib.
+type requestBatch struct {
+	app       BatchApplication // nil if app can't deliver txs in batch
+	reader    *bufio.Reader
+	responses chan<- *types.Response
+	pending   []*types.Request // DeliverTx and Flush requests waiting for batch
+}
+
+func newRequestBatch(app types.Application, reader *bufio.Reader, responses chan<- *types.Response) *requestBatch {
+	batchApp, _ := app.(BatchApplication)
+	return &requestBatch{app: batchApp, reader: reader, responses: responses}
+}
+
+// add returns true if req is taken by batch, otherwise pending requests have been responded
+// and req must be handled as usual.
+func (b *requestBatch) add(req *types.Request) bool {
+	if b.app == nil {
+		return false
+	}
+
+	switch req.Value.(type) {
+	case *types.Request_DeliverTx:
+		b.pending = append(b.pending, req)
+		return true
+	case *types.Request_Flush:
+		if len(b.pending) != 0 {
+			// 后续请求已经到达时继续收集，否则客户端可能正在等待 Flush 的应答
+			b.pending = append(b.pending, req)
+			if b.reader.Buffered() == 0 {
+				b.deliver()
+			}
+			return true
+		}
+	default:
+		if len(b.pending) != 0 {
+			b.deliver()
+		}
+	}
+	return false
+}
+
+// deliver delivers txs of pending DeliverTx requests in batch, then responds requests in order.
+func (b *requestBatch) deliver() {
+	txs := make([][]byte, 0, len(b.pending))
+	for _, req := range b.pending {
+		if r, ok := req.Value.(*types.Request_DeliverTx); ok {
+			txs = append(txs, r.DeliverTx.Tx)
+		}
+	}
+
+	results := b.app.DeliverTxs(txs)
+	for _, req := range b.pending {
+		if _, ok := req.Value.(*types.Request_DeliverTx); ok {
+			b.responses <- types.ToResponseDeliverTx(results[0])
+			results = results[1:]
+		} else {
+			b.responses <- types.ToResponseFlush()
+		}
+	}
+	b.pending = nil
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/bcbchain/bclib/tendermint/abci/server"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	cmn "github.com/bcbchain/bclib/tendermint/tmlibs/common"
+)
+
+//NewServer creates ABCI server, socket server of bcchain replaces socket server of bclib
+func NewServer(protoAddr, transport string, app types.Application) (cmn.Service, error) {
+	if transport == "socket" {
+		return NewSocketServer(protoAddr, app), nil
+	}
+
+	return server.NewServer(protoAddr, transport, app)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+)
+
+var update = flag.Bool("update", false, "regenerate socket_server.go from socket server of bclib")
+
+// socketServerHooks are the only edits of socket server of bclib, each anchor must be found once
+var socketServerHooks = []struct {
+	anchor, replacement string
+}{
+	{
+		"\tvar bufReader = bufio.NewReader(conn)\n",
+		"\tvar bufReader = bufio.NewReader(conn)\n" +
+			"\tvar batch = newRequestBatch(s.app, bufReader, responses)\n",
+	},
+	{
+		"\t\tdataChan <- true\n\t\ts.handleRequest(conn, req, responses)\n",
+		"\t\tdataChan <- true\n\t\tif batch.add(req) {\n\t\t\tcontinue\n\t\t}\n\t\ts.handleRequest(conn, req, responses)\n",
+	},
+}
+
+// socket_server.go 由 bclib 的 socket server 加上 socketServerHooks 生成，bclib 升级后
+// 此测试失败，使用 go test -run TestSocketServerGenerated -update 重新生成
+func TestSocketServerGenerated(t *testing.T) {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Path}}@{{.Version}} {{.Dir}}", "github.com/bcbchain/bclib").Output()
+	if err != nil {
+		t.Fatalf("locate bclib: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	src, err := ioutil.ReadFile(filepath.Join(fields[1], "tendermint", "abci", "server", "socket_server.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte(fmt.Sprintf("// Code generated from tendermint/abci/server/socket_server.go of %s "+
+		"by TestSocketServerGenerated. DO NOT EDIT.\n\n", fields[0]))
+	for _, hook := range socketServerHooks {
+		if n := bytes.Count(src, []byte(hook.anchor)); n != 1 {
+			t.Fatalf("anchor %q is found %d times in socket server of bclib", hook.anchor, n)
+		}
+		src = bytes.Replace(src, []byte(hook.anchor), []byte(hook.replacement), 1)
+	}
+	want = append(want, src...)
+
+	if *update {
+		if err := ioutil.WriteFile("socket_server.go", want, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	got, err := ioutil.ReadFile("socket_server.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("socket_server.go is out of date with bclib, regenerate it with -update")
+	}
+}
+
+type batchApp struct {
+	*types.BaseApplication
+	batches [][][]byte
+}
+
+func (app *batchApp) DeliverTxs(txs [][]byte) []types.ResponseDeliverTx {
+	app.batches = append(app.batches, txs)
+	results := make([]types.ResponseDeliverTx, len(txs))
+	for i, tx := range txs {
+		results[i].Log = string(tx)
+	}
+	return results
+}
+
+func TestRequestBatch(t *testing.T) {
+	app := &batchApp{BaseApplication: types.NewBaseApplication()}
+	responses := make(chan *types.Response, 10)
+	batch := newRequestBatch(app, bufio.NewReader(bytes.NewReader(nil)), responses)
+
+	// DeliverTx 请求在 Flush 时一起执行，应答按请求顺序返回
+	for _, tx := range []string{"a", "b"} {
+		if !batch.add(types.ToRequestDeliverTx([]byte(tx))) {
+			t.Fatal("DeliverTx isn't taken by batch")
+		}
+	}
+	if !batch.add(types.ToRequestFlush()) || len(app.batches) != 1 || len(app.batches[0]) != 2 {
+		t.Fatalf("batches: %v", app.batches)
+	}
+	for _, want := range []string{"a", "b"} {
+		if res := <-responses; res.GetDeliverTx().Log != want {
+			t.Errorf("response: %v, want %s", res, want)
+		}
+	}
+	if res := <-responses; res.GetFlush() == nil {
+		t.Errorf("response: %v, want flush", res)
+	}
+
+	// 其它请求先返回已收集的 DeliverTx 的应答，再按原样处理
+	batch.add(types.ToRequestDeliverTx([]byte("c")))
+	if batch.add(types.ToRequestEndBlock(types.RequestEndBlock{})) || len(app.batches) != 2 || len(responses) != 1 {
+		t.Errorf("batches: %v, responses: %d", app.batches, len(responses))
+	}
+
+	// 不支持批量执行的应用不收集请求
+	if newRequestBatch(types.NewBaseApplication(), nil, responses).add(types.ToRequestDeliverTx([]byte("d"))) {
+		t.Error("DeliverTx is taken by batch of app which can't deliver txs in batch")
+	}
+}
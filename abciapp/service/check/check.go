@@ -1,6 +1,8 @@
 package check
 
 import (
+	"sync"
+
 	types2 "github.com/bcbchain/bclib/types"
 	"github.com/bcbchain/bclib/tendermint/abci/types"
 	"github.com/bcbchain/bclib/tendermint/go-crypto"
@@ -12,6 +14,10 @@ import (
 type AppCheck struct {
 	logger  log.Logger
 	chainID string
+
+	pendingMtx sync.Mutex
+	pending    *pendingState // 已通过检查、等待打包的交易
+	admission  *admission    // 交易准入策略，与 pending 共用锁
 }
 
 //SetLogger set logger
@@ -24,6 +30,14 @@ func (app *AppCheck) SetChainID(chainID string) {
 	app.chainID = chainID
 }
 
+//SetPolicy set admission policy of CheckTx
+func (app *AppCheck) SetPolicy(policy Policy) {
+	app.pendingMtx.Lock()
+	defer app.pendingMtx.Unlock()
+
+	app.admission = newAdmission(policy)
+}
+
 //CheckTx check tx
 func (app *AppCheck) CheckTx(tx []byte) types.ResponseCheckTx {
 	app.logger.Info("Recv ABCI interface: CheckTx", "tx", string(tx))
@@ -31,11 +45,43 @@ func (app *AppCheck) CheckTx(tx []byte) types.ResponseCheckTx {
 	return app.CheckBCTx(tx)
 }
 
+//Commit drops pending txs which are committed in block or expired, mempool checks the
+// remaining txs again after commit
+func (app *AppCheck) Commit(height int64) {
+	app.pendingMtx.Lock()
+	defer app.pendingMtx.Unlock()
+
+	if app.pending != nil {
+		app.pending.prune(height)
+	}
+	if app.admission != nil {
+		app.admission.prune()
+	}
+}
+
+// checkTxSize checks size of tx by admission policy before it's parsed.
+func (app *AppCheck) checkTxSize(tx []byte) (types.ResponseCheckTx, bool) {
+	app.pendingMtx.Lock()
+	defer app.pendingMtx.Unlock()
+
+	if app.admission == nil {
+		return types.ResponseCheckTx{}, true
+	}
+	if code, log := app.admission.checkSize(tx); code != types2.CodeOK {
+		app.logger.Debug("CheckTx rejected", "code", code, "error", log)
+		return types.ResponseCheckTx{Code: code, Log: log}, false
+	}
+	return types.ResponseCheckTx{}, true
+}
+
 // ------------- add for support v1 transaction begin ----------------
 
 //RunCheckTx - invoked by v1 checkTx, if it's standard transfer method.
 func (app *AppCheck) RunCheckTx(tx []byte, transaction types2.Transaction, pubKey crypto.PubKeyEd25519) types.ResponseCheckTx {
 	app.logger.Debug("Recv ABCI interface: CheckTx", "transaction", transaction)
+	if res, ok := app.checkTxSize(tx); !ok {
+		return res
+	}
 
 	return app.runCheckBCTx(tx, transaction, pubKey)
 }
@@ -1,6 +1,7 @@
 package check
 
 import (
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
 	"github.com/bcbchain/bcbchain/smcrunctl/adapter"
 	"github.com/bcbchain/bclib/algorithm"
@@ -10,6 +11,7 @@ import (
 	tx2 "github.com/bcbchain/bclib/tx/v2"
 	tx3 "github.com/bcbchain/bclib/tx/v3"
 	types2 "github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/std"
 )
 
 // CheckBCTx check tx data
@@ -19,13 +21,25 @@ func (app *AppCheck) CheckBCTx(tx []byte) types.ResponseCheckTx {
 		app.SetChainID(statedbhelper.GetChainID())
 	}
 
+	if res, ok := app.checkTxSize(tx); !ok {
+		return res
+	}
+
+	txStr, _, err := splitSponsoredTx(tx)
+	if err != nil {
+		app.logger.Error("tx parse failed:", "error", err)
+		return types.ResponseCheckTx{
+			Code: types2.ErrCheckTx,
+			Log:  err.Error()}
+	}
+
 	// for base58
 	tx2.Init(app.chainID)
-	transaction, pubKey, err := tx2.TxParse(string(tx))
+	transaction, pubKey, err := tx2.TxParse(txStr)
 	if err != nil {
 		// for base64
 		tx3.Init(app.chainID)
-		transaction, pubKey, err = tx3.TxParse(string(tx))
+		transaction, pubKey, err = tx3.TxParse(txStr)
 		if err != nil {
 			app.logger.Error("tx parse failed:", "error", err)
 			return types.ResponseCheckTx{
@@ -45,24 +59,64 @@ func (app *AppCheck) runCheckBCTx(tx []byte, transaction types2.Transaction, pub
 			Log:  "Invalid transaction note"}
 	}
 
+	app.pendingMtx.Lock()
+	defer app.pendingMtx.Unlock()
+	if app.pending == nil {
+		app.pending = newPendingState()
+	}
+	if app.admission == nil {
+		app.admission = newAdmission(Policy{})
+	}
+
+	sender := pubKey.Address(statedbhelper.GetChainID())
+	txHash := common.HexBytes(algorithm.CalcCodeHash(string(tx)))
+
 	transID, _ := statedbhelper.NewRollbackTransactionID()
 	txID := int64(1)
+	statedbhelper.BeginBlock(transID)
+	defer statedbhelper.RollbackBlock(transID)
+
+	// 在已提交状态上叠加该账户之前待打包交易的 nonce 和手续费
+	index := app.pending.apply(transID, txID, sender, txHash.String())
+
+	// 新交易计入发送者的频率限制，重新检查的待打包交易不计入
+	if index < 0 {
+		if code, log := app.admission.checkRate(sender); code != types2.CodeOK {
+			app.logger.Debug("CheckTx rejected", "code", code, "error", log)
+			return types.ResponseCheckTx{
+				Code: code,
+				Log:  log}
+		}
+	}
+
 	// Check Nonce
-	err := statedbhelper.CheckAccountNonce(transID, txID, pubKey.Address(statedbhelper.GetChainID()), transaction.Nonce)
+	err := statedbhelper.CheckAccountNonce(transID, txID, sender, transaction.Nonce)
 	if err != nil {
 		app.logger.Debug("check nonce error:", "err", err)
+		app.pending.drop(sender, index)
 		return types.ResponseCheckTx{
 			Code: types2.ErrCheckTx,
 			Log:  "Invalid nonce"}
 	}
 
-	statedbhelper.BeginBlock(transID)
-	defer statedbhelper.RollbackBlock(transID)
-
 	adp := adapter.GetInstance()
 	defer adp.Rollback(transID)
 	appStat := statedbhelper.GetWorldAppState(0, 0)
 
+	var sponsor types2.Address
+	if sp, err := sponsorshipOf(tx, transaction.Note); err != nil || sp != nil {
+		if err == nil {
+			sponsor, err = statedbhelper.CheckSponsorship(transID, txID, sp, sender, transaction, appStat.BlockHeight+1)
+		}
+		if err != nil {
+			app.logger.Debug("check sponsorship error:", "err", err)
+			app.pending.drop(sender, index)
+			return types.ResponseCheckTx{
+				Code: types2.ErrCheckTx,
+				Log:  err.Error()}
+		}
+	}
+
 	blockHeader := types.Header{}
 	if appStat.BlockHeight == 0 {
 		blockHeader.ChainID = app.chainID
@@ -73,8 +127,11 @@ func (app *AppCheck) runCheckBCTx(tx []byte, transaction types2.Transaction, pub
 	}
 	app.logger.Debug("CheckTx", "block height", blockHeader.Height)
 
-	txHash := common.HexBytes(algorithm.CalcCodeHash(string(tx)))
-	result := adp.InvokeTx(blockHeader, transID, txID, pubKey.Address(statedbhelper.GetChainID()), transaction, pubKey.Bytes(), txHash, appStat.BeginBlock.Hash)
+	if height, ok := statedbhelper.ScheduleHeightOf(transaction.Note); ok && softforks.IsActive(softforks.ScheduledCall, blockHeader.Height) {
+		return app.checkScheduledCall(transID, txID, tx, transaction, sender, height, blockHeader.Height, index)
+	}
+
+	result := adp.InvokeSponsoredTx(blockHeader, transID, txID, sender, sponsor, transaction, pubKey.Bytes(), txHash, appStat.BeginBlock.Hash)
 	if result.Code == types2.CodeBVMQueryOK {
 		return types.ResponseCheckTx{
 			Code: types2.CodeBVMQueryOK,
@@ -83,12 +140,80 @@ func (app *AppCheck) runCheckBCTx(tx []byte, transaction types2.Transaction, pub
 
 	} else if result.Code != types2.CodeOK {
 		app.logger.Error("CheckTx failed", "code", result.Code, "error", result.Log)
+		app.pending.drop(sender, index)
 		return types.ResponseCheckTx{
 			Code: result.Code,
 			Log:  result.Log}
 	}
 
+	if code, log := app.admission.checkGasPrice(result.GasUsed, result.Fee); code != types2.CodeOK {
+		app.logger.Debug("CheckTx rejected", "code", code, "error", log)
+		app.pending.drop(sender, index)
+		return types.ResponseCheckTx{
+			Code: code,
+			Log:  log}
+	}
+
+	app.pending.add(sender, index, &pendingTx{
+		hash:   txHash.String(),
+		nonce:  transaction.Nonce,
+		fees:   feesOf(result.Tags),
+		height: appStat.BlockHeight,
+	})
+
 	return types.ResponseCheckTx{
-		Code: types2.CodeOK,
-		Log:  "CheckTx success"}
+		Code:     types2.CodeOK,
+		Log:      "CheckTx success",
+		Info:     priorityHint(result.GasUsed, result.Fee),
+		GasLimit: uint64(transaction.GasLimit),
+		GasUsed:  uint64(result.GasUsed),
+		Fee:      uint64(result.Fee)}
+}
+
+// checkScheduledCall checks whether tx can be scheduled instead of invoking it, prepaid fee of
+// it is pending as fee.
+func (app *AppCheck) checkScheduledCall(transID, txID int64, tx []byte, transaction types2.Transaction,
+	sender types2.Address, height, blockHeight int64, index int) types.ResponseCheckTx {
+
+	call := statedbhelper.NewScheduledCall(string(tx), sender, height)
+	if err := statedbhelper.ScheduleCall(transID, txID, call, transaction.GasLimit, blockHeight); err != nil {
+		app.logger.Debug("CheckTx schedule call failed", "error", err)
+		app.pending.drop(sender, index)
+		return types.ResponseCheckTx{
+			Code: types2.ErrCheckTx,
+			Log:  err.Error()}
+	}
+
+	app.pending.add(sender, index, &pendingTx{
+		hash:   call.TxHash,
+		nonce:  transaction.Nonce,
+		fees:   []std.Fee{{From: sender, Token: call.Token, Value: call.Prepaid.Value().Int64()}},
+		height: blockHeight - 1,
+	})
+
+	return types.ResponseCheckTx{
+		Code:     types2.CodeOK,
+		Log:      "CheckTx success",
+		GasLimit: uint64(transaction.GasLimit)}
+}
+
+// splitSponsoredTx splits sponsorship from tx if sponsored tx is enabled at next block.
+func splitSponsoredTx(tx []byte) (string, *statedbhelper.Sponsorship, error) {
+	if !softforks.IsActive(softforks.Sponsorship, statedbhelper.GetWorldAppState(0, 0).BlockHeight + 1) {
+		return string(tx), nil, nil
+	}
+	return statedbhelper.SplitSponsoredTx(string(tx))
+}
+
+// sponsorshipOf returns sponsorship of tx after checking it's bound by note signed by sender,
+// it's nil if tx isn't sponsored.
+func sponsorshipOf(tx []byte, note string) (*statedbhelper.Sponsorship, error) {
+	if !softforks.IsActive(softforks.Sponsorship, statedbhelper.GetWorldAppState(0, 0).BlockHeight + 1) {
+		return nil, nil
+	}
+	_, sp, err := statedbhelper.SplitSponsoredTx(string(tx))
+	if err != nil {
+		return nil, err
+	}
+	return sp, statedbhelper.VerifySponsorNote(note, sp)
 }
@@ -0,0 +1,175 @@
+package check
+
+import (
+	"strings"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	types2 "github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// pendingExpiredBlocks is count of blocks after which a pending tx which isn't checked again
+// is dropped, because mempool may drop tx without telling app.
+const pendingExpiredBlocks = 100
+
+// pendingTx is a tx which passed CheckTx and waits in mempool.
+type pendingTx struct {
+	hash   string
+	nonce  uint64
+	fees   []std.Fee
+	height int64 // block height when tx is checked last time
+}
+
+type feeKey struct {
+	from, token types2.Address
+}
+
+// pendingState holds nonces and fees of pending txs, CheckTx checks a tx over txs which
+// are pending before it, so one account can queue several txs in mempool.
+type pendingState struct {
+	accounts map[types2.Address][]*pendingTx // sender => pending txs in order of nonce
+	fees     map[feeKey]int64                // fees of all pending txs
+}
+
+func newPendingState() *pendingState {
+	return &pendingState{
+		accounts: make(map[types2.Address][]*pendingTx),
+		fees:     make(map[feeKey]int64),
+	}
+}
+
+// apply sets nonce and fee balances left by pending txs of sender before tx into tx of
+// transaction, it returns index of tx in pending txs of sender, -1 if tx isn't pending.
+func (p *pendingState) apply(transID, txID int64, sender types2.Address, hash string) int {
+	txs := p.accounts[sender]
+	index := -1
+	for i, ptx := range txs {
+		if ptx.hash == hash {
+			index = i
+			break
+		}
+	}
+
+	before, after := txs, []*pendingTx(nil)
+	if index >= 0 {
+		before, after = txs[:index], txs[index:]
+	}
+	if len(before) > 0 {
+		statedbhelper.SetPendingNonce(transID, txID, sender, before[len(before)-1].nonce)
+	}
+
+	fees := make(map[feeKey]int64)
+	for k, v := range p.fees {
+		if k.from == sender {
+			fees[k] = v
+		}
+	}
+	for _, ptx := range after {
+		for _, fee := range ptx.fees {
+			fees[feeKey{from: fee.From, token: fee.Token}] -= fee.Value
+		}
+	}
+	for k, v := range fees {
+		if v <= 0 {
+			continue
+		}
+
+		balance := statedbhelper.BalanceOf(transID, txID, k.from, k.token).SubI(v)
+		if balance.IsNegative() {
+			balance = bn.N(0)
+		}
+		statedbhelper.SetBalance(transID, txID, k.from, k.token, balance)
+	}
+
+	return index
+}
+
+// add appends new pending tx of sender, or refreshes height of tx checked again.
+func (p *pendingState) add(sender types2.Address, index int, ptx *pendingTx) {
+	if index >= 0 {
+		p.accounts[sender][index].height = ptx.height
+		return
+	}
+
+	p.accounts[sender] = append(p.accounts[sender], ptx)
+	for _, fee := range ptx.fees {
+		p.fees[feeKey{from: fee.From, token: fee.Token}] += fee.Value
+	}
+}
+
+// drop removes pending txs of sender from index, the txs after it can't pass without it.
+func (p *pendingState) drop(sender types2.Address, index int) {
+	txs := p.accounts[sender]
+	if index < 0 || index >= len(txs) {
+		return
+	}
+
+	for _, ptx := range txs[index:] {
+		for _, fee := range ptx.fees {
+			k := feeKey{from: fee.From, token: fee.Token}
+			if p.fees[k] -= fee.Value; p.fees[k] <= 0 {
+				delete(p.fees, k)
+			}
+		}
+	}
+
+	if index == 0 {
+		delete(p.accounts, sender)
+	} else {
+		p.accounts[sender] = txs[:index]
+	}
+}
+
+// prune drops pending txs committed in block and pending txs expired, a pending tx can't
+// pass without the expired tx before it.
+func (p *pendingState) prune(height int64) {
+	senders := make([]types2.Address, 0, len(p.accounts))
+	for sender := range p.accounts {
+		senders = append(senders, sender)
+	}
+
+	for _, sender := range senders {
+		nonce := statedbhelper.GetAccountNonce(0, 0, sender)
+
+		keep := make([]*pendingTx, 0)
+		for _, ptx := range p.accounts[sender] {
+			if ptx.nonce <= nonce {
+				continue
+			}
+			if height-ptx.height > pendingExpiredBlocks {
+				break
+			}
+			keep = append(keep, ptx)
+		}
+
+		p.drop(sender, 0)
+		for _, ptx := range keep {
+			p.add(sender, -1, ptx)
+		}
+	}
+}
+
+// feesOf gets fees from fee receipts in tags.
+func feesOf(tags []common.KVPair) []std.Fee {
+	fees := make([]std.Fee, 0)
+	for _, t := range tags {
+		if !strings.Contains(string(t.Key), "std::fee") {
+			continue
+		}
+
+		var receipt std.Receipt
+		if err := jsoniter.Unmarshal(t.Value, &receipt); err != nil {
+			continue
+		}
+		var fee std.Fee
+		if err := jsoniter.Unmarshal(receipt.Bytes, &fee); err != nil {
+			continue
+		}
+		fees = append(fees, fee)
+	}
+
+	return fees
+}
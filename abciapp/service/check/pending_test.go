@@ -0,0 +1,83 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/statedb"
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+const (
+	testSender = "bcbSender"
+	testToken  = "bcbToken"
+)
+
+func TestPendingState(t *testing.T) {
+	statedbhelper.InitWithBackend(statedb.MemDBBackend, filepath.Join(os.TempDir(), "testpending"), 10)
+	defer statedbhelper.Close()
+
+	// 已提交状态：nonce 为 1，余额 1000
+	transID, _ := statedbhelper.NewCommittableTransactionID()
+	txID := statedbhelper.NewTx(transID)
+	if _, err := statedbhelper.SetAccountNonce(transID, txID, testSender, 1); err != nil {
+		t.Fatal(err)
+	}
+	statedbhelper.SetBalance(transID, txID, testSender, testToken, bn.N(1000))
+	statedbhelper.CommitTx(transID, txID)
+	statedbhelper.CommitBlock(transID)
+
+	p := newPendingState()
+	p.add(testSender, -1, &pendingTx{hash: "A", nonce: 2, fees: testFees(100), height: 1})
+	p.add(testSender, -1, &pendingTx{hash: "B", nonce: 3, fees: testFees(200), height: 1})
+
+	// 新交易叠加所有待打包交易
+	nonce, balance, index := testApply(p, "C")
+	if nonce != 3 || balance != 700 || index != -1 {
+		t.Errorf("apply new tx: nonce=%d balance=%d index=%d", nonce, balance, index)
+	}
+
+	// 重新检查的交易只叠加它之前的交易
+	nonce, balance, index = testApply(p, "B")
+	if nonce != 2 || balance != 900 || index != 1 {
+		t.Errorf("apply pending tx: nonce=%d balance=%d index=%d", nonce, balance, index)
+	}
+
+	// 提交 nonce 为 2 的交易后只保留 B
+	transID, _ = statedbhelper.NewCommittableTransactionID()
+	txID = statedbhelper.NewTx(transID)
+	if _, err := statedbhelper.SetAccountNonce(transID, txID, testSender, 2); err != nil {
+		t.Fatal(err)
+	}
+	statedbhelper.CommitTx(transID, txID)
+	statedbhelper.CommitBlock(transID)
+
+	p.prune(2)
+	if len(p.accounts[testSender]) != 1 || p.accounts[testSender][0].hash != "B" || p.fees[feeKey{testSender, testToken}] != 200 {
+		t.Errorf("prune committed: %v %v", p.accounts, p.fees)
+	}
+
+	// 过期后全部丢弃
+	p.prune(2 + pendingExpiredBlocks)
+	if len(p.accounts) != 0 || len(p.fees) != 0 {
+		t.Errorf("prune expired: %v %v", p.accounts, p.fees)
+	}
+}
+
+func testFees(value int64) []std.Fee {
+	return []std.Fee{{Token: testToken, From: testSender, Value: value}}
+}
+
+func testApply(p *pendingState, hash string) (nonce uint64, balance int64, index int) {
+	transID, _ := statedbhelper.NewRollbackTransactionID()
+	defer statedbhelper.RollbackBlock(transID)
+	txID := statedbhelper.NewTx(transID)
+
+	index = p.apply(transID, txID, testSender, hash)
+	nonce = statedbhelper.GetAccountNonce(transID, txID, testSender)
+	balance = statedbhelper.BalanceOf(transID, txID, testSender, testToken).V.Int64()
+	return
+}
@@ -0,0 +1,120 @@
+package check
+
+import (
+	"fmt"
+	"time"
+
+	types2 "github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+// error codes of txs rejected by admission policy
+const (
+	ErrTxTooLarge = types2.ErrCheckTx + 10 + iota
+	ErrRateLimited
+	ErrGasPriceTooLow
+)
+
+//Policy is admission policy of CheckTx, a field of zero value disables its check
+type Policy struct {
+	MinGasPrice int64         // min fee per gas offered by tx, unit is cong
+	MaxTxBytes  int           // max size of tx
+	RateLimit   int           // max count of new txs of a sender in RateWindow, rechecked txs aren't counted
+	RateWindow  time.Duration // default is a minute if RateLimit is set
+}
+
+//PriorityHint is returned in Info of ResponseCheckTx of accepted tx, the higher priority is
+//the more fee tx offers.
+type PriorityHint struct {
+	Priority int64 `json:"priority"`
+	GasPrice int64 `json:"gasPrice"` // fee per gas offered by tx
+}
+
+type rateCounter struct {
+	start time.Time
+	count int
+}
+
+// admission applies policy, it's used with pendingMtx of AppCheck locked.
+type admission struct {
+	policy   Policy
+	counters map[types2.Address]*rateCounter
+	now      func() time.Time
+}
+
+func newAdmission(policy Policy) *admission {
+	if policy.RateLimit > 0 && policy.RateWindow <= 0 {
+		policy.RateWindow = time.Minute
+	}
+
+	return &admission{
+		policy:   policy,
+		counters: make(map[types2.Address]*rateCounter),
+		now:      time.Now,
+	}
+}
+
+// checkSize checks size of tx before it's parsed.
+func (a *admission) checkSize(tx []byte) (uint32, string) {
+	if a.policy.MaxTxBytes > 0 && len(tx) > a.policy.MaxTxBytes {
+		return ErrTxTooLarge, fmt.Sprintf("tx size %d exceeds limit %d", len(tx), a.policy.MaxTxBytes)
+	}
+	return types2.CodeOK, ""
+}
+
+// checkRate counts a new tx of sender in current window of it.
+func (a *admission) checkRate(sender types2.Address) (uint32, string) {
+	if a.policy.RateLimit <= 0 {
+		return types2.CodeOK, ""
+	}
+
+	now := a.now()
+	c, ok := a.counters[sender]
+	if !ok || now.Sub(c.start) >= a.policy.RateWindow {
+		c = &rateCounter{start: now}
+		a.counters[sender] = c
+	}
+	if c.count >= a.policy.RateLimit {
+		return ErrRateLimited, fmt.Sprintf("sender exceeds %d txs in %s", a.policy.RateLimit, a.policy.RateWindow)
+	}
+	c.count++
+	return types2.CodeOK, ""
+}
+
+// checkGasPrice checks fee per gas of invoked tx.
+func (a *admission) checkGasPrice(gasUsed, fee int64) (uint32, string) {
+	if a.policy.MinGasPrice <= 0 || gasUsed <= 0 {
+		return types2.CodeOK, ""
+	}
+
+	if gasPriceOf(gasUsed, fee) < a.policy.MinGasPrice {
+		return ErrGasPriceTooLow, fmt.Sprintf("gas price %d is lower than %d", gasPriceOf(gasUsed, fee), a.policy.MinGasPrice)
+	}
+	return types2.CodeOK, ""
+}
+
+// prune drops counters of windows which are over.
+func (a *admission) prune() {
+	now := a.now()
+	for sender, c := range a.counters {
+		if now.Sub(c.start) >= a.policy.RateWindow {
+			delete(a.counters, sender)
+		}
+	}
+}
+
+func gasPriceOf(gasUsed, fee int64) int64 {
+	if gasUsed <= 0 {
+		return 0
+	}
+	return fee / gasUsed
+}
+
+// priorityHint returns Info of accepted tx.
+func priorityHint(gasUsed, fee int64) string {
+	hint, err := jsoniter.Marshal(PriorityHint{Priority: fee, GasPrice: gasPriceOf(gasUsed, fee)})
+	if err != nil {
+		panic(err)
+	}
+	return string(hint)
+}
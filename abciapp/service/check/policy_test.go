@@ -0,0 +1,53 @@
+package check
+
+import (
+	"testing"
+	"time"
+
+	types2 "github.com/bcbchain/bclib/types"
+)
+
+func TestAdmission(t *testing.T) {
+	a := newAdmission(Policy{MinGasPrice: 100, MaxTxBytes: 10, RateLimit: 2, RateWindow: time.Second})
+	now := time.Unix(1000, 0)
+	a.now = func() time.Time { return now }
+
+	if code, _ := a.checkSize(make([]byte, 10)); code != types2.CodeOK {
+		t.Errorf("size 10: %d", code)
+	}
+	if code, _ := a.checkSize(make([]byte, 11)); code != ErrTxTooLarge {
+		t.Errorf("size 11: %d", code)
+	}
+
+	// 时间窗口内超过 2 笔被拒绝，下一个窗口重新计数
+	for i := 0; i < 2; i++ {
+		if code, _ := a.checkRate(testSender); code != types2.CodeOK {
+			t.Errorf("tx %d: %d", i, code)
+		}
+	}
+	if code, _ := a.checkRate(testSender); code != ErrRateLimited {
+		t.Errorf("tx 2: %d", code)
+	}
+	if code, _ := a.checkRate("bcbOther"); code != types2.CodeOK {
+		t.Errorf("other sender: %d", code)
+	}
+	now = now.Add(time.Second)
+	if code, _ := a.checkRate(testSender); code != types2.CodeOK {
+		t.Errorf("next window: %d", code)
+	}
+	now = now.Add(time.Second)
+	a.prune()
+	if len(a.counters) != 0 {
+		t.Errorf("counters after prune: %d", len(a.counters))
+	}
+
+	if code, _ := a.checkGasPrice(500, 50000); code != types2.CodeOK {
+		t.Errorf("gas price 100: %d", code)
+	}
+	if code, _ := a.checkGasPrice(500, 49999); code != ErrGasPriceTooLow {
+		t.Errorf("gas price 99: %d", code)
+	}
+	if hint := priorityHint(500, 50000); hint != `{"priority":50000,"gasPrice":100}` {
+		t.Errorf("hint: %s", hint)
+	}
+}
@@ -37,6 +37,7 @@ func (app *AppDeliver) BCBeginBlock(req abci.RequestBeginBlock) (abci.ResponseBe
 	app.fee = 0
 	app.rewards = map[string]int64{}
 	app.rewardStrategy = statedbhelper.GetRewardStrategy(app.transID, app.txID, app.blockHeader.Height)
+	app.resetBlockBudget()
 
 	//statedbhelper.BeginBlock(transID)
 	//app.logger.Debug("SetAppState", "new appState", app.appState)
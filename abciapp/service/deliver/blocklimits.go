@@ -0,0 +1,59 @@
+package deliver
+
+import (
+	"fmt"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	types2 "github.com/bcbchain/bclib/types"
+)
+
+//ErrBlockLimitExceeded is code of tx rejected because a budget of block is used up
+const ErrBlockLimitExceeded = types2.ErrDeliverTx + 10
+
+// blockBudget is resources used by txs of block and limits of them.
+type blockBudget struct {
+	limits       statedbhelper.BlockLimits
+	gasUsed      int64
+	invocations  int64
+	receiptBytes int64
+}
+
+// resetBlockBudget loads limits effective at height of block, it's called in BCBeginBlock.
+// Block is unlimited before the fork.
+func (app *AppDeliver) resetBlockBudget() {
+	app.budget = blockBudget{}
+	if !softforks.IsActive(softforks.BlockLimits, app.blockHeader.Height) {
+		return
+	}
+	app.budget.limits = statedbhelper.GetBlockLimits(app.transID, app.txID, app.blockHeader.Height)
+}
+
+// checkBlockBudget returns message of budget which is used up, the tx and all txs after it
+// are rejected without being invoked.
+func (app *AppDeliver) checkBlockBudget() string {
+	b := app.budget
+	switch {
+	case b.limits.MaxGas > 0 && b.gasUsed >= b.limits.MaxGas:
+		return fmt.Sprintf("gas of block is used up, limit %d", b.limits.MaxGas)
+	case b.limits.MaxInvocations > 0 && b.invocations >= b.limits.MaxInvocations:
+		return fmt.Sprintf("invocations of block are used up, limit %d", b.limits.MaxInvocations)
+	case b.limits.MaxReceiptBytes > 0 && b.receiptBytes >= b.limits.MaxReceiptBytes:
+		return fmt.Sprintf("receipt bytes of block are used up, limit %d", b.limits.MaxReceiptBytes)
+	}
+	return ""
+}
+
+// useBlockBudget adds resources used by finished tx to budget.
+func (app *AppDeliver) useBlockBudget(result *invokeResult, res types.ResponseDeliverTx) {
+	if result.response == nil {
+		return
+	}
+
+	app.budget.gasUsed += int64(res.GasUsed)
+	app.budget.invocations += result.invocations
+	for _, tag := range res.Tags {
+		app.budget.receiptBytes += int64(len(tag.Value))
+	}
+}
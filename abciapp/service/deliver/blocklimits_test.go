@@ -0,0 +1,47 @@
+package deliver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	types2 "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	"github.com/bcbchain/bclib/types"
+)
+
+func TestBlockBudget(t *testing.T) {
+	app := &AppDeliver{budget: blockBudget{limits: statedbhelper.BlockLimits{MaxGas: 1000, MaxInvocations: 4}}}
+	result := &invokeResult{
+		transaction: types.Transaction{Messages: make([]types.Message, 2)},
+		response:    &types.Response{},
+		invocations: 2,
+	}
+
+	// 没有执行合约的交易不占用预算
+	app.useBlockBudget(&invokeResult{}, types2.ResponseDeliverTx{GasUsed: 5000})
+	if msg := app.checkBlockBudget(); msg != "" {
+		t.Errorf("empty budget: %s", msg)
+	}
+
+	app.useBlockBudget(result, types2.ResponseDeliverTx{GasUsed: 500, Tags: []common.KVPair{{Value: []byte("receipt")}}})
+	if msg := app.checkBlockBudget(); msg != "" {
+		t.Errorf("budget left: %s", msg)
+	}
+	if app.budget.receiptBytes != 7 {
+		t.Errorf("receipt bytes: %d", app.budget.receiptBytes)
+	}
+
+	// 第一条消息失败的交易只调用了一次合约，按调用器统计的次数计算
+	failed := &invokeResult{transaction: result.transaction, response: &types.Response{Code: types.ErrDeliverTx}, invocations: 1}
+	app.useBlockBudget(failed, types2.ResponseDeliverTx{GasUsed: 100})
+	if msg := app.checkBlockBudget(); msg != "" {
+		t.Errorf("budget left after failed tx: %s", msg)
+	}
+
+	// 调用次数用完
+	app.useBlockBudget(failed, types2.ResponseDeliverTx{GasUsed: 100})
+	if msg := app.checkBlockBudget(); !strings.Contains(msg, "invocations") {
+		t.Errorf("invocations used up: %s", msg)
+	}
+}
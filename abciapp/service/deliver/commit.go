@@ -1,6 +1,7 @@
 package deliver
 
 import (
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
 	"github.com/bcbchain/bcbchain/smcrunctl/adapter"
 	"encoding/binary"
@@ -18,6 +19,10 @@ func (app *AppDeliver) commit() abci.ResponseCommit {
 	app.logger.Info("Recv ABCI interface: Commit",
 		"height", app.appState.BlockHeight)
 
+	if softforks.IsActive(softforks.StateRoot, app.appState.BlockHeight) {
+		return app.commitWithStateRoot()
+	}
+
 	// For empty block, its apphash is exactly same to the last one.
 	if app.hashList.Len() == 0 {
 		return app.commitEmptyBlock()
@@ -42,6 +47,38 @@ func (app *AppDeliver) commit() abci.ResponseCommit {
 	app.logger.Info("commitTx", "appHash", app.appState.AppHash)
 
 	//rewards
+	app.appState.Rewards = app.rewardsKVPairs()
+	app.appState.Fee = uint64(app.fee)
+
+	// SetWorldAppState and commit block
+	app.commitBlock()
+	//SDK commit
+	adapter.GetInstance().Commit(app.transID)
+	return abci.ResponseCommit{AppState: abci.AppStateToByte(app.appState)}
+}
+
+// commitWithStateRoot takes root of state tree as app hash, including empty block,
+// so every state key can be proven against it.
+func (app *AppDeliver) commitWithStateRoot() abci.ResponseCommit {
+	hashListBytes := make([]crypto.Hash, 0)
+	for txHash := app.hashList.Front(); txHash != nil; txHash = txHash.Next() {
+		hashListBytes = append(hashListBytes, crypto.Hash(txHash.Value.([]byte)))
+	}
+	app.appState.TxsHashList = hashListBytes
+	app.appState.Rewards = app.rewardsKVPairs()
+	app.appState.Fee = uint64(app.fee)
+
+	// all changes must be in transaction before calculating state root
+	statedbhelper.CommitTx(app.transID, app.txID)
+	app.appState.AppHash = statedbhelper.CalcStateRoot(app.transID)
+	app.logger.Info("commitTx", "stateRoot", app.appState.AppHash)
+
+	app.commitBlock()
+	adapter.GetInstance().Commit(app.transID)
+	return abci.ResponseCommit{AppState: abci.AppStateToByte(app.appState)}
+}
+
+func (app *AppDeliver) rewardsKVPairs() []common.KVPair {
 	keys := make([]string, 0)
 	for k := range app.rewards {
 		keys = append(keys, k)
@@ -53,14 +90,7 @@ func (app *AppDeliver) commit() abci.ResponseCommit {
 		binary.BigEndian.PutUint64(uintByte, uint64(app.rewards[k]))
 		kvps[i] = common.KVPair{Key: []byte(k), Value: uintByte}
 	}
-	app.appState.Rewards = kvps
-	app.appState.Fee = uint64(app.fee)
-
-	// SetWorldAppState and commit block
-	app.commitBlock()
-	//SDK commit
-	adapter.GetInstance().Commit(app.transID)
-	return abci.ResponseCommit{AppState: abci.AppStateToByte(app.appState)}
+	return kvps
 }
 
 func (app *AppDeliver) commitEmptyBlock() abci.ResponseCommit {
@@ -1,7 +1,10 @@
 package deliver
 
 import (
+	"github.com/bcbchain/bcbchain/abciapp/service/events"
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/common/txindex"
+	"github.com/bcbchain/bclib/algorithm"
 	"github.com/bcbchain/bclib/types"
 	"container/list"
 	abci "github.com/bcbchain/bclib/tendermint/abci/types"
@@ -28,6 +31,10 @@ type AppDeliver struct {
 	fee            int64                    //总费用
 	rewards        map[types.Address]int64  //奖励策略
 	scGenesis      []*abci.SideChainGenesis // 侧链创世信息
+	parallel       bool                     // DeliverTxs 并行执行交易
+	txIndex        int                      // 下一笔交易在区块中的序号，用于发布事件和交易索引
+	budget         blockBudget              // 区块资源预算，用完后拒绝剩余的交易
+	invoker        contractInvoker          // 调用合约，为 nil 时使用 smcrunctl 的 adapter
 }
 
 //SetLogger set logger
@@ -40,6 +47,11 @@ func (app *AppDeliver) SetChainID(chainID string) {
 	app.chainID = chainID
 }
 
+//SetParallel sets whether txs delivered by DeliverTxs are invoked in parallel
+func (app *AppDeliver) SetParallel(parallel bool) {
+	app.parallel = parallel
+}
+
 //InitChain init chain
 func (app *AppDeliver) InitChain(req abci.RequestInitChain) abci.ResponseInitChain {
 	return app.initChain(req)
@@ -47,12 +59,26 @@ func (app *AppDeliver) InitChain(req abci.RequestInitChain) abci.ResponseInitCha
 
 //BeginBlock beginblock interface of app
 func (app *AppDeliver) BeginBlock(req abci.RequestBeginBlock) (abci.ResponseBeginBlock, map[string][]byte) {
-	return app.BCBeginBlock(req)
+	res, txBuffer := app.BCBeginBlock(req)
+	app.txIndex = 0
+	txindex.BeginBlock()
+
+	events.Publish(&events.BeginBlock{
+		Height:          req.Header.Height,
+		Time:            req.Header.Time,
+		Hash:            req.Hash,
+		ProposerAddress: req.Header.ProposerAddress,
+		Code:            res.Code,
+		Log:             res.Log,
+	})
+	return res, txBuffer
 }
 
 //DeliverTx DeliverTx interface of app
 func (app *AppDeliver) DeliverTx(tx []byte) (abci.ResponseDeliverTx, map[string][]byte) {
-	return app.deliverBCTx(tx)
+	res, txBuffer := app.deliverBCTx(tx)
+	app.publishTx(tx, res)
+	return res, txBuffer
 }
 
 func (app *AppDeliver) CleanData() error {
@@ -73,8 +99,11 @@ func (app *AppDeliver) EndBlock(req abci.RequestEndBlock) (abci.ResponseEndBlock
 	app.logger.Info("Recv ABCI interface: EndBlock", "height", req.Height)
 
 	response := abci.ResponseEndBlock{}
+	// run calls scheduled at this height before mining
+	scheduledBuffer := app.runScheduledCalls()
 	// call mine method if contract has declare it
 	resp, txBuffer := app.mine()
+	txBuffer = combineBuffer(scheduledBuffer, txBuffer)
 	if resp.Code == types.CodeOK && len(resp.Data) != 0 {
 		response.RewardAmount, _ = strconv.ParseInt(resp.Data, 10, 64)
 	}
@@ -89,19 +118,50 @@ func (app *AppDeliver) EndBlock(req abci.RequestEndBlock) (abci.ResponseEndBlock
 		app.scGenesis = nil
 	}
 	response.ChainVersion = app.appState.ChainVersion
+
+	events.Publish(&events.EndBlock{
+		Height:           req.Height,
+		RewardAmount:     response.RewardAmount,
+		ValidatorUpdates: response.ValidatorUpdates,
+		SideChainGenesis: len(response.SCGenesis),
+	})
 	return response, txBuffer
 }
 
 // Commit commit interface of app
 func (app *AppDeliver) Commit() abci.ResponseCommit {
-	return app.commit()
+	res := app.commit()
+	if err := txindex.Commit(app.appState.BlockHeight); err != nil {
+		app.logger.Error("index txs failed", "height", app.appState.BlockHeight, "error", err)
+	}
+
+	events.Publish(&events.Commit{
+		Height:  app.appState.BlockHeight,
+		AppHash: app.appState.AppHash,
+	})
+	return res
+}
+
+// publishTx publishes events of delivered tx and its receipts, and adds it to tx index.
+func (app *AppDeliver) publishTx(tx []byte, res abci.ResponseDeliverTx) {
+	app.publishTxWithHash(tx, algorithm.CalcCodeHash(string(tx)), res)
+}
+
+// publishTxWithHash publishes tx whose hash isn't hash of tx itself, such as scheduled call.
+func (app *AppDeliver) publishTxWithHash(tx, txHash []byte, res abci.ResponseDeliverTx) {
+	res.TxHash = txHash
+	events.PublishTx(app.blockHeader.Height, app.txIndex, res)
+	txindex.AddTx(app.blockHeader.Height, app.txIndex, tx, res)
+	app.txIndex++
 }
 
 // ------------- add for support v1 transaction begin ----------------
 
 // RunDeliverTx - invoked by v1 deliverTx, if it's standard transfer method.
 func (app *AppDeliver) RunDeliverTx(tx []byte, transaction types.Transaction, pubKey crypto.PubKeyEd25519) (abci.ResponseDeliverTx, map[string][]byte) {
-	return app.runDeliverTx(tx, transaction, pubKey)
+	res, txBuffer := app.runDeliverTx(tx, transaction, pubKey)
+	app.publishTx(tx, res)
+	return res, txBuffer
 }
 
 // AddDeliverHash - invoked by v1 deliverTx, add v1 deliverHash to v2 tx hash list;
@@ -34,46 +34,148 @@ func (app *AppDeliver) deliverBCTx(tx []byte) (resDeliverTx types.ResponseDelive
 	}
 	app.txID = statedbhelper.NewTx(app.transID)
 
+	transaction, pubKey, err := app.parseTx(tx)
+	if err != nil {
+		return app.reportFailure(tx, types2.ErrDeliverTx, "tx parse failed"), nil
+	}
+
+	return app.runDeliverTx(tx, transaction, pubKey)
+}
+
+func (app *AppDeliver) parseTx(tx []byte) (transaction types2.Transaction, pubKey crypto.PubKeyEd25519, err error) {
+	txStr, _, err := app.splitSponsoredTx(tx)
+	if err != nil {
+		app.logger.Error("tx parse failed:", err)
+		return
+	}
+
 	// for base58
 	tx2.Init(app.chainID)
-	transaction, pubKey, err := tx2.TxParse(string(tx))
+	transaction, pubKey, err = tx2.TxParse(txStr)
 	if err != nil {
 		// for base64
 		tx3.Init(app.chainID)
-		transaction, pubKey, err = tx3.TxParse(string(tx))
+		transaction, pubKey, err = tx3.TxParse(txStr)
 		if err != nil {
 			app.logger.Error("tx parse failed:", err)
-			return app.reportFailure(tx, types2.ErrDeliverTx, "tx parse failed"), nil
+			return
 		}
 	}
 	app.logger.Debug("DELIVER.TX", "height", app.blockHeader.Height, "tx", transaction, "pubKey", pubKey, "addr", pubKey.Address(statedbhelper.GetChainID()))
 
-	return app.runDeliverTx(tx, transaction, pubKey)
+	return
 }
 
 func (app *AppDeliver) runDeliverTx(tx []byte, transaction types2.Transaction, pubKey crypto.PubKeyEd25519) (resDeliverTx types.ResponseDeliverTx, txBuffer map[string][]byte) {
-	resDeliverTx.Code = types2.CodeOK
+	if msg := app.checkBlockBudget(); msg != "" {
+		return app.reportFailure(tx, ErrBlockLimitExceeded, msg), nil
+	}
+
+	result := app.invokeTx(app.txID, tx, transaction, pubKey, false)
+	resDeliverTx, txBuffer = app.finishDeliverTx(result)
+	app.useBlockBudget(result, resDeliverTx)
+	return
+}
+
+// invokeResult is result of invoking tx, it's finished by finishDeliverTx in the order of txs.
+type invokeResult struct {
+	tx          []byte
+	transaction types2.Transaction
+	failure     string // tx failed before invoking contract
+	nonceBuffer map[string][]byte
+	nonceInTx   bool // nonce is set to tx buffer, it's moved to transaction when tx is finished
+	response    *types2.Response
+	sponsorship *statedbhelper.Sponsorship // nil if tx isn't sponsored
+	sponsor     types2.Address             // address of sponsor who pays fee
+	invocations int64                      // count of contracts invoked by tx
+}
+
+// contractInvoker invokes contracts of txs and rolls back their cache in dockers, it's adapter
+// of smcrunctl except in tests.
+type contractInvoker interface {
+	InvokeSponsoredTx(blockHeader types.Header, transID, txID int64, sender, sponsor types2.Address, tx types2.Transaction,
+		publicKey types2.PubKey, txHash types2.Hash, blockHash types2.Hash) *types2.Response
+	TakeInvocations(transID, txID int64) int64
+	RollbackTx(transID, txID int64)
+	CleansDockerCache(tags []common.KVPair) bool
+}
+
+func (app *AppDeliver) contractInvoker() contractInvoker {
+	if app.invoker != nil {
+		return app.invoker
+	}
+	return adapter.GetInstance()
+}
+
+// invokeTx sets nonce and invokes contract of tx, it changes nothing of app, so txs can be
+// invoked in parallel. Speculative tx sets nonce to its own buffer, then other txs don't see it
+// and it's discarded if tx is rolled back.
+func (app *AppDeliver) invokeTx(txID int64, tx []byte, transaction types2.Transaction, pubKey crypto.PubKeyEd25519, speculative bool) *invokeResult {
+	result := &invokeResult{tx: tx, transaction: transaction}
 
 	if len(transaction.Note) > types2.MaxSizeNote {
-		return app.reportFailure(tx, types2.ErrDeliverTx, "tx note is out of range"), nil
+		result.failure = "tx note is out of range"
+		return result
 	}
 
 	sender := pubKey.Address(statedbhelper.GetChainID())
-	nonceBuffer, err := statedbhelper.SetAccountNonce(app.transID, app.txID, sender, transaction.Nonce)
+	sp, err := app.sponsorshipOf(tx, transaction.Note)
+	if err != nil {
+		result.failure = err.Error()
+		return result
+	}
+	if sp != nil {
+		sponsor, err := statedbhelper.CheckSponsorship(app.transID, txID, sp, sender, transaction, app.blockHeader.Height)
+		if err != nil {
+			result.failure = err.Error()
+			return result
+		}
+		result.sponsorship, result.sponsor = sp, sponsor
+	}
+
+	setNonce := statedbhelper.SetAccountNonce
+	if speculative {
+		setNonce = statedbhelper.SetAccountNonceToTx
+	}
+	nonceBuffer, err := setNonce(app.transID, txID, sender, transaction.Nonce)
 	if err != nil {
 		app.logger.Error("SetAccountNonce failed:", err)
-		return app.reportFailure(tx, types2.ErrDeliverTx, "SetAccountNonce failed"), nil
+		result.failure = "SetAccountNonce failed"
+		return result
+	}
+	result.nonceBuffer, result.nonceInTx = nonceBuffer, speculative
+
+	if height, ok := app.scheduleHeightOf(transaction); ok {
+		result.response = app.scheduleTx(txID, tx, transaction, sender, height)
+		return result
 	}
 
 	txHash := common.HexBytes(algorithm.CalcCodeHash(string(tx)))
-	adp := adapter.GetInstance()
-	response := adp.InvokeTx(app.blockHeader, app.transID, app.txID, sender, transaction, pubKey.Bytes(), txHash, app.blockHash)
+	adp := app.contractInvoker()
+	result.response = adp.InvokeSponsoredTx(app.blockHeader, app.transID, txID, sender, result.sponsor, transaction, pubKey.Bytes(), txHash, app.blockHash)
+	result.invocations = adp.TakeInvocations(app.transID, txID)
+	return result
+}
+
+// finishDeliverTx pays fee and commits tx of app.txID.
+func (app *AppDeliver) finishDeliverTx(result *invokeResult) (resDeliverTx types.ResponseDeliverTx, txBuffer map[string][]byte) {
+	resDeliverTx.Code = types2.CodeOK
+
+	if result.failure != "" {
+		return app.reportFailure(result.tx, types2.ErrDeliverTx, result.failure), nil
+	}
+	if result.nonceInTx {
+		statedbhelper.CommitAccountNonce(app.transID, app.txID, result.nonceBuffer)
+	}
+
+	tx, transaction, response, nonceBuffer := result.tx, result.transaction, result.response, result.nonceBuffer
+	adp := app.contractInvoker()
 	if response.Code != types2.CodeOK {
 		app.logger.Error("docker invoke error.....", "error", response.Log)
 		app.logger.Debug("docker invoke error.....", "response", response.String())
 		statedbhelper.RollbackTx(app.transID, app.txID)
 		adp.RollbackTx(app.transID, app.txID)
-		resDeliverTx, txBuffer, totalFee := app.reportInvokeFailure(tx, transaction, response)
+		resDeliverTx, txBuffer, totalFee := app.reportInvokeFailure(result)
 		resDeliverTx.Fee = uint64(totalFee)
 		return resDeliverTx, combineBuffer(nonceBuffer, txBuffer)
 	}
@@ -91,6 +193,7 @@ func (app *AppDeliver) runDeliverTx(tx []byte, transaction types2.Transaction, p
 
 	//emit new summary fee  and transferFee receipts
 	tags, totalFee := app.emitFeeReceipts(transaction, response, true)
+	tags = append(tags, app.chargeSponsor(result)...)
 
 	resDeliverTx.Code = response.Code
 	resDeliverTx.Log = response.Log
@@ -143,12 +246,14 @@ func (app *AppDeliver) reportFailure(tx []byte, errorCode uint32, msg string) (r
 	return
 }
 
-func (app *AppDeliver) reportInvokeFailure(tx []byte, transaction types2.Transaction, response *types2.Response) (
+func (app *AppDeliver) reportInvokeFailure(result *invokeResult) (
 	resDeliverTx types.ResponseDeliverTx,
 	txBuffer map[string][]byte,
 	totalFee int64) {
 
+	tx, transaction, response := result.tx, result.transaction, result.response
 	rcpts, totalFee := app.emitFeeReceipts(transaction, response, false)
+	rcpts = append(rcpts, app.chargeSponsor(result)...)
 	resDeliverTx = types.ResponseDeliverTx{
 		Code:     response.Code,
 		Log:      response.Log,
@@ -220,7 +325,7 @@ func (app *AppDeliver) emitFeeReceipts(transaction types2.Transaction, response
 		tags = append(tags, kv)
 		for index, r := range transRcpt {
 			kv := common.KVPair{
-				Key:   []byte(fmt.Sprintf("/%d/%d/transferFee", len(transaction.Messages), index+1)),
+				Key:   []byte(fmt.Sprintf("/%d/%d/%s", len(transaction.Messages), index+1, receiptName(r))),
 				Value: r,
 			}
 			tags = append(tags, kv)
@@ -240,6 +345,10 @@ func (app *AppDeliver) distributeFee(fee std.Fee, proposerReward types2.Address,
 		statedbhelper.SetBalance(app.transID, app.txID, fee.From, fee.Token, v)
 	}
 
+	if softforks.IsActive(softforks.FeeDistribution, app.blockHeader.Height) {
+		return app.distributeFeeExactly(fee, proposerReward)
+	}
+
 	// Set rewards balance
 	leftFee := fee.Value
 	for i, reward := range app.rewardStrategy {
@@ -266,7 +375,7 @@ func (app *AppDeliver) distributeFee(fee std.Fee, proposerReward types2.Address,
 		v := statedbhelper.BalanceOf(app.transID, app.txID, addr, fee.Token)
 		v = v.Add(award)
 		statedbhelper.SetBalance(app.transID, app.txID, addr, fee.Token, v)
-		if softforks.V2_0_1_13780(app.blockHeader.Height) {
+		if !softforks.IsActive(softforks.RewardTokenInAccount, app.blockHeader.Height) {
 			// 没有将资产信息添加到账户资产列表
 		} else {
 			statedbhelper.AddAccountToken(app.transID, app.txID, addr, fee.Token)
@@ -460,6 +569,25 @@ func emitTotalFeeReceipt(fees map[types2.Address]std.Fee) (map[types2.Address][]
 	return bbrs, nil
 }
 
+func emitReceipt(name string, v interface{}) []byte {
+	bz, err := jsoniter.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	receipt := types2.Receipt{
+		Name:         name,
+		ReceiptBytes: bz,
+		ReceiptHash:  nil,
+	}
+
+	receipt.ReceiptHash = sha3.Sum256([]byte(receipt.Name), bz)
+	bz, err = jsoniter.Marshal(receipt)
+	if err != nil {
+		return nil
+	}
+	return bz
+}
+
 func emitTransferReceipt(sender, to, tokenAddr types2.Address, value bn.Number) []byte {
 	trans := std.Transfer{
 		Token: tokenAddr,
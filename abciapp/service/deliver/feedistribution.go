@@ -0,0 +1,204 @@
+package deliver
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/smcrunctl/adapter"
+	types2 "github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+const burnFeeReceiptName = "burnFee"
+
+//distributeFeeExactly distributes fee by reward strategy of fee's token with integer arithmetic,
+//every share is rounded down and the last share gets all the remainder, so shares sum to fee exactly.
+func (app *AppDeliver) distributeFeeExactly(fee std.Fee, proposerReward types2.Address) (receipts [][]byte, bcerr types2.BcError) {
+	strategy := strategyOfToken(app.rewardStrategy, fee.Token)
+	shares, err := splitFee(bn.N(fee.Value), strategy)
+	if err != nil {
+		bcerr.ErrorCode = types2.ErrDeliverTx
+		bcerr.ErrorDesc = err.Error()
+		app.logger.Error("Split fee failed", "error", err)
+		return
+	}
+
+	for i, share := range shares {
+		if share.IsLEI(0) {
+			continue
+		}
+
+		kind := statedbhelper.RewardKindProposer
+		addr := proposerReward
+		if i < len(strategy) {
+			kind, addr = rewardKindOf(strategy[i]), strategy[i].Address
+		}
+		app.logger.Debug("The rewards of Fee", "kind", kind, "address", addr, "value", share)
+
+		switch kind {
+		case statedbhelper.RewardKindBurn:
+			receipts = append(receipts, app.burnFee(fee, share, proposerReward)...)
+		case statedbhelper.RewardKindValidators:
+			receipts = append(receipts, app.rewardValidators(fee, share, proposerReward)...)
+		case statedbhelper.RewardKindProposer:
+			receipts = append(receipts, app.rewardFee(fee, proposerReward, share))
+		default:
+			receipts = append(receipts, app.rewardFee(fee, addr, share))
+		}
+	}
+
+	bcerr.ErrorCode = types2.CodeOK
+	return
+}
+
+//rewardFee adds value of fee to balance of addr
+func (app *AppDeliver) rewardFee(fee std.Fee, addr types2.Address, value bn.Number) []byte {
+	v := statedbhelper.BalanceOf(app.transID, app.txID, addr, fee.Token).Add(value)
+	statedbhelper.SetBalance(app.transID, app.txID, addr, fee.Token, v)
+	statedbhelper.AddAccountToken(app.transID, app.txID, addr, fee.Token)
+	app.logger.Debug("The reward's balance", "reward", addr, "balance", v)
+
+	app.rewards[addr] = app.rewards[addr] + value.Value().Int64()
+	return emitTransferReceipt(fee.From, addr, fee.Token, value)
+}
+
+//rewardValidators splits value by power of validators, it's rewarded to proposer if there's no validator
+func (app *AppDeliver) rewardValidators(fee std.Fee, value bn.Number, proposerReward types2.Address) (receipts [][]byte) {
+	validators := make([]statedbhelper.Validator, 0)
+	totalPower := int64(0)
+	for _, v := range statedbhelper.GetAllValidators(app.transID, app.txID) {
+		if v.Power > 0 && v.RewardAddr != "" {
+			validators = append(validators, v)
+			totalPower += v.Power
+		}
+	}
+	if totalPower == 0 {
+		return [][]byte{app.rewardFee(fee, proposerReward, value)}
+	}
+
+	left := value
+	for i, v := range validators {
+		award := value.MulI(v.Power).DivI(totalPower)
+		if i == len(validators)-1 {
+			award = left
+		}
+		left = left.Sub(award)
+
+		if award.IsGreaterThanI(0) {
+			receipts = append(receipts, app.rewardFee(fee, v.RewardAddr, award))
+		}
+	}
+	return
+}
+
+//burnFee reduces total supply of fee's token by value, it's rewarded to proposer if token doesn't exist
+func (app *AppDeliver) burnFee(fee std.Fee, value bn.Number, proposerReward types2.Address) [][]byte {
+	token := statedbhelper.GetTokenByAddress(app.transID, app.txID, fee.Token)
+	if token == nil {
+		return [][]byte{app.rewardFee(fee, proposerReward, value)}
+	}
+
+	token.TotalSupply = token.TotalSupply.Sub(value)
+	statedbhelper.SetToken(app.transID, app.txID, token)
+	adapter.GetInstance().DirtyToken(fee.Token)
+	app.logger.Debug("Burn fee", "token", fee.Token, "value", value, "totalSupply", token.TotalSupply)
+
+	return [][]byte{emitBurnFeeReceipt(fee.Token, value, token.TotalSupply)}
+}
+
+//strategyOfToken returns rewarders of token if there's any, otherwise returns rewarders for all tokens
+func strategyOfToken(strategy []statedbhelper.Rewarder, token types2.Address) []statedbhelper.Rewarder {
+	general := make([]statedbhelper.Rewarder, 0)
+	special := make([]statedbhelper.Rewarder, 0)
+	for _, r := range strategy {
+		switch r.Token {
+		case "":
+			general = append(general, r)
+		case token:
+			special = append(special, r)
+		}
+	}
+
+	if len(special) > 0 {
+		return special
+	}
+	return general
+}
+
+//rewardKindOf returns kind of rewarder, rewarder without kind is configured as the old strategy
+func rewardKindOf(r statedbhelper.Rewarder) string {
+	switch r.Kind {
+	case "":
+		//revard name "validators" writes into genesis file, cannot be modified.
+		if r.Address == "" && r.Name == "validators" {
+			return statedbhelper.RewardKindProposer
+		}
+		return statedbhelper.RewardKindAddress
+	case statedbhelper.RewardKindTreasury:
+		return statedbhelper.RewardKindAddress
+	default:
+		return r.Kind
+	}
+}
+
+//splitFee splits fee by percents of strategy, the last share gets the remainder, if there's no
+//strategy, an only share is returned for proposer.
+func splitFee(fee bn.Number, strategy []statedbhelper.Rewarder) ([]bn.Number, error) {
+	shares := make([]bn.Number, 0, len(strategy)+1)
+	total := new(big.Rat)
+	left := fee
+	for i, r := range strategy {
+		switch rewardKindOf(r) {
+		case statedbhelper.RewardKindAddress:
+			if r.Address == "" {
+				return nil, fmt.Errorf("rewarder %s has no address", r.Name)
+			}
+		case statedbhelper.RewardKindProposer, statedbhelper.RewardKindValidators, statedbhelper.RewardKindBurn:
+		default:
+			return nil, fmt.Errorf("invalid kind %s of rewarder %s", r.Kind, r.Name)
+		}
+
+		percent, ok := new(big.Rat).SetString(r.RewardPercent)
+		if !ok || percent.Sign() < 0 {
+			return nil, fmt.Errorf("invalid reward percent %s of rewarder %s", r.RewardPercent, r.Name)
+		}
+		total.Add(total, percent)
+		if total.Cmp(big.NewRat(100, 1)) > 0 {
+			return nil, fmt.Errorf("reward percents sum to %s, more than 100", total.FloatString(2))
+		}
+
+		share := bn.NB(new(big.Int).Div(
+			new(big.Int).Mul(fee.Value(), percent.Num()),
+			new(big.Int).Mul(percent.Denom(), big.NewInt(100))))
+		if i == len(strategy)-1 {
+			share = left
+		}
+		shares = append(shares, share)
+		left = left.Sub(share)
+	}
+
+	if len(strategy) == 0 {
+		shares = append(shares, fee)
+	}
+	return shares, nil
+}
+
+func emitBurnFeeReceipt(tokenAddr types2.Address, value, totalSupply bn.Number) []byte {
+	return emitReceipt(burnFeeReceiptName, std.Burn{
+		Token:       tokenAddr,
+		Value:       value,
+		TotalSupply: totalSupply,
+	})
+}
+
+//receiptName returns name of receipt emitted by distributeFee
+func receiptName(r []byte) string {
+	var receipt types2.Receipt
+	if err := jsoniter.Unmarshal(r, &receipt); err != nil {
+		return "transferFee"
+	}
+	return receipt.Name
+}
@@ -0,0 +1,51 @@
+package deliver
+
+import (
+	"testing"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/sdk/sdk/bn"
+)
+
+func TestSplitFee(t *testing.T) {
+	strategy := []statedbhelper.Rewarder{
+		{Name: "validators", RewardPercent: "33.33"},
+		{Name: "burn", RewardPercent: "33.33", Kind: statedbhelper.RewardKindBurn},
+		{Name: "treasury", RewardPercent: "33.34", Address: "bcbTreasury", Kind: statedbhelper.RewardKindTreasury},
+	}
+
+	// 舍去的零头都给最后一份
+	shares, err := splitFee(bn.N(1001), strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 3 || shares[0].CmpI(333) != 0 || shares[1].CmpI(333) != 0 || shares[2].CmpI(335) != 0 {
+		t.Errorf("shares: %v", shares)
+	}
+
+	// 没有奖励策略时全部给出块者
+	shares, err = splitFee(bn.N(1001), nil)
+	if err != nil || len(shares) != 1 || shares[0].CmpI(1001) != 0 {
+		t.Errorf("shares without strategy: %v %v", shares, err)
+	}
+
+	// 比例之和超过 100
+	strategy[2].RewardPercent = "50"
+	if _, err = splitFee(bn.N(1001), strategy); err == nil {
+		t.Error("percents more than 100 must fail")
+	}
+}
+
+func TestStrategyOfToken(t *testing.T) {
+	strategy := []statedbhelper.Rewarder{
+		{Name: "validators", RewardPercent: "100"},
+		{Name: "burn", RewardPercent: "100", Kind: statedbhelper.RewardKindBurn, Token: "bcbToken"},
+	}
+
+	if s := strategyOfToken(strategy, "bcbToken"); len(s) != 1 || s[0].Name != "burn" {
+		t.Errorf("strategy of bcbToken: %v", s)
+	}
+	if s := strategyOfToken(strategy, "bcbOther"); len(s) != 1 || s[0].Name != "validators" {
+		t.Errorf("strategy of bcbOther: %v", s)
+	}
+}
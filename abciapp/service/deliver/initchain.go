@@ -36,14 +36,15 @@ type InitChainInfo struct {
 
 // InitAppState init chain app state
 type InitAppState struct {
-	Organization   string        `json:"organization,omitempty"`
-	GasPriceRatio  string        `json:"gas_price_ratio"`
-	ChainVersion   int64         `json:"chainVersion,omitempty"`
-	Token          std.Token     `json:"token,omitempty"`
-	RewardStrategy []Rewarder    `json:"rewardStrategy,omitempty"`
-	Contracts      []Contract    `json:"contracts,omitempty"`
-	OrgBind        OrgBind       `json:"orgBind"`
-	MainChain      MainChainInfo `json:"mainChain"`
+	Organization   string                      `json:"organization,omitempty"`
+	GasPriceRatio  string                      `json:"gas_price_ratio"`
+	ChainVersion   int64                       `json:"chainVersion,omitempty"`
+	Token          std.Token                   `json:"token,omitempty"`
+	RewardStrategy []Rewarder                  `json:"rewardStrategy,omitempty"`
+	BlockLimits    []statedbhelper.BlockLimits `json:"blockLimits,omitempty"`
+	Contracts      []Contract                  `json:"contracts,omitempty"`
+	OrgBind        OrgBind                     `json:"orgBind"`
+	MainChain      MainChainInfo               `json:"mainChain"`
 }
 
 type OrgBind struct {
@@ -201,6 +202,13 @@ func (app *AppDeliver) initChain(req abci.RequestInitChain) (response abci.Respo
 		panic("Genesis failed, log:" + r.Log)
 	}
 
+	// block limits are changed by governance contract after genesis
+	if len(initAppState.BlockLimits) != 0 {
+		if err := statedbhelper.UpdateBlockLimits(transID, txID, initAppState.BlockLimits, 0); err != nil {
+			panic("Genesis failed, log:" + err.Error())
+		}
+	}
+
 	adapterIns.Commit(transID)
 	statedbhelper.CommitTx(transID, 1)
 	statedbhelper.CommitBlock(transID)
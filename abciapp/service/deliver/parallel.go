@@ -0,0 +1,170 @@
+package deliver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	types2 "github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// batchTx is a tx delivered in batch.
+type batchTx struct {
+	raw         []byte
+	txID        int64
+	parsed      bool
+	transaction types2.Transaction
+	pubKey      crypto.PubKeyEd25519
+	lane        string        // txs of a lane are invoked one by one, empty lane means tx is invoked when it's finished
+	result      *invokeResult // nil if tx isn't invoked or it's rolled back
+}
+
+// DeliverTxs delivers consecutive txs of block, responses are in the order of txs.
+// In parallel mode txs are invoked speculatively in lanes on separated tx buffers, then they
+// are finished one by one in order, a tx which conflicts with txs finished before it is invoked
+// again, so deliver hash and app hash are the same as delivering txs one by one. Before fork
+// ParallelDeliver dockers keep cache of failed tx, so txs are always delivered one by one.
+func (app *AppDeliver) DeliverTxs(txs [][]byte) []types.ResponseDeliverTx {
+	responses := make([]types.ResponseDeliverTx, len(txs))
+	if !app.parallel || len(txs) < 2 || !softforks.IsActive(softforks.ParallelDeliver, app.blockHeader.Height) {
+		for i, tx := range txs {
+			responses[i], _ = app.DeliverTx(tx)
+		}
+		return responses
+	}
+
+	app.logger.Info("Recv ABCI interface: DeliverTx batch", "count", len(txs))
+	if app.chainID == "" {
+		app.SetChainID(statedbhelper.GetChainID())
+	}
+
+	batch := make([]*batchTx, len(txs))
+	lanes := make(map[string][]*batchTx)
+	for i, tx := range txs {
+		bt := &batchTx{raw: tx, txID: statedbhelper.NewTx(app.transID)}
+
+		transaction, pubKey, err := app.parseTx(tx)
+		if err == nil {
+			bt.parsed, bt.transaction, bt.pubKey = true, transaction, pubKey
+			bt.lane = app.laneOf(bt.txID, transaction)
+		}
+		if bt.lane != "" {
+			lanes[bt.lane] = append(lanes[bt.lane], bt)
+		}
+		batch[i] = bt
+	}
+
+	// txs of a lane share cache of the same docker, they're invoked one by one
+	var wg sync.WaitGroup
+	for _, lane := range lanes {
+		wg.Add(1)
+		go func(lane []*batchTx) {
+			defer wg.Done()
+			for _, bt := range lane {
+				bt.result = app.invokeTx(bt.txID, bt.raw, bt.transaction, bt.pubKey, true)
+			}
+		}(lane)
+	}
+	wg.Wait()
+
+	finished := make([]int64, 0, len(batch))
+	for i, bt := range batch {
+		app.txID = bt.txID
+		if !bt.parsed {
+			responses[i] = app.reportFailure(bt.raw, types2.ErrDeliverTx, "tx parse failed")
+			app.publishTx(bt.raw, responses[i])
+			continue
+		}
+
+		if msg := app.checkBlockBudget(); msg != "" {
+			// budget is never given back in block, so all txs left are rejected
+			app.rollbackInvoked(batch[i:])
+			responses[i] = app.reportFailure(bt.raw, ErrBlockLimitExceeded, msg)
+			app.publishTx(bt.raw, responses[i])
+			continue
+		}
+
+		if bt.result != nil && statedbhelper.TxConflicts(app.transID, bt.txID, finished) {
+			app.logger.Debug("DeliverTx conflicts, invoke again", "index", i, "lane", bt.lane)
+			app.rollbackInvoked(laneOf(batch[i:], bt.lane))
+		}
+		if bt.result == nil {
+			if bt.lane == "" {
+				// tx without lane may invoke any docker, it must not see cache of txs after it
+				app.rollbackInvoked(batch[i+1:])
+			}
+			bt.result = app.invokeTx(bt.txID, bt.raw, bt.transaction, bt.pubKey, false)
+		}
+
+		responses[i], _ = app.finishDeliverTx(bt.result)
+		app.useBlockBudget(bt.result, responses[i])
+		app.publishTx(bt.raw, responses[i])
+		finished = append(finished, bt.txID)
+
+		// the following txs may have read stale docker cache
+		adp := app.contractInvoker()
+		if (bt.result.response != nil && adp.CleansDockerCache(bt.result.response.Tags)) || adp.CleansDockerCache(responses[i].Tags) {
+			app.rollbackInvoked(batch[i+1:])
+		}
+	}
+
+	return responses
+}
+
+// laneOf returns lane of tx, it's organization ID of contracts invoked by tx. BVM txs, txs of
+// genesis contract and txs invoking contracts of more than one organization have no lane.
+func (app *AppDeliver) laneOf(txID int64, transaction types2.Transaction) (lane string) {
+	if _, ok := app.scheduleHeightOf(transaction); ok {
+		return ""
+	}
+
+	genesisContract := std.GetGenesisContractAddr(app.chainID)
+	for _, message := range transaction.Messages {
+		if message.MethodID == 0 || message.MethodID == 0xFFFFFFFF || message.Contract == genesisContract {
+			return ""
+		}
+
+		var orgID string
+		if split := strings.Split(message.Contract, "."); len(split) == 2 {
+			orgID = split[0]
+		} else {
+			orgID = statedbhelper.GetOrgID(app.transID, txID, message.Contract)
+		}
+		if orgID == "" || (lane != "" && orgID != lane) {
+			return ""
+		}
+		lane = orgID
+	}
+
+	return
+}
+
+// rollbackInvoked rolls back invoked txs in reverse order, because docker drops cache of tx
+// only if it's on top of cache.
+func (app *AppDeliver) rollbackInvoked(txs []*batchTx) {
+	adp := app.contractInvoker()
+	for i := len(txs) - 1; i >= 0; i-- {
+		bt := txs[i]
+		if bt.result == nil {
+			continue
+		}
+
+		statedbhelper.RollbackTx(app.transID, bt.txID)
+		adp.RollbackTx(app.transID, bt.txID)
+		bt.result = nil
+	}
+}
+
+func laneOf(txs []*batchTx, lane string) []*batchTx {
+	laneTxs := make([]*batchTx, 0)
+	for _, bt := range txs {
+		if bt.lane == lane {
+			laneTxs = append(laneTxs, bt)
+		}
+	}
+	return laneTxs
+}
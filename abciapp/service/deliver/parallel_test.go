@@ -0,0 +1,129 @@
+package deliver
+
+import (
+	"container/list"
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/statedb"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	tx2 "github.com/bcbchain/bclib/tx/v2"
+	types2 "github.com/bcbchain/bclib/types"
+)
+
+// counterInvoker 模拟合约：每条消息把合约所属组织的计数器加一，合约名为 fail 时写入后返回失败
+type counterInvoker struct{}
+
+func (counterInvoker) InvokeSponsoredTx(blockHeader types.Header, transID, txID int64, sender, sponsor types2.Address, tx types2.Transaction,
+	publicKey types2.PubKey, txHash types2.Hash, blockHash types2.Hash) *types2.Response {
+	response := &types2.Response{Code: types2.CodeOK}
+	for _, message := range tx.Messages {
+		key := "/test/counter/" + strings.Split(message.Contract, ".")[0]
+		value, _ := statedbhelper.Get(transID, txID, key)
+		count, _ := strconv.Atoi(string(value))
+		count++
+		statedbhelper.Set(transID, txID, key, []byte(strconv.Itoa(count)))
+
+		response.Data += key + "=" + strconv.Itoa(count) + ";"
+		if strings.HasSuffix(message.Contract, ".fail") {
+			response.Code, response.Log = types2.ErrDeliverTx, "fail"
+			break
+		}
+	}
+	return response
+}
+
+func (counterInvoker) TakeInvocations(transID, txID int64) int64   { return 1 }
+func (counterInvoker) RollbackTx(transID, txID int64)              {}
+func (counterInvoker) CleansDockerCache(tags []common.KVPair) bool { return false }
+
+// 同一区块串行执行和并行执行，结果和状态根必须一致
+func TestDeliverTxsParallel(t *testing.T) {
+	softforks.TagToForkInfo = map[string]softforks.ForkInfo{
+		"fork-abci#2.2.2.paralleldeliver": {Tag: "fork-abci#2.2.2.paralleldeliver", EffectBlockHeight: 1},
+	}
+	defer func() { softforks.TagToForkInfo = nil }()
+	statedbhelper.SetChainIDOnce("local")
+	chainID := statedbhelper.GetChainID()
+	tx2.Init(chainID)
+
+	keys := make([]crypto.PrivKeyEd25519, 3)
+	for i := range keys {
+		keys[i] = crypto.GenPrivKeyEd25519()
+	}
+	signed := func(key int, nonce uint64, contracts ...string) []byte {
+		messages := make([]types2.Message, len(contracts))
+		for i, contract := range contracts {
+			messages[i] = types2.Message{Contract: contract, MethodID: 1}
+		}
+		payload := tx2.WrapPayload(nonce, 10000, "", messages...)
+		return []byte(tx2.WrapTx(payload, "0x"+hex.EncodeToString(keys[key][:])))
+	}
+	txs := [][]byte{
+		signed(0, 1, "orgA.counter"),
+		// 同一发送者的下一笔交易在另一个通道中执行，读到旧的 nonce，需要重新执行
+		signed(0, 2, "orgB.counter"),
+		// 与第一笔交易同一通道，读到旧的计数器，需要重新执行
+		signed(1, 1, "orgA.counter"),
+		signed(2, 1, "orgB.fail"),
+		signed(1, 2, "orgB.counter"),
+		// nonce 错误
+		signed(2, 5, "orgA.counter"),
+		[]byte("bad tx"),
+		// 跨组织的交易没有通道
+		signed(2, 2, "orgA.counter", "orgB.counter"),
+		signed(0, 3, "orgA.counter"),
+	}
+
+	deliver := func(parallel bool) ([]types.ResponseDeliverTx, []byte) {
+		statedbhelper.InitWithBackend(statedb.MemDBBackend, "tparallel"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+		defer statedbhelper.Close()
+
+		app := createAppDeliver()
+		app.chainID = chainID
+		app.hashList = list.New()
+		app.blockHeader = types.Header{ChainID: chainID, Height: 2}
+		app.invoker = counterInvoker{}
+		app.SetParallel(parallel)
+		app.transID, _ = statedbhelper.NewCommittableTransactionID()
+
+		responses := app.DeliverTxs(txs)
+		app.txID = statedbhelper.NewTx(app.transID)
+		statedbhelper.CommitTx(app.transID, app.txID)
+		stateRoot := statedbhelper.CalcStateRoot(app.transID)
+
+		hashes := make([]byte, 0)
+		for e := app.hashList.Front(); e != nil; e = e.Next() {
+			hashes = append(hashes, e.Value.([]byte)...)
+		}
+		statedbhelper.CommitBlock(app.transID)
+		return responses, append(stateRoot, hashes...)
+	}
+
+	serial, serialHash := deliver(false)
+	parallel, parallelHash := deliver(true)
+	if !reflect.DeepEqual(serial, parallel) {
+		t.Errorf("responses:\nserial   %v\nparallel %v", serial, parallel)
+	}
+	if !reflect.DeepEqual(serialHash, parallelHash) {
+		t.Error("app hash of parallel delivering is different")
+	}
+
+	codes := []uint32{types2.CodeOK, types2.CodeOK, types2.CodeOK, types2.ErrDeliverTx, types2.CodeOK, types2.ErrDeliverTx, types2.ErrDeliverTx, types2.CodeOK, types2.CodeOK}
+	for i, res := range serial {
+		if res.Code != codes[i] {
+			t.Errorf("code of tx %d: %d %s", i, res.Code, res.Log)
+		}
+	}
+	if serial[8].Data != "/test/counter/orgA=4;" {
+		t.Errorf("data of the last tx: %s", serial[8].Data)
+	}
+}
@@ -2,7 +2,10 @@ package deliver
 
 import (
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/common/txindex"
+	"github.com/bcbchain/bcbchain/smcbuilder"
 	"os"
+	"path/filepath"
 )
 
 func (app *AppDeliver) rollback() error {
@@ -10,10 +13,26 @@ func (app *AppDeliver) rollback() error {
 
 	home := os.Getenv("HOME")
 
-	if err := os.RemoveAll(home + "/.build/bin"); err != nil {
-		return err
+	// only remove binaries built for code of the rolled back block, binaries left are useless but
+	// harmless, so state db is rolled back even if they can't be found or removed
+	dirs, err := smcbuilder.IntroducedBinDirs(filepath.Join(home, ".build"), statedbhelper.LastTransactionID()-1)
+	if err != nil {
+		app.logger.Error("ROLLBACK find contract binaries failed", "error", err)
 	}
 
 	statedbhelper.RollbackStateDB(1)
+
+	// txs of the rolled back block are removed from index, or it can't index the block delivered again
+	height := statedbhelper.GetWorldAppState(0, 0).BlockHeight
+	if err := txindex.Rollback(height); err != nil {
+		app.logger.Error("ROLLBACK tx index failed", "height", height, "error", err)
+	}
+
+	for _, dir := range dirs {
+		app.logger.Info("ROLLBACK remove contract binary", "dir", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			app.logger.Error("ROLLBACK remove contract binary failed", "dir", dir, "error", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,97 @@
+package deliver
+
+import (
+	"encoding/hex"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/smcrunctl/adapter"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	types2 "github.com/bcbchain/bclib/types"
+)
+
+const scheduleCallReceiptName = "scheduleCall"
+
+//scheduleHeightOf returns target height of tx if it's a scheduled call
+func (app *AppDeliver) scheduleHeightOf(transaction types2.Transaction) (int64, bool) {
+	if !softforks.IsActive(softforks.ScheduledCall, app.blockHeader.Height) {
+		return 0, false
+	}
+	return statedbhelper.ScheduleHeightOf(transaction.Note)
+}
+
+//scheduleTx saves tx as a scheduled call instead of invoking it, nonce of tx is set before.
+func (app *AppDeliver) scheduleTx(txID int64, tx []byte, transaction types2.Transaction, sender types2.Address, height int64) *types2.Response {
+	call := statedbhelper.NewScheduledCall(string(tx), sender, height)
+	if err := statedbhelper.ScheduleCall(app.transID, txID, call, transaction.GasLimit, app.blockHeader.Height); err != nil {
+		return &types2.Response{Code: types2.ErrDeliverTx, Log: err.Error()}
+	}
+	app.logger.Debug("schedule call", "height", height, "callHash", call.CallHash)
+
+	return &types2.Response{
+		Code: types2.CodeOK,
+		Log:  "schedule call success",
+		Tags: []common.KVPair{{
+			Key:   []byte("/0/" + scheduleCallReceiptName),
+			Value: emitScheduleCallReceipt(call),
+		}},
+	}
+}
+
+//runScheduledCalls runs calls scheduled at height of block, prepaid fees are given back in a tx,
+//then every call is invoked and finished as a delivered tx. Calls use budget of block like txs,
+//calls after it's used up are rejected.
+func (app *AppDeliver) runScheduledCalls() (txBuffer map[string][]byte) {
+	height := app.blockHeader.Height
+	if !softforks.IsActive(softforks.ScheduledCall, height) {
+		return
+	}
+
+	calls := statedbhelper.GetScheduledCalls(app.transID, app.txID, height)
+	if len(calls) == 0 {
+		return
+	}
+	app.logger.Info("run scheduled calls", "height", height, "count", len(calls))
+
+	app.txID = statedbhelper.NewTx(app.transID)
+	statedbhelper.SetScheduledCalls(app.transID, app.txID, height, nil)
+	for _, call := range calls {
+		balance := statedbhelper.BalanceOf(app.transID, app.txID, call.Sender, call.Token)
+		statedbhelper.SetBalance(app.transID, app.txID, call.Sender, call.Token, balance.Add(call.Prepaid))
+	}
+	stateTx, buffer := statedbhelper.CommitTx(app.transID, app.txID)
+	app.calcDeliverHash(nil, nil, stateTx)
+	txBuffer = combineBuffer(buffer, txBuffer)
+
+	for _, call := range calls {
+		app.txID = statedbhelper.NewTx(app.transID)
+		tx := []byte(call.Tx)
+		callHash, _ := hex.DecodeString(call.CallHash)
+
+		transaction, pubKey, err := app.parseTx(tx)
+		if err != nil {
+			app.publishTxWithHash(tx, callHash, app.reportFailure(tx, types2.ErrDeliverTx, "tx parse failed"))
+			continue
+		}
+
+		if msg := app.checkBlockBudget(); msg != "" {
+			app.publishTxWithHash(tx, callHash, app.reportFailure(tx, ErrBlockLimitExceeded, msg))
+			continue
+		}
+
+		adp := adapter.GetInstance()
+		result := &invokeResult{tx: tx, transaction: transaction}
+		result.response = adp.InvokeTx(app.blockHeader, app.transID, app.txID, call.Sender, transaction, pubKey.Bytes(), callHash, app.blockHash)
+		result.invocations = adp.TakeInvocations(app.transID, app.txID)
+		res, buffer := app.finishDeliverTx(result)
+		app.useBlockBudget(result, res)
+		app.publishTxWithHash(tx, callHash, res)
+		txBuffer = combineBuffer(buffer, txBuffer)
+	}
+
+	return
+}
+
+func emitScheduleCallReceipt(call *statedbhelper.ScheduledCall) []byte {
+	return emitReceipt(scheduleCallReceiptName, call)
+}
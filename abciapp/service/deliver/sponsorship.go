@@ -0,0 +1,57 @@
+package deliver
+
+import (
+	"fmt"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+)
+
+const sponsorFeeReceiptName = "sponsorFee"
+
+//splitSponsoredTx splits sponsorship from tx if sponsored tx is enabled
+func (app *AppDeliver) splitSponsoredTx(tx []byte) (string, *statedbhelper.Sponsorship, error) {
+	if !softforks.IsActive(softforks.Sponsorship, app.blockHeader.Height) {
+		return string(tx), nil, nil
+	}
+	return statedbhelper.SplitSponsoredTx(string(tx))
+}
+
+//sponsorshipOf returns sponsorship of tx after checking it's bound by note signed by sender,
+//it's nil if tx isn't sponsored.
+func (app *AppDeliver) sponsorshipOf(tx []byte, note string) (*statedbhelper.Sponsorship, error) {
+	if !softforks.IsActive(softforks.Sponsorship, app.blockHeader.Height) {
+		return nil, nil
+	}
+	_, sp, err := statedbhelper.SplitSponsoredTx(string(tx))
+	if err != nil {
+		return nil, err
+	}
+	return sp, statedbhelper.VerifySponsorNote(note, sp)
+}
+
+//chargeSponsor adds fee paid by sponsor to spent of sponsorship, and emits sponsorFee receipt
+func (app *AppDeliver) chargeSponsor(result *invokeResult) []common.KVPair {
+	if result.sponsorship == nil {
+		return nil
+	}
+
+	fees, _, _ := gatherFeesByFromAddr(result.response.Tags, true)
+	id := result.sponsorship.ID(app.chainID)
+	spent := statedbhelper.SponsorSpent{
+		ID:      id,
+		Sponsor: result.sponsor,
+		Sender:  result.sponsorship.Sender,
+		Fee:     fees[result.sponsor].Value,
+		Cap:     result.sponsorship.Cap,
+	}
+	spent.Spent = statedbhelper.GetSponsorSpent(app.transID, app.txID, id) + spent.Fee
+	statedbhelper.SetSponsorSpent(app.transID, app.txID, id, spent.Spent)
+	app.logger.Debug("sponsor pays fee", "sponsor", spent.Sponsor, "fee", spent.Fee, "spent", spent.Spent)
+
+	return []common.KVPair{{
+		Key:   []byte(fmt.Sprintf("/%d/0/%s", len(result.transaction.Messages), sponsorFeeReceiptName)),
+		Value: emitReceipt(sponsorFeeReceiptName, spent),
+	}}
+}
@@ -0,0 +1,89 @@
+package deliver
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+func TestSponsorship(t *testing.T) {
+	chainID := "local"
+	privKey := crypto.GenPrivKeyEd25519()
+	pubKey := privKey.PubKey().(crypto.PubKeyEd25519)
+
+	sp := statedbhelper.Sponsorship{
+		Sponsor: hex.EncodeToString(pubKey[:]),
+		Sender:  "localSender",
+		Cap:     1000000,
+	}
+	sig := privKey.Sign(sp.SignBytes(chainID)).(crypto.SignatureEd25519)
+	sp.Signature = hex.EncodeToString(sig[:])
+
+	part, note := statedbhelper.EncodeSponsorship(&sp)
+	tx := "localtx.v2.payload.<1>.signature"
+	splitTx, got, err := statedbhelper.SplitSponsoredTx(tx + "." + part)
+	if err != nil || splitTx != tx || got == nil {
+		t.Fatalf("split: %s %v %v", splitTx, got, err)
+	}
+	if err := statedbhelper.VerifySponsorNote(note, got); err != nil {
+		t.Errorf("verify note: %v", err)
+	}
+
+	// 去掉赞助部分的交易，其签名的备注仍声明了赞助，应被拒绝
+	if err := statedbhelper.VerifySponsorNote(note, nil); err == nil {
+		t.Error("stripped sponsorship is accepted")
+	}
+	if err := statedbhelper.VerifySponsorNote("", nil); err != nil {
+		t.Errorf("tx without sponsorship: %v", err)
+	}
+
+	// 替换为另一份赞助（即使同一赞助者签名）也应被拒绝
+	other := sp
+	other.Cap = 2000000
+	otherSig := privKey.Sign(other.SignBytes(chainID)).(crypto.SignatureEd25519)
+	other.Signature = hex.EncodeToString(otherSig[:])
+	otherPart, _ := statedbhelper.EncodeSponsorship(&other)
+	_, swapped, err := statedbhelper.SplitSponsoredTx(tx + "." + otherPart)
+	if err != nil {
+		t.Fatalf("split swapped: %v", err)
+	}
+	if _, err := swapped.SponsorAddress(chainID); err != nil {
+		t.Fatalf("swapped sponsorship: %v", err)
+	}
+	if err := statedbhelper.VerifySponsorNote(note, swapped); err == nil {
+		t.Error("swapped sponsorship is accepted")
+	}
+
+	// 仅改变编码（如 JSON 字段顺序）同样改变哈希，同一签名交易只有一种有效编码
+	bz, _ := jsoniter.Marshal(map[string]interface{}{"cap": sp.Cap, "sender": sp.Sender, "sponsor": sp.Sponsor, "signature": sp.Signature})
+	_, reencoded, err := statedbhelper.SplitSponsoredTx(tx + "." + base64.StdEncoding.EncodeToString(bz))
+	if err != nil {
+		t.Fatalf("split re-encoded: %v", err)
+	}
+	if err := statedbhelper.VerifySponsorNote(note, reencoded); err == nil {
+		t.Error("re-encoded sponsorship is accepted")
+	}
+
+	// 未赞助的交易原样返回
+	if s, none, err := statedbhelper.SplitSponsoredTx(tx); err != nil || s != tx || none != nil {
+		t.Errorf("split tx without sponsorship: %s %v %v", s, none, err)
+	}
+
+	sponsor, err := got.SponsorAddress(chainID)
+	if err != nil || sponsor != pubKey.Address(chainID) {
+		t.Errorf("sponsor: %s %v", sponsor, err)
+	}
+	if got.ID(chainID) != sp.ID(chainID) {
+		t.Errorf("id: %s", got.ID(chainID))
+	}
+
+	// 篡改上限后签名校验失败
+	got.Cap++
+	if _, err := got.SponsorAddress(chainID); err == nil {
+		t.Error("tampered sponsorship is verified")
+	}
+}
@@ -0,0 +1,202 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bcbchain/bcbchain/hyperledger/burrow/event"
+	"github.com/bcbchain/bcbchain/hyperledger/burrow/event/query"
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// types of events, they're values of tag event.EventTypeKey
+const (
+	TypeBeginBlock = "BeginBlock"
+	TypeTx         = "Tx"
+	TypeReceipt    = "Receipt"
+	TypeEndBlock   = "EndBlock"
+	TypeCommit     = "Commit"
+)
+
+// tags of events besides tags in hyperledger/burrow/event/convention.go
+const (
+	CodeKey        = "Code"
+	ReceiptNameKey = "ReceiptName"
+)
+
+// tags whose values are numbers, values of other tags are strings
+var numericTags = map[string]bool{event.HeightKey: true, event.IndexKey: true, CodeKey: true}
+
+//Event is an event published on the bus, subscribers filter events by their tags with
+//burrow query language, for example "EventType = 'Receipt' AND ReceiptName = 'std::transfer'".
+type Event interface {
+	EventType() string
+	tags() query.TagMap
+}
+
+//BeginBlock is published when a block begins
+type BeginBlock struct {
+	Height          int64           `json:"height"`
+	Time            int64           `json:"time"`
+	Hash            common.HexBytes `json:"hash"`
+	ProposerAddress string          `json:"proposerAddress"`
+	Code            uint32          `json:"code"`
+	Log             string          `json:"log,omitempty"`
+}
+
+//Tx is published when a tx is delivered, Index is index of tx in block
+type Tx struct {
+	Height  int64           `json:"height"`
+	Index   int             `json:"index"`
+	TxHash  common.HexBytes `json:"txHash"`
+	Code    uint32          `json:"code"`
+	Log     string          `json:"log"`
+	Data    string          `json:"data,omitempty"`
+	GasUsed uint64          `json:"gasUsed"`
+	Fee     uint64          `json:"fee"`
+}
+
+//Receipt is published for every receipt of a delivered tx, after event Tx of it
+type Receipt struct {
+	Height int64           `json:"height"`
+	Index  int             `json:"index"` // index of tx in block
+	TxHash common.HexBytes `json:"txHash"`
+	Key    string          `json:"key"`
+	std.Receipt
+}
+
+//EndBlock is published when a block ends
+type EndBlock struct {
+	Height           int64            `json:"height"`
+	RewardAmount     int64            `json:"rewardAmount"`
+	ValidatorUpdates []abci.Validator `json:"validatorUpdates,omitempty"`
+	SideChainGenesis int              `json:"sideChainGenesis"` // count of side chain genesis packed in block
+}
+
+//Commit is published when a block is committed
+type Commit struct {
+	Height  int64           `json:"height"`
+	AppHash common.HexBytes `json:"appHash"`
+}
+
+func (*BeginBlock) EventType() string { return TypeBeginBlock }
+func (*Tx) EventType() string         { return TypeTx }
+func (*Receipt) EventType() string    { return TypeReceipt }
+func (*EndBlock) EventType() string   { return TypeEndBlock }
+func (*Commit) EventType() string     { return TypeCommit }
+
+func (e *BeginBlock) tags() query.TagMap {
+	return query.TagMap{event.HeightKey: e.Height, CodeKey: e.Code}
+}
+
+func (e *Tx) tags() query.TagMap {
+	return query.TagMap{event.HeightKey: e.Height, event.IndexKey: e.Index, event.TxHashKey: e.TxHash.String(), CodeKey: e.Code}
+}
+
+func (e *Receipt) tags() query.TagMap {
+	return query.TagMap{
+		event.HeightKey:  e.Height,
+		event.IndexKey:   e.Index,
+		event.TxHashKey:  e.TxHash.String(),
+		event.AddressKey: e.ContractAddr,
+		ReceiptNameKey:   e.Name,
+	}
+}
+
+func (e *EndBlock) tags() query.TagMap {
+	return query.TagMap{event.HeightKey: e.Height}
+}
+
+func (e *Commit) tags() query.TagMap {
+	return query.TagMap{event.HeightKey: e.Height}
+}
+
+var (
+	emitter     *event.Emitter
+	emitterOnce sync.Once
+)
+
+func getEmitter() *event.Emitter {
+	emitterOnce.Do(func() {
+		emitter = event.NewEmitter()
+	})
+	return emitter
+}
+
+//Publish publishes event to subscribers whose query matches it, a subscriber whose buffer
+//is full misses the event, so publishing never blocks DeliverTx.
+func Publish(e Event) {
+	tags := e.tags()
+	tags[event.EventTypeKey] = e.EventType()
+
+	getEmitter().Publish(context.Background(), e, tags)
+}
+
+//PublishTx publishes event of delivered tx and events of its receipts
+func PublishTx(height int64, index int, res abci.ResponseDeliverTx) {
+	Publish(&Tx{
+		Height:  height,
+		Index:   index,
+		TxHash:  res.TxHash,
+		Code:    res.Code,
+		Log:     res.Log,
+		Data:    res.Data,
+		GasUsed: res.GasUsed,
+		Fee:     res.Fee,
+	})
+
+	for _, tag := range res.Tags {
+		var receipt std.Receipt
+		if err := jsoniter.Unmarshal(tag.Value, &receipt); err != nil {
+			continue
+		}
+
+		Publish(&Receipt{
+			Height:  height,
+			Index:   index,
+			TxHash:  res.TxHash,
+			Key:     strings.TrimSpace(string(tag.Key)),
+			Receipt: receipt,
+		})
+	}
+}
+
+//Subscribe subscribes events matching queryString with buffer of bufferSize events
+func Subscribe(subscriber, queryString string, bufferSize int) (<-chan interface{}, error) {
+	qry, err := query.New(queryString)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConditions(qry.Conditions()); err != nil {
+		return nil, err
+	}
+
+	return getEmitter().Subscribe(context.Background(), subscriber, qry, bufferSize)
+}
+
+// checkConditions checks operands of conditions against types of tags, burrow query panics
+// when it matches a tag with an operand it can't be compared to, in the publishing goroutine.
+func checkConditions(conditions []query.Condition) error {
+	for _, c := range conditions {
+		switch c.Operand.(type) {
+		case string:
+		case int64, float64:
+			if !numericTags[c.Tag] {
+				return fmt.Errorf("tag %s isn't a number, its operand must be quoted", c.Tag)
+			}
+		default:
+			return fmt.Errorf("tag %s can't be compared to %v", c.Tag, c.Operand)
+		}
+	}
+	return nil
+}
+
+//UnsubscribeAll cancels all subscriptions of subscriber
+func UnsubscribeAll(subscriber string) error {
+	return getEmitter().UnsubscribeAll(context.Background(), subscriber)
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+func TestPublishTx(t *testing.T) {
+	// 只订阅转账收据
+	id, err := NewSubscription("EventType = 'Receipt' AND ReceiptName = 'std::transfer'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Unsubscribe(id)
+
+	transfer, _ := jsoniter.Marshal(std.Receipt{Name: "std::transfer", ContractAddr: "bcbToken"})
+	fee, _ := jsoniter.Marshal(std.Receipt{Name: "std::fee", ContractAddr: "bcbToken"})
+	PublishTx(10, 2, abci.ResponseDeliverTx{
+		TxHash: []byte{0x01},
+		Tags: []common.KVPair{
+			{Key: []byte("/0/std::transfer"), Value: transfer},
+			{Key: []byte("/1/std::fee"), Value: fee},
+		},
+	})
+
+	messages, err := Poll(id, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Type != TypeReceipt {
+		t.Fatalf("poll: %v", messages)
+	}
+	receipt := messages[0].Data.(*Receipt)
+	if receipt.Height != 10 || receipt.Index != 2 || receipt.Name != "std::transfer" || receipt.Key != "/0/std::transfer" {
+		t.Errorf("receipt: %v", receipt)
+	}
+
+	// 没有新事件时等待超时返回空
+	messages, err = Poll(id, 10*time.Millisecond)
+	if err != nil || len(messages) != 0 {
+		t.Errorf("poll again: %v %v", messages, err)
+	}
+}
+
+func TestSubscribeMismatchedQuery(t *testing.T) {
+	// EventType 是字符串，和数字比较会在发布时 panic，订阅时就要拒绝
+	if _, err := NewSubscription("EventType > 5"); err == nil {
+		t.Fatal("subscribe with number operand of string tag")
+	}
+	if _, err := NewSubscription("Height > 2019-01-01"); err == nil {
+		t.Fatal("subscribe with date operand")
+	}
+
+	id, err := NewSubscription("Height > 5 AND Code = '0'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Unsubscribe(id)
+
+	Publish(&Commit{Height: 6})
+	messages, err := Poll(id, time.Second)
+	if err != nil || len(messages) != 0 {
+		t.Errorf("poll: %v %v", messages, err)
+	}
+	Publish(&BeginBlock{Height: 7})
+	messages, err = Poll(id, time.Second)
+	if err != nil || len(messages) != 1 || messages[0].Type != TypeBeginBlock {
+		t.Errorf("poll: %v %v", messages, err)
+	}
+}
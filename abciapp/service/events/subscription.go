@@ -0,0 +1,144 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bcbchain/bcbchain/hyperledger/burrow/event"
+)
+
+const (
+	subscriptionBuffer  = 1024        // events buffered for a subscription between polls
+	subscriptionExpired = time.Minute // subscription which isn't polled in it is cancelled
+	maxPollWait         = 30 * time.Second
+	maxPollEvents       = 256
+)
+
+//Message is an event with its type returned to remote subscribers
+type Message struct {
+	Type string `json:"type"`
+	Data Event  `json:"data"`
+}
+
+type subscription struct {
+	ch       <-chan interface{}
+	lastPoll time.Time
+	polling  bool
+}
+
+var (
+	subsMtx sync.Mutex
+	subs    = make(map[string]*subscription)
+)
+
+//NewSubscription subscribes events matching queryString for a remote subscriber, which
+//polls events with the returned ID.
+func NewSubscription(queryString string) (string, error) {
+	expireSubscriptions()
+
+	id := event.GenSubID()
+	ch, err := Subscribe(id, queryString, subscriptionBuffer)
+	if err != nil {
+		return "", err
+	}
+
+	subsMtx.Lock()
+	subs[id] = &subscription{ch: ch, lastPoll: time.Now()}
+	subsMtx.Unlock()
+	return id, nil
+}
+
+//Poll returns events of subscription, it waits at most wait for the first event.
+func Poll(id string, wait time.Duration) ([]Message, error) {
+	expireSubscriptions()
+
+	subsMtx.Lock()
+	sub, ok := subs[id]
+	if ok {
+		if sub.polling {
+			subsMtx.Unlock()
+			return nil, errors.New("subscription is being polled")
+		}
+		sub.polling = true
+	}
+	subsMtx.Unlock()
+	if !ok {
+		return nil, errors.New("subscription does not exist")
+	}
+
+	defer func() {
+		subsMtx.Lock()
+		sub.polling = false
+		sub.lastPoll = time.Now()
+		subsMtx.Unlock()
+	}()
+
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	messages := make([]Message, 0)
+	select {
+	case msg, ok := <-sub.ch:
+		if !ok {
+			return nil, errors.New("subscription is closed")
+		}
+		messages = appendMessage(messages, msg)
+	case <-timer.C:
+		return messages, nil
+	}
+
+	for len(messages) < maxPollEvents {
+		select {
+		case msg, ok := <-sub.ch:
+			if !ok {
+				return messages, nil
+			}
+			messages = appendMessage(messages, msg)
+		default:
+			return messages, nil
+		}
+	}
+	return messages, nil
+}
+
+//Unsubscribe cancels subscription of remote subscriber
+func Unsubscribe(id string) error {
+	subsMtx.Lock()
+	_, ok := subs[id]
+	delete(subs, id)
+	subsMtx.Unlock()
+	if !ok {
+		return errors.New("subscription does not exist")
+	}
+
+	return UnsubscribeAll(id)
+}
+
+// expireSubscriptions cancels subscriptions of remote subscribers which are gone.
+func expireSubscriptions() {
+	expired := make([]string, 0)
+
+	subsMtx.Lock()
+	for id, sub := range subs {
+		if !sub.polling && time.Since(sub.lastPoll) > subscriptionExpired {
+			expired = append(expired, id)
+			delete(subs, id)
+		}
+	}
+	subsMtx.Unlock()
+
+	for _, id := range expired {
+		UnsubscribeAll(id)
+	}
+}
+
+func appendMessage(messages []Message, msg interface{}) []Message {
+	if e, ok := msg.(Event); ok {
+		messages = append(messages, Message{Type: e.EventType(), Data: e})
+	}
+	return messages
+}
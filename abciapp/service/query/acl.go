@@ -0,0 +1,142 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	bctypes "github.com/bcbchain/bclib/types"
+)
+
+// defaultQueryRules keeps the behaviour before query rules when config doesn't set rules,
+// signed query of account must be signed by the account.
+var defaultQueryRules = []statedbhelper.QueryRule{
+	{Prefix: "/account", Access: statedbhelper.QuerySigner},
+}
+
+// SetQueryRules sets query rules loaded from config.
+func (conn *QueryConnection) SetQueryRules(rules []statedbhelper.QueryRule) {
+	conn.queryRules = rules
+}
+
+func (conn *QueryConnection) rules() []statedbhelper.QueryRule {
+	if len(conn.queryRules) != 0 {
+		return conn.queryRules
+	}
+	return defaultQueryRules
+}
+
+// checkAccess returns error if signer can't query key, signer is empty if query isn't signed.
+func (conn *QueryConnection) checkAccess(key string, signer bctypes.Address) *bctypes.BcError {
+	rule, ok := governingRule(conn.rules(), key)
+	if !ok || allows(rule, key, signer) {
+		return nil
+	}
+	return conn.deny(key, signer, rule)
+}
+
+// visibleChanges drops changes of keys which unsigned query can't query.
+func (conn *QueryConnection) visibleChanges(changes []StateChange) []StateChange {
+	rules := conn.rules()
+	visible := changes[:0]
+	for _, change := range changes {
+		if rule, ok := governingRule(rules, change.Key); !ok || allows(rule, change.Key, "") {
+			visible = append(visible, change)
+		}
+	}
+	return visible
+}
+
+// checkPrefixAccess returns error if signer can't query any key with prefix, both the rule
+// governing prefix and all rules of keys under prefix must allow it.
+func (conn *QueryConnection) checkPrefixAccess(prefix string, signer bctypes.Address) *bctypes.BcError {
+	rules := conn.rules()
+	if rule, ok := governingRule(rules, prefix); ok && !allows(rule, prefix, signer) {
+		return conn.deny(prefix, signer, rule)
+	}
+
+	for _, rule := range rules {
+		if !matchPrefix(rule.Prefix, prefix) && mayMatchUnder(rule.Prefix, prefix) && !allows(rule, prefix, signer) {
+			return conn.deny(prefix, signer, rule)
+		}
+	}
+	return nil
+}
+
+func (conn *QueryConnection) deny(key string, signer bctypes.Address, rule statedbhelper.QueryRule) *bctypes.BcError {
+	conn.logger.Warn("query is denied", "key", key, "signer", signer, "rule", rule.Prefix, "access", rule.Access)
+	return &bctypes.BcError{ErrorCode: bctypes.ErrNoAuthorization}
+}
+
+// governingRule returns the rule with the longest prefix which matches key.
+func governingRule(rules []statedbhelper.QueryRule, key string) (rule statedbhelper.QueryRule, ok bool) {
+	for _, r := range rules {
+		if matchPrefix(r.Prefix, key) && (!ok || len(r.Prefix) > len(rule.Prefix)) {
+			rule, ok = r, true
+		}
+	}
+	return
+}
+
+// allows returns whether rule allows signer to query key, unknown access denies all.
+func allows(rule statedbhelper.QueryRule, key string, signer bctypes.Address) bool {
+	switch rule.Access {
+	case statedbhelper.QueryPublic:
+		return true
+	case statedbhelper.QuerySigner:
+		return signer == "" || hasSegment(key, signer)
+	case statedbhelper.QueryOwner:
+		return signer != "" && hasSegment(key, signer)
+	case statedbhelper.QueryOrg:
+		if signer == "" {
+			return false
+		}
+		for _, seg := range strings.Split(key, "/") {
+			if seg != "" && statedbhelper.IsOrgMember(0, 0, seg, signer) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasSegment(key, seg string) bool {
+	for _, s := range strings.Split(key, "/") {
+		if s == seg {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix returns whether key starts with pattern, a "*" segment of pattern matches any
+// segment and the last segment of pattern matches the beginning of segment of key.
+func matchPrefix(pattern, key string) bool {
+	ps, ks := strings.Split(pattern, "/"), strings.Split(key, "/")
+	if len(ks) < len(ps) {
+		return false
+	}
+
+	last := len(ps) - 1
+	for i := 0; i < last; i++ {
+		if ps[i] != "*" && ps[i] != ks[i] {
+			return false
+		}
+	}
+	return ps[last] == "*" || strings.HasPrefix(ks[last], ps[last])
+}
+
+// mayMatchUnder returns whether pattern may match a key which starts with prefix.
+func mayMatchUnder(pattern, prefix string) bool {
+	ps, qs := strings.Split(pattern, "/"), strings.Split(prefix, "/")
+	if len(ps) < len(qs) {
+		return matchPrefix(pattern, prefix)
+	}
+
+	last := len(qs) - 1
+	for i := 0; i < last; i++ {
+		if ps[i] != "*" && ps[i] != qs[i] {
+			return false
+		}
+	}
+	return ps[last] == "*" || strings.HasPrefix(ps[last], qs[last]) || strings.HasPrefix(qs[last], ps[last])
+}
@@ -0,0 +1,385 @@
+package query
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/bcbchain/bcbchain/burrow"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/hyperledger/burrow/abi"
+	crypto2 "github.com/bcbchain/bcbchain/hyperledger/burrow/crypto"
+	"github.com/bcbchain/bclib/algorithm"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	log2 "github.com/bcbchain/bclib/tendermint/tmlibs/log"
+	bctypes "github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/bclib/wal"
+)
+
+const bvmViewPath = "/bvm/view"
+
+// error codes of bvm view, failures of execution keep codes of BVM
+const (
+	ErrViewRequest  = bctypes.ErrCodeBVMInvoke + 10 + iota // request is malformed
+	ErrViewContract                                        // contract or its ABI doesn't exist
+	ErrViewMethod                                          // method doesn't exist in ABI
+	ErrViewArgs                                            // args don't match inputs of method
+	ErrViewHeight                                          // state at height can't be read
+)
+
+// viewGasLimit is gas limit of a view call
+const viewGasLimit = 100000
+
+// ViewRequest is data of query "/bvm/view". Input is ABI encoded input in hex including method ID,
+// if it's empty, Args in JSON are encoded by inputs of Method in ABI of contract. Numbers can be
+// given as JSON numbers or decimal/hex strings, bytes and fixed bytes as hex strings, tuples as
+// arrays or objects keyed by names of components.
+type ViewRequest struct {
+	Contract bctypes.Address `json:"contract"`
+	Method   string          `json:"method,omitempty"`
+	Args     []interface{}   `json:"args,omitempty"`
+	Input    string          `json:"input,omitempty"`
+	Height   int64           `json:"height,omitempty"` // 0 means the last height
+	Caller   bctypes.Address `json:"caller,omitempty"` // empty means an address without any asset
+}
+
+// ViewResult is value of query "/bvm/view", the method is run with header of the block at Height
+// on a rollback transaction, changes made by it are discarded.
+type ViewResult struct {
+	Method  string          `json:"method"`
+	Outputs json.RawMessage `json:"outputs"` // outputs decoded by ABI of contract
+	Height  int64           `json:"height"`
+}
+
+func (conn *QueryConnection) bvmView(data []byte) types.ResponseQuery {
+	var req ViewRequest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ResponseQuery{Code: ErrViewRequest, Log: err.Error()}
+	}
+
+	result, code, log := runBvmView(req, conn.logger)
+	if result == nil {
+		return types.ResponseQuery{Code: code, Log: log}
+	}
+
+	value, err := json.Marshal(result)
+	if err != nil {
+		conn.logger.Fatal("marshal view result failed ", "error", err)
+		panic(err)
+	}
+	return types.ResponseQuery{
+		Code:   code,
+		Key:    []byte(bvmViewPath),
+		Value:  value,
+		Height: result.Height,
+	}
+}
+
+// BvmViewKey calls method of contract by key "/bvm/view/<contract>/<method>(<arg1>,<arg2>)",
+// args can't contain ',', use query "/bvm/view" with ViewRequest instead.
+func BvmViewKey(key string, log log2.Logger) (resQuery types.ResponseQuery) {
+	keys := strings.Split(key, "/")
+	if len(keys) != 5 {
+		return types.ResponseQuery{Code: bctypes.ErrPath, Log: "invalid bvm view path"}
+	}
+
+	req := ViewRequest{Contract: keys[3], Method: keys[4]}
+	if i := strings.Index(keys[4], "("); i > 0 && strings.HasSuffix(keys[4], ")") {
+		req.Method = keys[4][:i]
+		if params := keys[4][i+1 : len(keys[4])-1]; params != "" {
+			for _, p := range strings.Split(params, ",") {
+				req.Args = append(req.Args, p)
+			}
+		}
+	}
+
+	result, code, logStr := runBvmView(req, log)
+	if result == nil {
+		return types.ResponseQuery{Code: code, Log: logStr}
+	}
+	return types.ResponseQuery{
+		Code:   code,
+		Key:    []byte(key),
+		Value:  result.Outputs,
+		Height: result.Height,
+	}
+}
+
+// runBvmView calls method on a rollback transaction which reads state at height of request.
+func runBvmView(req ViewRequest, log log2.Logger) (*ViewResult, uint32, string) {
+	chainID := statedbhelper.GetChainID()
+
+	contract := burrow.GetContractInfo(req.Contract)
+	if contract == nil {
+		return nil, ErrViewContract, fmt.Sprintf("contract %s doesn't exist", req.Contract)
+	}
+	contractABI, err := abi.JSON(strings.NewReader(contract.BvmAbi))
+	if err != nil {
+		return nil, ErrViewContract, "invalid ABI of contract: " + err.Error()
+	}
+
+	method, input, code, err := viewInput(contractABI, req)
+	if err != nil {
+		return nil, code, err.Error()
+	}
+
+	caller, pubKey := req.Caller, []byte(nil)
+	if caller == "" {
+		acct := &wal.Account{PrivateKey: crypto.GenPrivKeyEd25519FromSecret([]byte("0"))}
+		caller, pubKey = acct.Address(chainID), acct.PubKey().Bytes()
+	} else if err := algorithm.CheckAddress(chainID, caller); err != nil {
+		return nil, ErrViewRequest, "invalid caller: " + err.Error()
+	}
+
+	var transID int64
+	var appState *types.AppState
+	if req.Height == 0 {
+		transID, _ = statedbhelper.NewRollbackTransactionID()
+		appState = statedbhelper.GetWorldAppState(0, 0)
+	} else if transID, appState, err = statedbhelper.NewRollbackTransactionIDAtHeight(req.Height); err != nil {
+		return nil, ErrViewHeight, err.Error()
+	}
+	defer statedbhelper.RollbackBlock(transID)
+	txID := statedbhelper.NewTx(transID)
+
+	transaction := bctypes.Transaction{
+		GasLimit: viewGasLimit,
+		Messages: PrepareMessages(req.Contract, "", 0, nil, input, nil, false),
+	}
+	res := burrow.GetInstance(log).InvokeTxEx(appState.BeginBlock.Header, appState.BeginBlock.Hash, transID, txID, caller, transaction, pubKey)
+	if err := statedbhelper.TransactionErr(transID); err != nil {
+		// state at height is pruned while it's read
+		return nil, ErrViewHeight, err.Error()
+	}
+	if res.Code != bctypes.CodeOK && res.Code != bctypes.CodeBVMQueryOK {
+		log.Debug("bvm view failed", "contract", req.Contract, "method", method.Name, "code", res.Code, "log", res.Log)
+		return nil, res.Code, res.Log
+	}
+
+	outputs := json.RawMessage(res.Data)
+	if len(outputs) == 0 {
+		outputs = json.RawMessage("[]")
+	}
+	return &ViewResult{Method: method.Sig(), Outputs: outputs, Height: appState.BlockHeight}, res.Code, res.Log
+}
+
+// viewInput returns method and ABI encoded input of request.
+func viewInput(contractABI abi.ABI, req ViewRequest) (*abi.Method, []byte, uint32, error) {
+	if req.Input != "" {
+		input, err := hex.DecodeString(strings.TrimPrefix(req.Input, "0x"))
+		if err != nil {
+			return nil, nil, ErrViewRequest, fmt.Errorf("invalid input: %v", err)
+		}
+		if len(input) < 4 {
+			return nil, nil, ErrViewMethod, fmt.Errorf("input has no method ID")
+		}
+		method, err := contractABI.MethodById(input[:4])
+		if err != nil {
+			return nil, nil, ErrViewMethod, err
+		}
+		return method, input, bctypes.CodeOK, nil
+	}
+
+	method, ok := contractABI.Methods[req.Method]
+	if !ok {
+		return nil, nil, ErrViewMethod, fmt.Errorf("method %s doesn't exist", req.Method)
+	}
+	if len(req.Args) != len(method.Inputs) {
+		return nil, nil, ErrViewArgs, fmt.Errorf("method %s needs %d args, got %d", req.Method, len(method.Inputs), len(req.Args))
+	}
+
+	args := make([]interface{}, len(req.Args))
+	for i, arg := range req.Args {
+		v, err := abiValue(method.Inputs[i].Type, arg)
+		if err != nil {
+			return nil, nil, ErrViewArgs, fmt.Errorf("arg %d of %s: %v", i, req.Method, err)
+		}
+		args[i] = v.Interface()
+	}
+
+	input, err := contractABI.Pack(req.Method, args...)
+	if err != nil {
+		return nil, nil, ErrViewArgs, err
+	}
+	return &method, input, bctypes.CodeOK, nil
+}
+
+// abiValue converts JSON value to go value of ABI type, which can be packed by ABI.
+func abiValue(t abi.Type, arg interface{}) (reflect.Value, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		return abiNumber(t, arg)
+
+	case abi.BoolTy:
+		switch b := arg.(type) {
+		case bool:
+			return reflect.ValueOf(b), nil
+		case string:
+			if b == "true" || b == "false" {
+				return reflect.ValueOf(b == "true"), nil
+			}
+		}
+
+	case abi.StringTy:
+		if s, ok := arg.(string); ok {
+			return reflect.ValueOf(s), nil
+		}
+
+	case abi.AddressTy:
+		if s, ok := arg.(string); ok {
+			return abiAddress(t, s)
+		}
+
+	case abi.BytesTy, abi.FixedBytesTy:
+		s, ok := arg.(string)
+		if !ok {
+			break
+		}
+		b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid hex of %s", t.String())
+		}
+		if t.T == abi.BytesTy {
+			return reflect.ValueOf(b), nil
+		}
+		if len(b) > t.Size {
+			return reflect.Value{}, fmt.Errorf("%s has at most %d bytes", t.String(), t.Size)
+		}
+		v := reflect.New(t.Type).Elem()
+		reflect.Copy(v, reflect.ValueOf(b))
+		return v, nil
+
+	case abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return abiComposite(t, arg)
+	}
+
+	return reflect.Value{}, fmt.Errorf("can't convert %v to %s", arg, t.String())
+}
+
+func abiNumber(t abi.Type, arg interface{}) (reflect.Value, error) {
+	var s string
+	switch n := arg.(type) {
+	case json.Number:
+		s = n.String()
+	case string:
+		s = n
+	default:
+		return reflect.Value{}, fmt.Errorf("can't convert %v to %s", arg, t.String())
+	}
+
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("invalid number %s of %s", s, t.String())
+	}
+	if t.T == abi.UintTy && n.Sign() < 0 {
+		return reflect.Value{}, fmt.Errorf("%s can't be negative", t.String())
+	}
+	bits, magnitude := t.Size, n
+	if t.T == abi.IntTy {
+		// a signed n fits if n or -n-1 has at most Size-1 bits
+		bits--
+		if n.Sign() < 0 {
+			magnitude = new(big.Int).Not(n)
+		}
+	}
+	if magnitude.BitLen() > bits {
+		return reflect.Value{}, fmt.Errorf("%s overflows %s", s, t.String())
+	}
+
+	if t.Type == reflect.TypeOf(n) {
+		return reflect.ValueOf(n), nil
+	}
+	v := reflect.New(t.Type).Elem()
+	if t.T == abi.UintTy {
+		v.SetUint(n.Uint64())
+	} else {
+		v.SetInt(n.Int64())
+	}
+	return v, nil
+}
+
+func abiAddress(t abi.Type, s string) (reflect.Value, error) {
+	var b []byte
+	if strings.HasPrefix(s, "0x") {
+		var err error
+		if b, err = hex.DecodeString(s[2:]); err != nil || len(b) != t.Type.Len() {
+			return reflect.Value{}, fmt.Errorf("invalid address %s", s)
+		}
+	} else {
+		if err := algorithm.CheckAddress(statedbhelper.GetChainID(), s); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid address %s: %v", s, err)
+		}
+		b = crypto2.ToBVM(s).Bytes()
+	}
+
+	v := reflect.New(t.Type).Elem()
+	reflect.Copy(v, reflect.ValueOf(b))
+	return v, nil
+}
+
+// abiComposite converts array or object to slice, array or tuple, it's also accepted in a
+// string of JSON.
+func abiComposite(t abi.Type, arg interface{}) (reflect.Value, error) {
+	if s, ok := arg.(string); ok {
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		if err := decoder.Decode(&arg); err != nil {
+			return reflect.Value{}, fmt.Errorf("can't convert %s to %s", s, t.String())
+		}
+	}
+
+	if fields, ok := arg.(map[string]interface{}); ok && t.T == abi.TupleTy {
+		elems := make([]interface{}, len(t.TupleRawNames))
+		for i, name := range t.TupleRawNames {
+			if elems[i], ok = fields[name]; !ok {
+				return reflect.Value{}, fmt.Errorf("component %s of %s is missing", name, t.String())
+			}
+		}
+		arg = elems
+	}
+
+	elems, ok := arg.([]interface{})
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("can't convert %v to %s", arg, t.String())
+	}
+
+	var v reflect.Value
+	switch t.T {
+	case abi.SliceTy:
+		v = reflect.MakeSlice(t.Type, len(elems), len(elems))
+	case abi.ArrayTy:
+		if len(elems) != t.Size {
+			return reflect.Value{}, fmt.Errorf("%s needs %d elements, got %d", t.String(), t.Size, len(elems))
+		}
+		v = reflect.New(t.Type).Elem()
+	default:
+		if len(elems) != len(t.TupleElems) {
+			return reflect.Value{}, fmt.Errorf("%s needs %d components, got %d", t.String(), len(t.TupleElems), len(elems))
+		}
+		v = reflect.New(t.Type).Elem()
+	}
+
+	for i, e := range elems {
+		elemType := t.Elem
+		if t.T == abi.TupleTy {
+			elemType = t.TupleElems[i]
+		}
+		ev, err := abiValue(*elemType, e)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if t.T == abi.TupleTy {
+			v.Field(i).Set(ev)
+		} else {
+			v.Index(i).Set(ev)
+		}
+	}
+	return v, nil
+}
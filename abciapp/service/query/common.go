@@ -1,79 +1,19 @@
 package query
 
 import (
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/bcbchain/bcbchain/burrow"
-	"github.com/bcbchain/bcbchain/common/statedbhelper"
 	"github.com/bcbchain/bcbchain/hyperledger/burrow/abi"
 	crypto2 "github.com/bcbchain/bcbchain/hyperledger/burrow/crypto"
 	"github.com/bcbchain/bclib/algorithm"
-	"github.com/bcbchain/bclib/tendermint/abci/types"
-	types3 "github.com/bcbchain/bclib/tendermint/abci/types"
 	"github.com/bcbchain/bclib/tendermint/go-crypto"
-	log2 "github.com/bcbchain/bclib/tendermint/tmlibs/log"
 	tx2 "github.com/bcbchain/bclib/tx/v2"
 	types2 "github.com/bcbchain/bclib/types"
-	"github.com/bcbchain/bclib/wal"
-	"github.com/bcbchain/sdk/sdk/std"
 )
 
-func BvmViewKey(key string, log log2.Logger) (resQuery types.ResponseQuery) {
-	keys := strings.Split(key, "/")
-	if len(keys) != 5 {
-		return
-	}
-	contractAddr := keys[3]
-	methods := keys[4]
-
-	var methodName string
-	params := make([]string, 0)
-	if strings.Contains(methods, "(") && strings.HasSuffix(methods, ")") {
-		methodSlice := strings.Split(methods, "(")
-		methodName = methodSlice[0]
-		params = strings.Split(methodSlice[1][:len(methodSlice[1])-1], ",")
-	} else {
-		methodName = methods
-	}
-
-	contract := new(std.BvmContract)
-	res, _ := statedbhelper.GetFromDB("/bvm/contract/" + contractAddr)
-	if err := json.Unmarshal(res, &contract); err != nil {
-		return
-	}
-
-	Abi, err := abi.JSON(strings.NewReader(contract.BvmAbi))
-	if err != nil {
-		return
-	}
-
-	if !Abi.Methods[methodName].Const {
-		return
-	}
-
-	Array := make([]interface{}, 0)
-	for i := 0; i < len(params); i++ {
-		Array = append(Array, params[i])
-	}
-
-	BinParams, err := PackParams(Abi, methodName, Array...)
-	if err != nil {
-		return
-	}
-
-	resQuery, err = commitTX(contractAddr, BinParams, log)
-	if err != nil {
-		return
-	}
-	resQuery.Key = []byte(key)
-
-	return
-}
-
 // PrepareParam - prepare param for BVM exec
 func PrepareMessages(ContractAddr, TokenAddr crypto.Address, TransMethodID uint32, TransParams, BVMParams, BVMAbi []byte, IsCreateCall bool) []types2.Message {
 	Messages := make([]types2.Message, 0)
@@ -87,52 +27,6 @@ func PrepareMessages(ContractAddr, TokenAddr crypto.Address, TransMethodID uint3
 	return Messages
 }
 
-func commitTX(contractAddr string, BinParams []byte, log log2.Logger) (resQuery types.ResponseQuery, err error) {
-
-	Messages := PrepareMessages(contractAddr, "", 0, nil, BinParams, nil, false)
-
-	privateKey := crypto.GenPrivKeyEd25519FromSecret([]byte("0"))
-	acct := &wal.Account{
-		PrivateKey: privateKey,
-	}
-
-	type account struct {
-		Nonce uint64 `json:"nonce"`
-	}
-
-	a := new(account)
-	var nonce uint64
-	senderAddr := acct.Address(statedbhelper.GetChainID())
-	nonceValue, _ := statedbhelper.GetFromDB(std.KeyOfAccountNonce(senderAddr))
-
-	if len(nonceValue) == 0 {
-		nonce = 1
-	} else {
-		err = json.Unmarshal(nonceValue, a)
-		if err != nil {
-			return
-		}
-
-		nonce = a.Nonce + 1
-	}
-
-	var header types3.Header
-	var transaction types2.Transaction
-	bu := burrow.GetInstance(log)
-	transaction.Nonce = nonce
-	transaction.Messages = Messages
-	transaction.Note = ""
-	transaction.GasLimit = 100000
-	res := bu.InvokeTxEx(header, nil, 0, 0, senderAddr, transaction, acct.PubKey().Bytes())
-
-	return types.ResponseQuery{
-		Code:  types2.CodeBVMQueryOK,
-		Value: []byte(res.Data),
-		Log:   res.Log,
-	}, err
-
-}
-
 func PackParams(abi2 abi.ABI, method string, param ...interface{}) ([]byte, error) {
 
 	var length int
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
 	bctypes "github.com/bcbchain/bclib/types"
 
 	"github.com/bcbchain/bclib/tendermint/abci/types"
@@ -8,7 +9,8 @@ import (
 )
 
 type QueryConnection struct {
-	logger log.Logger
+	logger     log.Logger
+	queryRules []statedbhelper.QueryRule
 }
 
 func (conn *QueryConnection) SetLogger(logger log.Logger) {
@@ -0,0 +1,74 @@
+package query
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bcbchain/bcbchain/common/txindex"
+	"github.com/bcbchain/bclib/jsoniter"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	bctypes "github.com/bcbchain/bclib/types"
+)
+
+const txIndexPrefix = "/txindex/"
+
+// TxPage is value of query by secondary index of txs, Next is cursor of the next page,
+// it's empty if there's no more txs.
+type TxPage struct {
+	Txs  []*txindex.TxRecord `json:"txs"`
+	Next string              `json:"next"`
+}
+
+// queryTxIndex queries tx index with paths:
+//
+//	/txindex/tx/<txHash>
+//	/txindex/sender/<address>?cursor=<next>&limit=<n>&reverse=true
+//	/txindex/contract/<address>?...
+//	/txindex/receipt/<receiptName>?...
+func (conn *QueryConnection) queryTxIndex(path string) types.ResponseQuery {
+	u, err := url.Parse(path)
+	if err != nil {
+		return types.ResponseQuery{Code: bctypes.ErrPath, Log: err.Error()}
+	}
+
+	split := strings.SplitN(strings.TrimPrefix(u.Path, txIndexPrefix), "/", 2)
+	if len(split) != 2 || split[1] == "" {
+		return types.ResponseQuery{Code: bctypes.ErrPath, Log: "invalid tx index path"}
+	}
+
+	var value interface{}
+	if split[0] == "tx" {
+		record, err := txindex.Get(split[1])
+		if err != nil {
+			return types.ResponseQuery{Code: bctypes.ErrLogicError, Log: err.Error()}
+		}
+		if record == nil {
+			return types.ResponseQuery{Code: types.CodeTypeOK, Key: []byte(path)}
+		}
+		value = record
+	} else {
+		params := u.Query()
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		reverse, _ := strconv.ParseBool(params.Get("reverse"))
+
+		txs, next, err := txindex.Find(split[0], split[1], params.Get("cursor"), limit, reverse)
+		if err != nil {
+			return types.ResponseQuery{Code: bctypes.ErrLogicError, Log: err.Error()}
+		}
+		value = &TxPage{Txs: txs, Next: next}
+	}
+
+	resBytes, err := jsoniter.Marshal(value)
+	if err != nil {
+		conn.logger.Fatal("marshal tx index failed ", "error", err)
+		panic(err)
+	}
+
+	return types.ResponseQuery{
+		Code:   types.CodeTypeOK,
+		Key:    []byte(path),
+		Value:  resBytes,
+		Height: txindex.LastHeight(),
+	}
+}
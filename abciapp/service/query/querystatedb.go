@@ -2,9 +2,13 @@ package query
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/statedb"
+	"github.com/bcbchain/bclib/jsoniter"
 	"github.com/bcbchain/bclib/tendermint/abci/types"
 	tx2 "github.com/bcbchain/bclib/tx/v2"
 	bctypes "github.com/bcbchain/bclib/types"
@@ -12,6 +16,29 @@ import (
 
 func (conn *QueryConnection) query(req types.RequestQuery) (resQuery types.ResponseQuery) {
 	var query bctypes.Query
+	var signer bctypes.Address
+
+	if req.Path == simulatePath {
+		if bcerr := conn.checkAccess(simulatePath, ""); bcerr != nil {
+			return types.ResponseQuery{
+				Code: bcerr.ErrorCode,
+				Log:  bcerr.Error(),
+			}
+		}
+		return conn.simulate(req.Data)
+	}
+	if req.Path == bvmViewPath {
+		if bcerr := conn.checkAccess(bvmViewPath, ""); bcerr != nil {
+			return types.ResponseQuery{
+				Code: bcerr.ErrorCode,
+				Log:  bcerr.Error(),
+			}
+		}
+		return conn.bvmView(req.Data)
+	}
+	if req.Path == softforksPath {
+		return conn.forkSchedule()
+	}
 
 	if len(req.Data) != 0 {
 		chainID := statedbhelper.GetChainID()
@@ -24,28 +51,46 @@ func (conn *QueryConnection) query(req types.RequestQuery) (resQuery types.Respo
 			}
 		}
 		query = query2
-		if strings.HasPrefix(query.QueryKey, "/account") { //如果key包含了签名的地址才让查询
-			if !strings.Contains(query.QueryKey, addrStr) {
-				conn.logger.Error("Query only can query itself,but get other address")
-				bcerr := bctypes.BcError{
-					ErrorCode: bctypes.ErrNoAuthorization,
-					ErrorDesc: "",
-				}
-				return types.ResponseQuery{
-					Code: bcerr.ErrorCode,
-					Log:  bcerr.Error(),
-				}
-			}
-		}
-
+		signer = addrStr
 	} else if req.Path != "" {
 		query.QueryKey = req.Path
 	}
 
+	var decoded bool
+	query.QueryKey, decoded = splitFormat(query.QueryKey)
+	if bcerr := conn.checkAccess(query.QueryKey, signer); bcerr != nil {
+		return types.ResponseQuery{
+			Code: bcerr.ErrorCode,
+			Log:  bcerr.Error(),
+		}
+	}
+
 	if strings.HasPrefix(query.QueryKey, "/bvm/view/") {
 		return BvmViewKey(query.QueryKey, conn.logger)
 	}
 
+	if strings.HasPrefix(query.QueryKey, txIndexPrefix) {
+		return conn.queryTxIndex(query.QueryKey)
+	}
+
+	if req.Prove {
+		if req.Height != 0 {
+			return types.ResponseQuery{
+				Code: bctypes.ErrLogicError,
+				Log:  "proof is only available at the last height",
+			}
+		}
+		return conn.queryWithProof(query.QueryKey, req.Path)
+	}
+
+	if req.Height != 0 {
+		res := conn.queryAtHeight(query.QueryKey, req.Path, req.Height)
+		if decoded && res.Code == types.CodeTypeOK {
+			res.Value = decodeValue(query.QueryKey, res.Value)
+		}
+		return res
+	}
+
 	conn.logger.Debug("key info:", "key:", req.Path)
 	var kBytes []byte
 	kBytes, err := statedbhelper.GetFromDB(query.QueryKey)
@@ -54,6 +99,9 @@ func (conn *QueryConnection) query(req types.RequestQuery) (resQuery types.Respo
 		panic(err)
 	}
 	conn.logger.Debug("value info:", "value byte length:", len(kBytes))
+	if decoded {
+		kBytes = decodeValue(query.QueryKey, kBytes)
+	}
 
 	return types.ResponseQuery{
 		Code:  types.CodeTypeOK,
@@ -62,6 +110,54 @@ func (conn *QueryConnection) query(req types.RequestQuery) (resQuery types.Respo
 	}
 }
 
+func (conn *QueryConnection) queryAtHeight(key, path string, height int64) types.ResponseQuery {
+	conn.logger.Debug("key info:", "key:", key, "height", height)
+	kBytes, err := statedbhelper.GetAtHeight(key, height)
+	if err != nil {
+		return types.ResponseQuery{
+			Code: bctypes.ErrLogicError,
+			Log:  err.Error(),
+		}
+	}
+
+	return types.ResponseQuery{
+		Code:   types.CodeTypeOK,
+		Key:    []byte(path),
+		Value:  kBytes,
+		Height: height,
+	}
+}
+
+// StateProof is the proof of a key against the AppHash in header of the next block
+type StateProof struct {
+	Root  []byte         `json:"root"`
+	Proof *statedb.Proof `json:"proof"`
+}
+
+func (conn *QueryConnection) queryWithProof(key, path string) types.ResponseQuery {
+	root, proof := statedbhelper.GetStateProof(key)
+	if root == nil {
+		return types.ResponseQuery{
+			Code: bctypes.ErrLogicError,
+			Log:  "state root is not enabled",
+		}
+	}
+
+	proofBytes, err := jsoniter.Marshal(&StateProof{Root: root, Proof: proof})
+	if err != nil {
+		conn.logger.Fatal("marshal proof failed ", "error", err)
+		panic(err)
+	}
+
+	return types.ResponseQuery{
+		Code:   types.CodeTypeOK,
+		Key:    []byte(path),
+		Value:  proof.Value,
+		Proof:  proofBytes,
+		Height: statedbhelper.GetWorldAppState(0, 0).BlockHeight,
+	}
+}
+
 func (conn *QueryConnection) queryEx(req types.RequestQueryEx) (resQuery types.ResponseQueryEx) {
 	var query bctypes.Query
 
@@ -69,7 +165,34 @@ func (conn *QueryConnection) queryEx(req types.RequestQueryEx) (resQuery types.R
 		query.QueryKey = req.Path
 	}
 
+	// RequestQueryEx has no height field, "?height=N" at the end of path is used instead
+	path, opts, err := splitOptions(query.QueryKey)
+	if err != nil {
+		return types.ResponseQueryEx{
+			Code: bctypes.ErrPath,
+			Log:  err.Error(),
+		}
+	}
+	query.QueryKey = path
+
 	conn.logger.Debug("key info:", "key:", req.Path)
+	if strings.HasSuffix(query.QueryKey, "/*") {
+		prefix := strings.TrimSuffix(query.QueryKey, "*")
+		if bcerr := conn.checkPrefixAccess(prefix, ""); bcerr != nil {
+			return types.ResponseQueryEx{
+				Code: bcerr.ErrorCode,
+				Log:  bcerr.Error(),
+			}
+		}
+		return conn.queryPrefix(prefix, opts)
+	}
+	if opts.paged() {
+		return types.ResponseQueryEx{
+			Code: bctypes.ErrPath,
+			Log:  "start, end, cursor and limit are only available for path ends with '/*'",
+		}
+	}
+	height := opts.height
 	//提取字符串
 
 	keys, err := ResolvePath(query.QueryKey)
@@ -79,9 +202,31 @@ func (conn *QueryConnection) queryEx(req types.RequestQueryEx) (resQuery types.R
 			Log:  err.Error(),
 		}
 	}
+	// QueryEx isn't signed, all keys must be public
+	for _, v := range keys {
+		if bcerr := conn.checkAccess(v, ""); bcerr != nil {
+			return types.ResponseQueryEx{
+				Code: bcerr.ErrorCode,
+				Log:  bcerr.Error(),
+			}
+		}
+	}
 	//var kBytes []byte
 	kv := make([]types.KeyValue, len(keys))
 	for i, v := range keys {
+		if height != 0 {
+			kBytes, err := statedbhelper.GetAtHeight(v, height)
+			if err != nil {
+				return types.ResponseQueryEx{
+					Code: bctypes.ErrLogicError,
+					Log:  err.Error(),
+				}
+			}
+			kv[i].Key = []byte(v)
+			kv[i].Value = kBytes
+			continue
+		}
+
 		kBytes, err := statedbhelper.GetFromDB(v)
 		if err != nil {
 			conn.logger.Fatal("query DB failed ", "error", err)
@@ -92,10 +237,161 @@ func (conn *QueryConnection) queryEx(req types.RequestQueryEx) (resQuery types.R
 		kv[i].Value = kBytes
 	}
 
+	if opts.format == formatJSON {
+		decodeKeyValues(kv)
+	}
+
+	return types.ResponseQueryEx{
+		Code:      types.CodeTypeOK,
+		KeyValues: kv,
+		Height:    height,
+	}
+}
+
+// queryPrefix lists committed keys with prefix in ascending order, a page has at most limit keys,
+// and Info of response is the cursor of the next page, it's empty at the last page.
+func (conn *QueryConnection) queryPrefix(prefix string, opts queryOptions) types.ResponseQueryEx {
+	if opts.height != 0 {
+		return types.ResponseQueryEx{
+			Code: bctypes.ErrPath,
+			Log:  "height is not available for path ends with '/*'",
+		}
+	}
+
+	iterOpts := statedb.IterOptions{Prefix: prefix, Limit: opts.limit + 1}
+	if opts.start != "" {
+		iterOpts.Start = prefix + opts.start
+	}
+	if opts.end != "" {
+		iterOpts.End = prefix + opts.end
+	}
+	if opts.cursor != "" {
+		if !strings.HasPrefix(opts.cursor, prefix) {
+			return types.ResponseQueryEx{
+				Code: bctypes.ErrPath,
+				Log:  "cursor does not match path",
+			}
+		}
+		if opts.cursor > iterOpts.Start {
+			iterOpts.Start = opts.cursor
+		}
+	}
+
+	it := statedbhelper.NewIterator(0, 0, iterOpts)
+	defer it.Close()
+
+	kv := make([]types.KeyValue, 0)
+	next := ""
+	for ; it.Valid(); it.Next() {
+		if len(kv) == opts.limit {
+			next = it.Key()
+			break
+		}
+		kv = append(kv, types.KeyValue{Key: []byte(it.Key()), Value: it.Value()})
+	}
+	conn.logger.Debug("prefix query", "prefix", prefix, "count", len(kv), "next", next)
+	if opts.format == formatJSON {
+		decodeKeyValues(kv)
+	}
+
 	return types.ResponseQueryEx{
 		Code:      types.CodeTypeOK,
+		Info:      next,
 		KeyValues: kv,
+		Height:    statedbhelper.GetWorldAppState(0, 0).BlockHeight,
+	}
+}
+
+// page sizes of prefix query
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// queryOptions are options given as "?k1=v1&k2=v2" at the end of path of QueryEx,
+// start and end are relative to prefix and range of keys is [start, end),
+// cursor is a full key returned as Info of the previous page, format=json decodes values.
+type queryOptions struct {
+	height int64
+	start  string
+	end    string
+	cursor string
+	limit  int
+	format string
+}
+
+func (o queryOptions) paged() bool {
+	return o.start != "" || o.end != "" || o.cursor != "" || o.limit != defaultPageSize
+}
+
+// formatJSON is the format which decodes values by their schema to normalised JSON with type names.
+const formatJSON = "json"
+
+// splitFormat splits "key?format=json" to key and whether its value is decoded.
+func splitFormat(key string) (string, bool) {
+	if strings.HasSuffix(key, "?format="+formatJSON) {
+		return strings.TrimSuffix(key, "?format="+formatJSON), true
+	}
+	return key, false
+}
+
+// decodeValue returns JSON of value of key decoded by statedbhelper.DecodeValue.
+func decodeValue(key string, value []byte) []byte {
+	bz, err := jsoniter.Marshal(statedbhelper.DecodeValue(key, value))
+	if err != nil {
+		panic(err)
+	}
+	return bz
+}
+
+func decodeKeyValues(kv []types.KeyValue) {
+	for i := range kv {
+		kv[i].Value = decodeValue(string(kv[i].Key), kv[i].Value)
+	}
+}
+
+// splitOptions splits "path?k1=v1&k2=v2" to path and options, values must be escaped as url query.
+func splitOptions(path string) (string, queryOptions, error) {
+	opts := queryOptions{limit: defaultPageSize}
+
+	i := strings.Index(path, "?")
+	if i < 0 {
+		return path, opts, nil
+	}
+
+	values, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		return "", opts, fmt.Errorf("invalid options in path")
+	}
+	for k := range values {
+		v := values.Get(k)
+		switch k {
+		case "height":
+			opts.height, err = strconv.ParseInt(v, 10, 64)
+			if err != nil || opts.height <= 0 {
+				return "", opts, fmt.Errorf("invalid height in path")
+			}
+		case "limit":
+			opts.limit, err = strconv.Atoi(v)
+			if err != nil || opts.limit <= 0 || opts.limit > maxPageSize {
+				return "", opts, fmt.Errorf("limit must be in [1, %d]", maxPageSize)
+			}
+		case "start":
+			opts.start = v
+		case "end":
+			opts.end = v
+		case "cursor":
+			opts.cursor = v
+		case "format":
+			if v != formatJSON {
+				return "", opts, fmt.Errorf("unknown format %s in path", v)
+			}
+			opts.format = v
+		default:
+			return "", opts, fmt.Errorf("unknown option %s in path", k)
+		}
 	}
+	return path[:i], opts, nil
 }
 
 func ResolvePath(path string) ([]string, error) {
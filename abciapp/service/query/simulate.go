@@ -0,0 +1,204 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/smcrunctl/adapter"
+	"github.com/bcbchain/bclib/algorithm"
+	"github.com/bcbchain/bclib/jsoniter"
+	"github.com/bcbchain/bclib/rlp"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	tx2 "github.com/bcbchain/bclib/tx/v2"
+	tx3 "github.com/bcbchain/bclib/tx/v3"
+	bctypes "github.com/bcbchain/bclib/types"
+	"github.com/btcsuite/btcutil/base58"
+)
+
+const simulatePath = "/simulate"
+
+// SimulateRequest is data of query "/simulate". Tx is a signed v2/v3 tx, or an unsigned one
+// like "<chainID><tx>.v2.<payload>" with PubKey of sender in hex, nonce 0 of unsigned tx means
+// the next nonce of sender.
+type SimulateRequest struct {
+	Tx     string `json:"tx"`
+	PubKey string `json:"pubKey,omitempty"`
+}
+
+// SimulateResult is value of query "/simulate", nothing of it is saved to state db.
+type SimulateResult struct {
+	Code    uint32          `json:"code"`
+	Log     string          `json:"log"`
+	GasUsed int64           `json:"gasUsed"`
+	Fee     int64           `json:"fee"`
+	Tags    []common.KVPair `json:"tags"`
+	Changes []StateChange   `json:"changes"` // changes of a failed tx are discarded as DeliverTx does, except nonce,
+	// changes of keys which unsigned query can't query are omitted
+}
+
+// StateChange is a key changed by tx, empty value means the key doesn't exist.
+type StateChange struct {
+	Key      string `json:"key"`
+	OldValue []byte `json:"oldValue"`
+	NewValue []byte `json:"newValue"`
+}
+
+func (conn *QueryConnection) simulate(data []byte) types.ResponseQuery {
+	chainID := statedbhelper.GetChainID()
+
+	var req SimulateRequest
+	if err := jsoniter.Unmarshal(data, &req); err != nil {
+		return types.ResponseQuery{
+			Code: bctypes.ErrLogicError,
+			Log:  err.Error(),
+		}
+	}
+
+	transaction, pubKey, err := parseSimulateTx(chainID, req)
+	if err != nil {
+		conn.logger.Debug("simulate tx parse failed", "error", err)
+		return types.ResponseQuery{
+			Code: bctypes.ErrCheckTx,
+			Log:  err.Error(),
+		}
+	}
+
+	result := conn.runSimulate(chainID, req.Tx, transaction, pubKey)
+	result.Changes = conn.visibleChanges(result.Changes)
+	value, err := jsoniter.Marshal(result)
+	if err != nil {
+		conn.logger.Fatal("marshal simulate result failed ", "error", err)
+		panic(err)
+	}
+
+	return types.ResponseQuery{
+		Code:  result.Code,
+		Key:   []byte(simulatePath),
+		Value: value,
+		Log:   result.Log,
+	}
+}
+
+// runSimulate invokes tx as CheckTx does on a rollback transaction and collects its changes.
+func (conn *QueryConnection) runSimulate(chainID, tx string, transaction bctypes.Transaction, pubKey crypto.PubKeyEd25519) *SimulateResult {
+	if len(transaction.Note) > bctypes.MaxSizeNote {
+		return &SimulateResult{Code: bctypes.ErrCheckTx, Log: "Invalid transaction note"}
+	}
+
+	transID, _ := statedbhelper.NewRollbackTransactionID()
+	statedbhelper.BeginBlock(transID)
+	defer statedbhelper.RollbackBlock(transID)
+	txID := statedbhelper.NewTx(transID)
+
+	sender := pubKey.Address(chainID)
+	if transaction.Nonce == 0 {
+		transaction.Nonce = statedbhelper.GetAccountNonce(transID, txID, sender) + 1
+	}
+	nonceBuffer, err := statedbhelper.SetAccountNonceToTx(transID, txID, sender, transaction.Nonce)
+	if err != nil {
+		return &SimulateResult{Code: bctypes.ErrCheckTx, Log: "Invalid nonce"}
+	}
+
+	adp := adapter.GetInstance()
+	defer adp.Rollback(transID)
+	appStat := statedbhelper.GetWorldAppState(0, 0)
+
+	blockHeader := types.Header{}
+	if appStat.BlockHeight == 0 {
+		blockHeader.ChainID = chainID
+		blockHeader.Height = 0
+	} else {
+		blockHeader = appStat.BeginBlock.Header
+		blockHeader.Height = blockHeader.Height + 1
+	}
+
+	txHash := common.HexBytes(algorithm.CalcCodeHash(tx))
+	response := adp.InvokeTx(blockHeader, transID, txID, sender, transaction, pubKey.Bytes(), txHash, appStat.BeginBlock.Hash)
+	result := &SimulateResult{
+		Code:    response.Code,
+		Log:     response.Log,
+		GasUsed: response.GasUsed,
+		Fee:     response.Fee,
+		Tags:    response.Tags,
+	}
+
+	buffer := nonceBuffer
+	if response.Code == bctypes.CodeOK || response.Code == bctypes.CodeBVMQueryOK {
+		_, buffer = statedbhelper.CommitTx(transID, txID)
+	}
+	result.Changes = stateChanges(buffer)
+
+	return result
+}
+
+func stateChanges(buffer map[string][]byte) []StateChange {
+	changes := make([]StateChange, 0, len(buffer))
+	for k, v := range buffer {
+		old, err := statedbhelper.GetFromDB(k)
+		if err != nil {
+			panic(err)
+		}
+		if bytes.Equal(old, v) {
+			continue
+		}
+		changes = append(changes, StateChange{Key: k, OldValue: old, NewValue: v})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+
+	return changes
+}
+
+// parseSimulateTx parses signed tx, or parses payload of tx without checking signature if
+// public key is given.
+func parseSimulateTx(chainID string, req SimulateRequest) (transaction bctypes.Transaction, pubKey crypto.PubKeyEd25519, err error) {
+	if req.PubKey == "" {
+		tx2.Init(chainID)
+		transaction, pubKey, err = tx2.TxParse(req.Tx)
+		if err != nil {
+			tx3.Init(chainID)
+			transaction, pubKey, err = tx3.TxParse(req.Tx)
+		}
+		return
+	}
+
+	pubKeyBytes, err := hex.DecodeString(strings.TrimPrefix(req.PubKey, "0x"))
+	if err != nil || len(pubKeyBytes) != len(pubKey) {
+		err = errors.New("invalid pubKey")
+		return
+	}
+	copy(pubKey[:], pubKeyBytes)
+
+	strs := strings.Split(req.Tx, ".")
+	if (len(strs) != 3 && len(strs) != 5) || strs[0] != chainID+"<tx>" {
+		err = errors.New("tx data error")
+		return
+	}
+
+	var payload []byte
+	switch strs[1] {
+	case "v2":
+		payload = base58.Decode(strs[2])
+	case "v3":
+		payload, err = base64.StdEncoding.DecodeString(strs[2])
+	default:
+		err = errors.New("tx data error")
+	}
+	if err != nil {
+		return
+	}
+
+	if err = rlp.Decode(bytes.NewReader(payload), &transaction); err != nil {
+		return
+	}
+	if len(transaction.Messages) == 0 || len(transaction.Messages) > 2 {
+		err = errors.New("invalid count of messages")
+	}
+	return
+}
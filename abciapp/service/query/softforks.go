@@ -0,0 +1,52 @@
+package query
+
+import (
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/jsoniter"
+	"github.com/bcbchain/bclib/tendermint/abci/types"
+)
+
+const softforksPath = "/softforks"
+
+// ForkSchedule is value of query "/softforks", nodes with the same Hash run the same softfork schedule.
+type ForkSchedule struct {
+	Height   int64                `json:"height"`
+	Hash     string               `json:"hash"`
+	Features []FeatureStatus      `json:"features"`
+	Forks    []softforks.ForkInfo `json:"forks"` // forks configured in abci-forks.json
+}
+
+// FeatureStatus is schedule of feature and whether it's active at the next block.
+type FeatureStatus struct {
+	softforks.Schedule
+	Active bool `json:"active"`
+}
+
+func (conn *QueryConnection) forkSchedule() types.ResponseQuery {
+	height := statedbhelper.GetWorldAppState(0, 0).BlockHeight
+
+	schedule := ForkSchedule{
+		Height: height,
+		Hash:   softforks.ScheduleHash(),
+		Forks:  softforks.Forks(""),
+	}
+	for _, s := range softforks.Schedules() {
+		schedule.Features = append(schedule.Features, FeatureStatus{
+			Schedule: s,
+			Active:   softforks.IsActive(s.Name, height+1),
+		})
+	}
+
+	value, err := jsoniter.Marshal(schedule)
+	if err != nil {
+		conn.logger.Fatal("marshal softforks failed ", "error", err)
+		panic(err)
+	}
+	return types.ResponseQuery{
+		Code:   types.CodeTypeOK,
+		Key:    []byte(softforksPath),
+		Value:  value,
+		Height: height,
+	}
+}
@@ -0,0 +1,192 @@
+package softforks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// scopes of feature, where its behaviour changes
+const (
+	ScopeApp        = "app"        // abci app
+	ScopeContainers = "containers" // contracts in containers, forks are sent to them by InitDockerSoftForks
+	ScopeBVM        = "bvm"        // bvm contracts
+)
+
+// names of features
+const (
+	AllRewardsInBlock    = "allRewardsInBlock"
+	SdkBlockHash         = "sdkBlockHash"
+	RewardTokenInAccount = "rewardTokenInAccount"
+	ResetGasUsed         = "resetGasUsed"
+	StateRoot            = "stateRoot"
+	FeeDistribution      = "feeDistribution"
+	ScheduledCall        = "scheduledCall"
+	Sponsorship          = "sponsorship"
+	BlockLimits          = "blockLimits"
+	ParallelDeliver      = "parallelDeliver"
+)
+
+//Feature is a change of behaviour controlled by the fork with Tag in abci-forks.json,
+//it's active from effectblockheight of fork, or in (bugblockheight, effectblockheight) if Window is set.
+type Feature struct {
+	Name        string `json:"name"`
+	Tag         string `json:"tag"`
+	Scope       string `json:"scope"`
+	Window      bool   `json:"window,omitempty"` // active only in (bugblockheight, effectblockheight)
+	Default     bool   `json:"default"`          // whether it's active at all heights if fork isn't configured
+	Description string `json:"description"`
+}
+
+// features lists all features, a fork may control several features
+var features = []Feature{
+	{Name: AllRewardsInBlock, Tag: "fork-abci#1.0.2.3233", Scope: ScopeApp, Default: true,
+		Description: "fixes bug #2092, shows all of rewards in block instead of the last one"},
+	{Name: SdkBlockHash, Tag: "fork-abci#2.0.1.13780", Scope: ScopeContainers, Default: true,
+		Description: "fixes bug #4281, sets block hash of sdk block to tendermint block hash"},
+	{Name: RewardTokenInAccount, Tag: "fork-abci#2.0.1.13780", Scope: ScopeApp, Default: true,
+		Description: "adds token of fee reward to token list of reward account"},
+	{Name: ResetGasUsed, Tag: "fork-abci#2.0.2.14654", Scope: ScopeApp, Window: true,
+		Description: "bug #4251, gas_used of tx is gas of its last message except filtered contracts"},
+	{Name: StateRoot, Tag: "fork-abci#2.2.2.stateroot", Scope: ScopeApp,
+		Description: "uses state root of statedb as AppHash instead of MD5 deliver-hash chaining"},
+	{Name: FeeDistribution, Tag: "fork-abci#2.2.2.feedistribution", Scope: ScopeApp,
+		Description: "distributes fee with exact integer arithmetic and extended reward strategy"},
+	{Name: ScheduledCall, Tag: "fork-abci#2.2.2.scheduledcall", Scope: ScopeApp,
+		Description: "runs tx whose note is \"schedule:<height>\" at EndBlock of that height"},
+	{Name: Sponsorship, Tag: "fork-abci#2.2.2.sponsorship", Scope: ScopeApp,
+		Description: "accepts tx with sponsorship whose fee is paid by sponsor"},
+	{Name: BlockLimits, Tag: "fork-abci#2.2.2.blocklimits", Scope: ScopeApp,
+		Description: "rejects txs of block after gas, invocations or receipt bytes of block limits are used up"},
+	{Name: ParallelDeliver, Tag: "fork-abci#2.2.2.paralleldeliver", Scope: ScopeApp,
+		Description: "drops cache of failed tx in dockers, then txs of block may be delivered in parallel"},
+}
+
+var nameToFeature = make(map[string]Feature)
+
+func init() {
+	for _, f := range features {
+		if _, ok := nameToFeature[f.Name]; ok {
+			panic("duplicate softfork feature " + f.Name)
+		}
+		nameToFeature[f.Name] = f
+	}
+}
+
+//Schedule is activation of feature resolved from abci-forks.json
+type Schedule struct {
+	Feature
+	Configured         bool  `json:"configured"`                   // whether fork is configured in abci-forks.json
+	Enabled            bool  `json:"enabled"`                      // false means it's inactive at all heights
+	ActivationHeight   int64 `json:"activationHeight"`             // active from this height
+	DeactivationHeight int64 `json:"deactivationHeight,omitempty"` // inactive from this height, 0 means never
+}
+
+//IsActive returns whether feature is active at height, it panics if feature isn't registered
+func IsActive(name string, height int64) bool {
+	f, ok := nameToFeature[name]
+	if !ok {
+		panic("unknown softfork feature " + name)
+	}
+
+	return scheduleOf(f).isActive(height)
+}
+
+//Schedules returns schedules of all features
+func Schedules() []Schedule {
+	schedules := make([]Schedule, 0, len(features))
+	for _, f := range features {
+		schedules = append(schedules, scheduleOf(f))
+	}
+	return schedules
+}
+
+//Features returns registered features in scope
+func Features(scope string) []Feature {
+	fs := make([]Feature, 0)
+	for _, f := range features {
+		if scope == "" || f.Scope == scope {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+//Forks returns forks configured in abci-forks.json whose features are in scope, sorted by tag
+func Forks(scope string) []ForkInfo {
+	forks := make([]ForkInfo, 0)
+	for tag, forkInfo := range TagToForkInfo {
+		for _, f := range features {
+			if f.Tag == tag && (scope == "" || f.Scope == scope) {
+				forks = append(forks, forkInfo)
+				break
+			}
+		}
+	}
+	sort.Slice(forks, func(i, j int) bool { return forks[i].Tag < forks[j].Tag })
+	return forks
+}
+
+//ScheduleHash returns hash of schedules and configured forks, nodes with the same hash
+//run the same softfork schedule.
+func ScheduleHash() string {
+	bz, err := json.Marshal(struct {
+		Schedules []Schedule `json:"schedules"`
+		Forks     []ForkInfo `json:"forks"`
+	}{Schedules(), Forks("")})
+	if err != nil {
+		panic(err)
+	}
+
+	sum := sha256.Sum256(bz)
+	return hex.EncodeToString(sum[:])
+}
+
+func scheduleOf(f Feature) Schedule {
+	forkInfo, ok := TagToForkInfo[f.Tag]
+	if !ok {
+		return Schedule{Feature: f, Enabled: f.Default}
+	}
+
+	s := Schedule{Feature: f, Configured: true, Enabled: true, ActivationHeight: forkInfo.EffectBlockHeight}
+	if f.Window {
+		s.ActivationHeight, s.DeactivationHeight = forkInfo.BugBlockHeight+1, forkInfo.EffectBlockHeight
+	}
+	return s
+}
+
+func (s Schedule) isActive(height int64) bool {
+	return s.Enabled && height >= s.ActivationHeight && (s.DeactivationHeight == 0 || height < s.DeactivationHeight)
+}
+
+// validate checks forks in abci-forks.json against features
+func validate(forks []ForkInfo) error {
+	tags := make(map[string]struct{})
+	for _, fork := range forks {
+		if _, ok := tags[fork.Tag]; ok {
+			return fmt.Errorf("duplicate fork %s", fork.Tag)
+		}
+		tags[fork.Tag] = struct{}{}
+
+		known := false
+		for _, f := range features {
+			if f.Tag != fork.Tag {
+				continue
+			}
+			known = true
+			if f.Window && fork.BugBlockHeight >= fork.EffectBlockHeight {
+				return fmt.Errorf("fork %s: bugblockheight %d must be less than effectblockheight %d",
+					fork.Tag, fork.BugBlockHeight, fork.EffectBlockHeight)
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown fork %s", fork.Tag)
+		}
+		if fork.EffectBlockHeight <= 0 {
+			return fmt.Errorf("fork %s: effectblockheight must be positive", fork.Tag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package softforks
+
+import "testing"
+
+func TestIsActive(t *testing.T) {
+	defer func() { TagToForkInfo = nil }()
+
+	// 未配置时：修复类特性始终生效，新特性始终不生效
+	TagToForkInfo = map[string]ForkInfo{}
+	if !IsActive(AllRewardsInBlock, 1) || !IsActive(SdkBlockHash, 1) || IsActive(ResetGasUsed, 1) ||
+		IsActive(StateRoot, 1) || IsActive(Sponsorship, 1) || IsActive(BlockLimits, 1) {
+		t.Error("wrong default of features")
+	}
+
+	TagToForkInfo = map[string]ForkInfo{
+		"fork-abci#2.0.1.13780":     {Tag: "fork-abci#2.0.1.13780", EffectBlockHeight: 100},
+		"fork-abci#2.0.2.14654":     {Tag: "fork-abci#2.0.2.14654", BugBlockHeight: 50, EffectBlockHeight: 100},
+		"fork-abci#2.2.2.stateroot": {Tag: "fork-abci#2.2.2.stateroot", EffectBlockHeight: 100},
+	}
+	cases := []struct {
+		name   string
+		height int64
+		active bool
+	}{
+		{SdkBlockHash, 99, false},
+		{SdkBlockHash, 100, true},
+		{RewardTokenInAccount, 100, true},
+		{ResetGasUsed, 50, false},
+		{ResetGasUsed, 51, true},
+		{ResetGasUsed, 99, true},
+		{ResetGasUsed, 100, false},
+		{StateRoot, 99, false},
+		{StateRoot, 100, true},
+		{FeeDistribution, 100, false},
+		{ParallelDeliver, 100, false},
+	}
+	for _, c := range cases {
+		if IsActive(c.name, c.height) != c.active {
+			t.Errorf("%s at %d: want %v", c.name, c.height, c.active)
+		}
+	}
+
+	// 配置变化后哈希随之变化
+	hash := ScheduleHash()
+	TagToForkInfo["fork-abci#2.2.2.stateroot"] = ForkInfo{Tag: "fork-abci#2.2.2.stateroot", EffectBlockHeight: 101}
+	if ScheduleHash() == hash {
+		t.Error("hash of schedule isn't changed")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	good := []ForkInfo{{Tag: "fork-abci#2.0.2.14654", BugBlockHeight: 50, EffectBlockHeight: 100}}
+	if err := validate(good); err != nil {
+		t.Error(err)
+	}
+
+	bad := [][]ForkInfo{
+		{{Tag: "fork-abci#9.9.9", EffectBlockHeight: 100}},
+		{{Tag: "fork-abci#2.0.2.14654", BugBlockHeight: 100, EffectBlockHeight: 100}},
+		{{Tag: "fork-abci#2.2.2.stateroot"}},
+		{{Tag: "fork-abci#2.2.2.stateroot", EffectBlockHeight: 1}, {Tag: "fork-abci#2.2.2.stateroot", EffectBlockHeight: 2}},
+	}
+	for _, forks := range bad {
+		if err := validate(forks); err == nil {
+			t.Errorf("%v is valid", forks)
+		}
+	}
+}
@@ -75,6 +75,9 @@ func Init() {
 	if err != nil {
 		panic(err.Error())
 	}
+	if err = validate(AppForkInfo); err != nil {
+		panic("invalid " + forksFile + ": " + err.Error())
+	}
 
 	for _, v := range AppForkInfo {
 		TagToForkInfo[v.Tag] = v
@@ -84,33 +87,19 @@ func Init() {
 // Fixs bug #2092, only the last reward be shown in block.
 // Adds the softfork to show all of rewards in block
 func V1_0_2_3233(blockHeight int64) bool {
-	if forkInfo, ok := TagToForkInfo["fork-abci#1.0.2.3233"]; ok {
-		return blockHeight < forkInfo.EffectBlockHeight
-	}
-
-	return false
+	return !IsActive(AllRewardsInBlock, blockHeight)
 }
 
 // Fixs bug #4281, sdk block hash not equal tendermint block hahs.
 // Adds the softfork to reset sdk block hash
 func V2_0_1_13780(blockHeight int64) bool {
-	if forkInfo, ok := TagToForkInfo["fork-abci#2.0.1.13780"]; ok {
-		return blockHeight < forkInfo.EffectBlockHeight
-	}
-
-	return false
+	return !IsActive(SdkBlockHash, blockHeight)
 }
 
 // Fixs bug #4251, gas_used showed be sum of all messages in block.
 // Adds the softfork to show all of gas_used in block
 func V2_0_2_14654(blockHeight int64) bool {
-	if forkInfo, ok := TagToForkInfo["fork-abci#2.0.2.14654"]; ok {
-		if blockHeight < forkInfo.EffectBlockHeight &&
-			blockHeight > forkInfo.BugBlockHeight {
-			return true
-		}
-	}
-	return false
+	return IsActive(ResetGasUsed, blockHeight)
 }
 
 func FilterContracts_V2_0_2_14654(orgID, contractName string) bool {
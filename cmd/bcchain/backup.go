@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bcbchain/bcbchain/abciapp/common"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/common/txindex"
+	"github.com/bcbchain/bclib/fs"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Backup state db",
+	Long:  "Backup state db at the last committed block, the running bcchain takes the backup through its admin address",
+	Args:  cobra.ExactArgs(0),
+	RunE:  backup,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore state db from backup",
+	Long:  "Restore state db from backup after the manifest is verified, tx index and change set outbox are aligned to it, bcchain must be stopped",
+	Args:  cobra.ExactArgs(0),
+	RunE:  restore,
+}
+
+//backup 备份状态库，bcchain 运行时通过管理地址在区块提交间隙备份，未运行时直接只读打开状态库备份
+func backup(cmd *cobra.Command, args []string) error {
+	out, _ := cmd.Flags().GetString("out")
+	dbDir, _ := cmd.Flags().GetString("dbDir")
+	if out == "" {
+		err := errors.New("flag --out is required")
+		fmt.Printf("backup bcchain err: %s\n", err)
+		return err
+	}
+
+	out, err := filepath.Abs(out)
+	if err != nil {
+		fmt.Printf("backup bcchain err: %s\n", err)
+		return err
+	}
+	if _, err = os.Lstat(out); err == nil {
+		err = fmt.Errorf("%s already exists", out)
+		fmt.Printf("backup bcchain err: %s\n", err)
+		return err
+	}
+
+	manifest, err := backupByAdmin(out)
+	if err == errAdminUnavailable {
+		fmt.Println("bcchain is not running, backup state db directly")
+		manifest, err = backupOffline(out, path.Join(dbDir, common.GlobalConfig.DBName))
+	}
+	if err != nil {
+		fmt.Printf("backup bcchain err: %s\n", err)
+		return err
+	}
+
+	fmt.Printf("backup chainID=%s height=%d appHash=%s to %s\n", manifest.ChainID, manifest.Height, manifest.AppHash, out)
+	return nil
+}
+
+var errAdminUnavailable = errors.New("admin address is unavailable")
+
+// adminHeader must be set on admin requests, together with the JSON body it makes the request
+// non-simple, so a browser page can't send it to admin address without a CORS preflight,
+// which admin server never grants.
+const adminHeader = "X-Bcchain-Admin"
+
+type backupRequest struct {
+	Out string `json:"out"` // absolute path of backup directory, it must not exist
+}
+
+func backupByAdmin(out string) (*statedbhelper.BackupManifest, error) {
+	data, err := json.Marshal(backupRequest{Out: out})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+common.GlobalConfig.AdminAddress+"/backup", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(adminHeader, "backup")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errAdminUnavailable
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(strings.TrimSpace(string(body)))
+	}
+
+	manifest := new(statedbhelper.BackupManifest)
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func adminRunning() bool {
+	conn, err := net.DialTimeout("tcp", common.GlobalConfig.AdminAddress, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func backupOffline(out, dbPath string) (*statedbhelper.BackupManifest, error) {
+	if err := statedbhelper.InitReadOnly(dbPath); err != nil {
+		return nil, err
+	}
+	return statedbhelper.Backup(out, dbPath)
+}
+
+//serveAdmin 启动管理服务，只应监听本机地址
+func serveAdmin(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/backup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// 只接受带自定义头的 JSON 请求，浏览器跨域发送这类请求必须先通过预检
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if r.Header.Get(adminHeader) != "backup" || mediaType != "application/json" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var req backupRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out := req.Out
+		if !filepath.IsAbs(out) {
+			http.Error(w, "out must be an absolute path", http.StatusBadRequest)
+			return
+		}
+		if _, err := os.Lstat(out); !os.IsNotExist(err) {
+			http.Error(w, out+" already exists", http.StatusConflict)
+			return
+		}
+
+		manifest, err := statedbhelper.Backup(out, common.GlobalConfig.DBName)
+		if err != nil {
+			logger.Error("backup failed", "out", out, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("backup finished", "out", out, "height", manifest.Height)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manifest)
+	})
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("admin server stopped", "addr", addr, "err", err)
+		}
+	}()
+}
+
+//restore 校验备份的 manifest 后替换状态库，原状态库改名保留
+func restore(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	dbDir, _ := cmd.Flags().GetString("dbDir")
+	if from == "" {
+		err := errors.New("flag --from is required")
+		fmt.Printf("restore bcchain err: %s\n", err)
+		return err
+	}
+
+	if adminRunning() {
+		err := errors.New("bcchain is running, stop it before restoring")
+		fmt.Printf("restore bcchain err: %s\n", err)
+		return err
+	}
+
+	manifest, err := statedbhelper.VerifyBackup(from)
+	if err != nil {
+		fmt.Printf("restore bcchain verify backup err: %s\n", err)
+		return err
+	}
+
+	dbPath := path.Join(dbDir, common.GlobalConfig.DBName)
+	if !strings.HasPrefix(dbPath, "/") {
+		dbPath = filepath.Join(os.Getenv("HOME"), dbPath)
+	}
+
+	// 已有状态库时，链 ID 必须与备份一致
+	if err := statedbhelper.InitReadOnly(dbPath); err == nil {
+		chainID := statedbhelper.GetChainID()
+		statedbhelper.Close()
+		if chainID != "" && chainID != manifest.ChainID {
+			err = fmt.Errorf("chain ID of state db is %s, backup is %s", chainID, manifest.ChainID)
+			fmt.Printf("restore bcchain err: %s\n", err)
+			return err
+		}
+	}
+
+	suffix := ".bak-" + strconv.FormatInt(time.Now().Unix(), 10)
+	for _, ext := range []string{".db", ".snapshot.db"} {
+		src := filepath.Join(from, manifest.DBName+ext)
+		dst := dbPath + ext
+
+		if err := restoreDir(src, dst, dst+suffix); err != nil {
+			fmt.Printf("restore bcchain err: %s\n", err)
+			return err
+		}
+	}
+
+	// 交易索引和变更集 outbox 不在备份中，需与恢复后的状态库对齐
+	if err := restoreTxIndex(dbDir, manifest.Height); err != nil {
+		fmt.Printf("restore bcchain tx index err: %s\n", err)
+		return err
+	}
+	if common.GlobalConfig.ChangeSetOutbox != "" {
+		if err := statedbhelper.RestoreChangeSetOutbox(common.GlobalConfig.ChangeSetOutbox, manifest.TransactionID); err != nil {
+			fmt.Printf("restore bcchain change set outbox err: %s\n", err)
+			return err
+		}
+	}
+
+	fmt.Printf("restore chainID=%s height=%d appHash=%s from %s\n", manifest.ChainID, manifest.Height, manifest.AppHash, from)
+	return nil
+}
+
+//restoreTxIndex 删除索引库中高于恢复高度的交易，索引落后于备份时清空索引，未开启索引时不处理
+func restoreTxIndex(dbDir string, height int64) error {
+	if common.GlobalConfig.TxIndexDB == "" {
+		return nil
+	}
+
+	if err := txindex.Init(common.GlobalConfig.DBBackend, path.Join(dbDir, common.GlobalConfig.TxIndexDB)); err != nil {
+		return err
+	}
+	defer txindex.Close()
+
+	return txindex.Restore(height)
+}
+
+// restoreDir copies src beside dst first, then moves dst aside and renames the copy to dst.
+func restoreDir(src, dst, bak string) error {
+	tmp := dst + ".restoring"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	if err := fs.CopyDir(src, tmp, "", ""); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		if err := os.Rename(dst, bak); err != nil {
+			return err
+		}
+		fmt.Printf("%s is moved to %s\n", dst, bak)
+	}
+
+	return os.Rename(tmp, dst)
+}
@@ -4,12 +4,12 @@ import (
 	"fmt"
 	bcchain "github.com/bcbchain/bcbchain/abciapp/app"
 	"github.com/bcbchain/bcbchain/abciapp/common"
+	"github.com/bcbchain/bcbchain/abciapp/server"
 	"github.com/bcbchain/bcbchain/smcdocker"
 	"github.com/bcbchain/bcbchain/version"
 	"os"
 	"path/filepath"
 
-	"github.com/bcbchain/bclib/tendermint/abci/server"
 	cmn "github.com/bcbchain/bclib/tendermint/tmlibs/common"
 	tmlog "github.com/bcbchain/bclib/tendermint/tmlibs/log"
 	"github.com/spf13/cobra"
@@ -47,12 +47,17 @@ func addCommands() {
 	RootCmd.AddCommand(resetCmd)
 	RootCmd.AddCommand(initCmd)
 	RootCmd.AddCommand(rollbackCmd)
+	RootCmd.AddCommand(statediffCmd)
+	RootCmd.AddCommand(backupCmd)
+	RootCmd.AddCommand(restoreCmd)
 }
 
 var (
 	debug     bool
 	followURL string
 	rollBack  int
+	toHeight  int64
+	dryRun    bool
 	dbDir     string
 )
 
@@ -60,7 +65,19 @@ func addFlags() {
 	startCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "run mode of debug flag")
 	initCmd.PersistentFlags().StringVarP(&followURL, "follow", "f", "", "Main nodes to follow, split by comma(only for follower)")
 	rollbackCmd.PersistentFlags().IntVarP(&rollBack, "rollback", "r", 1, "rollback to dest")
+	rollbackCmd.PersistentFlags().Int64Var(&toHeight, "to-height", 0, "rollback to the block height, overrides rollback")
+	rollbackCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print keys to change and app hash after rollback without rolling back")
 	rollbackCmd.PersistentFlags().StringVarP(&dbDir, "dbDir", "d", "", "levelDB dir")
+	statediffCmd.PersistentFlags().StringP("dbDir", "d", "", "levelDB dir")
+	statediffCmd.PersistentFlags().String("dbDir2", "", "levelDB dir to compare with, heights are ignored if it's set")
+	statediffCmd.PersistentFlags().Int64("from-height", 0, "block height to compare from")
+	statediffCmd.PersistentFlags().Int64("to-height", 0, "block height to compare to")
+	statediffCmd.PersistentFlags().String("prefix", "/", "compare keys with prefix only")
+	statediffCmd.PersistentFlags().Bool("raw", false, "print values without decoding")
+	backupCmd.PersistentFlags().String("out", "", "dir to write backup")
+	backupCmd.PersistentFlags().StringP("dbDir", "d", "", "levelDB dir, used when bcchain is not running")
+	restoreCmd.PersistentFlags().String("from", "", "dir of backup")
+	restoreCmd.PersistentFlags().StringP("dbDir", "d", "", "levelDB dir")
 }
 
 var versionCmd = &cobra.Command{
@@ -151,6 +168,8 @@ func cmdStart(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	serveAdmin(common.GlobalConfig.AdminAddress)
+
 	smcdocker.Debug = debug
 	// Wait forever
 	//nolint
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/bcbchain/bcbchain/abciapp/common"
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
-	"fmt"
+	"github.com/bcbchain/bcbchain/common/txindex"
+	"github.com/bcbchain/bcbchain/smcbuilder"
 	"github.com/spf13/cobra"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
 )
 
 //rollback 状态库回滚，最多回滚100区块
@@ -17,6 +25,18 @@ func rollback(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	toHeight, err := cmd.Flags().GetInt64("to-height")
+	if err != nil {
+		fmt.Printf("rollback bcchain parse to-height err: %s\n", err)
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		fmt.Printf("rollback bcchain parse dry-run err: %s\n", err)
+		return err
+	}
+
 	dbDir, err := cmd.Flags().GetString("dbDir")
 	if err != nil {
 		fmt.Printf("rollback bcchain parse dbDir err: %s\n", err)
@@ -25,11 +45,116 @@ func rollback(cmd *cobra.Command, args []string) error {
 
 	dbPath := path.Join(dbDir, common.GlobalConfig.DBName)
 
-	statedbhelper.Init(dbPath, 100)
+	statedbhelper.InitWithBackend(common.GlobalConfig.DBBackend, dbPath, common.GlobalConfig.MaxSnapshotCount())
+
+	// 按高度回滚时换算出需要回滚的交易数量
+	lastTransID := statedbhelper.LastTransactionID()
+	targetTransID := lastTransID - int64(rollbackNum)
+	if cmd.Flags().Changed("to-height") {
+		if targetTransID, err = statedbhelper.TransactionIDOfHeight(toHeight); err != nil {
+			fmt.Printf("rollback bcchain to height %d err: %s\n", toHeight, err)
+			return err
+		}
+	}
+	if targetTransID == lastTransID {
+		fmt.Println("nothing to rollback")
+		return nil
+	}
+	if targetTransID < 0 || targetTransID > lastTransID {
+		err = errors.New("invalid rollback number")
+		fmt.Printf("rollback bcchain err: %s\n", err)
+		return err
+	}
+
+	binDirs, err := smcbuilder.IntroducedBinDirs(filepath.Join(os.Getenv("HOME"), ".build"), targetTransID)
+	if err != nil {
+		fmt.Printf("rollback bcchain err: %s\n", err)
+		return err
+	}
+
+	if dryRun {
+		return printRollbackPreview(targetTransID, lastTransID, binDirs)
+	}
+
+	statedbhelper.RollbackStateDB(int(lastTransID - targetTransID))
+
+	for _, dir := range binDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("rollback bcchain remove %s err: %s\n", dir, err)
+			return err
+		}
+	}
+
+	appState := statedbhelper.GetWorldAppState(0, 0)
+	if err := rollbackTxIndex(dbDir, appState.BlockHeight); err != nil {
+		fmt.Printf("rollback bcchain tx index err: %s\n", err)
+		return err
+	}
 
-	statedbhelper.RollbackStateDB(rollbackNum)
+	fmt.Println(appState)
+
+	return nil
+}
+
+//rollbackTxIndex 删除索引库中高于回滚后高度的交易，未开启索引时不处理
+func rollbackTxIndex(dbDir string, height int64) error {
+	if common.GlobalConfig.TxIndexDB == "" {
+		return nil
+	}
 
-	fmt.Println(statedbhelper.GetWorldAppState(0, 0))
+	if err := txindex.Init(common.GlobalConfig.DBBackend, path.Join(dbDir, common.GlobalConfig.TxIndexDB)); err != nil {
+		return err
+	}
+	defer txindex.Close()
+
+	return txindex.Rollback(height)
+}
+
+//printRollbackPreview 打印回滚后将发生变化的键、AppHash 以及将删除的合约程序，不修改状态库
+func printRollbackPreview(targetTransID, lastTransID int64, binDirs []string) error {
+	keys, err := statedbhelper.GetChangedKeys(targetTransID, lastTransID)
+	if err != nil {
+		fmt.Printf("rollback bcchain err: %s\n", err)
+		return err
+	}
+
+	fmt.Printf("rollback %d transactions, transaction ID %d => %d\n", lastTransID-targetTransID, lastTransID, targetTransID)
+	fmt.Println("keys to change:")
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "/") {
+			continue
+		}
+
+		before, err := statedbhelper.GetFromDB(k)
+		if err != nil {
+			return err
+		}
+		after, err := statedbhelper.GetAtTransaction(k, targetTransID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case len(before) == 0 && len(after) != 0:
+			fmt.Println("  + " + k)
+		case len(before) != 0 && len(after) == 0:
+			fmt.Println("  - " + k)
+		case !bytes.Equal(before, after):
+			fmt.Println("  ~ " + k)
+		}
+	}
+
+	appState, err := statedbhelper.GetWorldAppStateAt(targetTransID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("height after rollback: %d\n", appState.BlockHeight)
+	fmt.Printf("app hash after rollback: %s\n", strings.ToUpper(hex.EncodeToString(appState.AppHash)))
+
+	fmt.Println("contract binaries to remove:")
+	for _, dir := range binDirs {
+		fmt.Println("  " + dir)
+	}
 
 	return nil
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bcbchain/bcbchain/abciapp/common"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/statedb"
+	"github.com/spf13/cobra"
+	"path"
+	"unicode/utf8"
+)
+
+var statediffCmd = &cobra.Command{
+	Use:   "statediff",
+	Short: "Compare state of two heights or two database directories",
+	Long: "Compare state of two heights of one database with --from-height and --to-height, " +
+		"or state of two database directories with --dbDir and --dbDir2",
+	Args: cobra.ExactArgs(0),
+	RunE: stateDiff,
+}
+
+//stateDiff 比较状态库两个高度或两个状态库目录的差异，只读打开状态库
+func stateDiff(cmd *cobra.Command, args []string) error {
+	dbDir, _ := cmd.Flags().GetString("dbDir")
+	dbDir2, _ := cmd.Flags().GetString("dbDir2")
+	fromHeight, _ := cmd.Flags().GetInt64("from-height")
+	toHeight, _ := cmd.Flags().GetInt64("to-height")
+	prefix, _ := cmd.Flags().GetString("prefix")
+	raw, _ := cmd.Flags().GetBool("raw")
+
+	var diffs []statedb.KeyDiff
+	var err error
+	if dbDir2 != "" {
+		diffs, err = diffDirs(dbDir, dbDir2, prefix)
+	} else {
+		diffs, err = diffHeights(dbDir, fromHeight, toHeight, prefix)
+	}
+	if err != nil {
+		fmt.Printf("statediff err: %s\n", err)
+		return err
+	}
+
+	printStateDiff(diffs, raw)
+	return nil
+}
+
+func diffDirs(dbDir, dbDir2, prefix string) ([]statedb.KeyDiff, error) {
+	from, err := statedb.OpenReadOnly(path.Join(dbDir, common.GlobalConfig.DBName))
+	if err != nil {
+		return nil, err
+	}
+	defer from.Close()
+
+	to, err := statedb.OpenReadOnly(path.Join(dbDir2, common.GlobalConfig.DBName))
+	if err != nil {
+		return nil, err
+	}
+	defer to.Close()
+
+	return statedb.DiffDB(from, to, prefix), nil
+}
+
+func diffHeights(dbDir string, fromHeight, toHeight int64, prefix string) ([]statedb.KeyDiff, error) {
+	if fromHeight <= 0 || toHeight <= 0 {
+		return nil, errors.New("both from-height and to-height must be set when dbDir2 is empty")
+	}
+
+	if err := statedbhelper.InitReadOnly(path.Join(dbDir, common.GlobalConfig.DBName)); err != nil {
+		return nil, err
+	}
+
+	fromTransID, err := statedbhelper.TransactionIDOfHeight(fromHeight)
+	if err != nil {
+		return nil, err
+	}
+	toTransID, err := statedbhelper.TransactionIDOfHeight(toHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	return statedbhelper.GetStateDiff(fromTransID, toTransID, prefix)
+}
+
+func printStateDiff(diffs []statedb.KeyDiff, raw bool) {
+	format := decodeStateValue
+	if raw {
+		format = rawStateValue
+	}
+
+	var added, removed, changed int
+	for _, d := range diffs {
+		switch d.Type {
+		case statedb.DiffAdded:
+			added++
+			fmt.Println("+ " + d.Key)
+			fmt.Println("    new: " + format(d.Key, d.New))
+		case statedb.DiffRemoved:
+			removed++
+			fmt.Println("- " + d.Key)
+			fmt.Println("    old: " + format(d.Key, d.Old))
+		case statedb.DiffChanged:
+			changed++
+			fmt.Println("~ " + d.Key)
+			fmt.Println("    old: " + format(d.Key, d.Old))
+			fmt.Println("    new: " + format(d.Key, d.New))
+		}
+	}
+
+	fmt.Printf("%d added, %d removed, %d changed\n", added, removed, changed)
+}
+
+func rawStateValue(key string, value []byte) string {
+	if utf8.Valid(value) {
+		return string(value)
+	}
+	return "0x" + hex.EncodeToString(value)
+}
+
+//decodeStateValue 按键的格式解析已知结构的值并输出为 JSON，无法解析时输出原始值
+func decodeStateValue(key string, value []byte) string {
+	decoded := statedbhelper.DecodeValue(key, value)
+	if decoded.Type == "" || decoded.Type == statedbhelper.TypeBytes {
+		return rawStateValue(key, value)
+	}
+
+	bz, err := json.Marshal(decoded.Value)
+	if err != nil {
+		return rawStateValue(key, value)
+	}
+	return string(bz)
+}
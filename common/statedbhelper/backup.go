@@ -0,0 +1,123 @@
+package statedbhelper
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bcbchain/bcbchain/statedb"
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+//BackupManifest describes the block a backup was taken at, it's saved as manifest.json in backup dir
+type BackupManifest struct {
+	ChainID       string `json:"chainID"`
+	Height        int64  `json:"height"`
+	AppHash       string `json:"appHash"` // upper case hex
+	TransactionID int64  `json:"transactionID"`
+	DBName        string `json:"dbName"` // db files in backup dir are <dbName>.db and <dbName>.snapshot.db
+	Time          string `json:"time"`
+}
+
+func manifestPath(dir string) string {
+	return filepath.Join(dir, "manifest.json")
+}
+
+//Backup copies state db at the last committed block into dir while blocks keep committing
+func Backup(dir, dbName string) (*BackupManifest, error) {
+	name := filepath.Base(dbName)
+	transactionID, err := stateDB.Backup(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := statedb.OpenReadOnly(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Close()
+
+	appState, err := appStateOf(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{
+		ChainID:       chainIDOf(backup),
+		Height:        appState.BlockHeight,
+		AppHash:       strings.ToUpper(hex.EncodeToString(appState.AppHash)),
+		TransactionID: transactionID,
+		DBName:        name,
+		Time:          time.Now().UTC().Format(time.RFC3339),
+	}
+
+	value, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(manifestPath(dir), value, 0644); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+//VerifyBackup reads manifest of backup in dir and checks it against world app state of the backup
+func VerifyBackup(dir string) (*BackupManifest, error) {
+	value, err := ioutil.ReadFile(manifestPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := new(BackupManifest)
+	if err := jsoniter.Unmarshal(value, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.DBName == "" || filepath.Base(manifest.DBName) != manifest.DBName {
+		return nil, fmt.Errorf("invalid db name %q in manifest", manifest.DBName)
+	}
+
+	backup, err := statedb.OpenReadOnly(filepath.Join(dir, manifest.DBName))
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Close()
+
+	appState, err := appStateOf(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case appState.BlockHeight != manifest.Height:
+		return nil, fmt.Errorf("height of backup is %d, manifest says %d", appState.BlockHeight, manifest.Height)
+	case !strings.EqualFold(hex.EncodeToString(appState.AppHash), manifest.AppHash):
+		return nil, fmt.Errorf("app hash of backup is %X, manifest says %s", appState.AppHash, manifest.AppHash)
+	case chainIDOf(backup) != manifest.ChainID:
+		return nil, fmt.Errorf("chain ID of backup is %s, manifest says %s", chainIDOf(backup), manifest.ChainID)
+	case backup.LastVersion() != manifest.TransactionID:
+		return nil, fmt.Errorf("transaction ID of backup is %d, manifest says %d",
+			backup.LastVersion(), manifest.TransactionID)
+	}
+
+	return manifest, nil
+}
+
+func appStateOf(sdb *statedb.StateDB) (*abci.AppState, error) {
+	value := sdb.Get(keyOfWorldAppState())
+	if len(value) == 0 {
+		return nil, errors.New("world app state is empty")
+	}
+
+	var appState abci.AppState
+	if err := jsoniter.Unmarshal(value, &appState); err != nil {
+		return nil, err
+	}
+	return &appState, nil
+}
@@ -0,0 +1,72 @@
+package statedbhelper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bcbchain/bcbchain/statedb"
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+//OpenChangeSetOutbox appends committed change sets to the outbox file, relative path is in HOME like state db,
+//change sets of the last retain blocks are kept at least, 0 keeps all
+func OpenChangeSetOutbox(path string, retain int) error {
+	if !strings.HasPrefix(path, "/") {
+		path = filepath.Join(os.Getenv("HOME"), path)
+	}
+
+	outbox, err := statedb.OpenOutbox(path, retain)
+	if err != nil {
+		return err
+	}
+
+	if err = stateDB.SetOutbox(outbox); err != nil {
+		outbox.Close()
+	}
+	return err
+}
+
+//RestoreChangeSetOutbox prepares the outbox file for state db restored from backup at transactionID,
+//it must be called before the outbox is opened
+func RestoreChangeSetOutbox(path string, transactionID int64) error {
+	if !strings.HasPrefix(path, "/") {
+		path = filepath.Join(os.Getenv("HOME"), path)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	outbox, err := statedb.OpenOutbox(path, 0)
+	if err != nil {
+		return err
+	}
+	defer outbox.Close()
+
+	return outbox.Restore(transactionID)
+}
+
+//SubscribeChangeSets subscribes change sets committed from now on
+func SubscribeChangeSets(subscriber string, bufferSize int) (<-chan *statedb.ChangeSet, error) {
+	return stateDB.Subscribe(subscriber, bufferSize)
+}
+
+//UnsubscribeChangeSets removes the subscription
+func UnsubscribeChangeSets(subscriber string) {
+	stateDB.Unsubscribe(subscriber)
+}
+
+// heightOfState reads block height of change sets from world app state
+func heightOfState(get func(key string) []byte) int64 {
+	value := get(keyOfWorldAppState())
+	if len(value) == 0 {
+		return 0
+	}
+
+	var appState abci.AppState
+	if err := jsoniter.Unmarshal(value, &appState); err != nil {
+		return 0
+	}
+	return appState.BlockHeight
+}
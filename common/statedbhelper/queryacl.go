@@ -0,0 +1,48 @@
+package statedbhelper
+
+import (
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	"github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// access of keys matched by query rule
+const (
+	QueryPublic = "public" // anyone can query
+	QuerySigner = "signer" // anyone can query without signature, signer of a signed query must be an address segment of key
+	QueryOwner  = "owner"  // signer of query must be an address segment of key
+	QueryOrg    = "org"    // signer of query must be owner or signer of an organization whose ID is a segment of key
+	QueryDenied = "denied" // nobody can query
+)
+
+//QueryRule is access of keys with Prefix, "*" segment of Prefix matches any segment,
+//the rule with the longest matched prefix is applied.
+type QueryRule struct {
+	Prefix string `json:"prefix"`
+	Access string `json:"access"`
+}
+
+//IsOrgMember returns whether addr is owner or signer of organization
+func IsOrgMember(transID, txID int64, orgID string, addr types.Address) bool {
+	value := get(transID, txID, keyOfOrganization(orgID))
+	if len(value) == 0 {
+		return false
+	}
+
+	org := new(std.Organization)
+	if err := jsoniter.Unmarshal(value, org); err != nil {
+		panic("state db helper get org err: " + err.Error())
+	}
+	if org.OrgOwner == addr {
+		return true
+	}
+
+	chainID := GetChainID()
+	for _, pubKey := range org.Signers {
+		if crypto.PubKeyEd25519FromBytes(pubKey).Address(chainID) == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package statedbhelper
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bcbchain/bclib/algorithm"
+	tx2 "github.com/bcbchain/bclib/tx/v2"
+	tx3 "github.com/bcbchain/bclib/tx/v3"
+	"github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+// limits of scheduled calls
+const (
+	ScheduleNotePrefix  = "schedule:" // note of a signed tx scheduled at height h is "schedule:h"
+	MaxScheduleDelay    = 5000000     // max count of blocks between scheduling height and target height
+	MaxCallsPerSchedule = 100         // max count of calls scheduled at the same height
+)
+
+//ScheduledCall is a signed tx which is run at EndBlock of target height, its nonce is used when
+//it's scheduled, and fee of its gas limit is prepaid and given back before it's run.
+type ScheduledCall struct {
+	TxHash   string        `json:"txHash"`   // hash of scheduling tx, hex in upper case
+	CallHash string        `json:"callHash"` // hash of call run at target height, it's hash of "<tx>@<height>"
+	Tx       string        `json:"tx"`
+	Sender   types.Address `json:"sender"`
+	Height   int64         `json:"height"`
+	Token    types.Address `json:"token"`
+	Prepaid  bn.Number     `json:"prepaid"`
+}
+
+//NewScheduledCall creates call of signed tx scheduled at height
+func NewScheduledCall(tx string, sender types.Address, height int64) *ScheduledCall {
+	return &ScheduledCall{
+		TxHash:   fmt.Sprintf("%X", algorithm.CalcCodeHash(tx)),
+		CallHash: fmt.Sprintf("%X", algorithm.CalcCodeHash(tx+"@"+strconv.FormatInt(height, 10))),
+		Tx:       tx,
+		Sender:   sender,
+		Height:   height,
+	}
+}
+
+//ScheduleHeightOf returns target height of tx if its note schedules it
+func ScheduleHeightOf(note string) (int64, bool) {
+	if !strings.HasPrefix(note, ScheduleNotePrefix) {
+		return 0, false
+	}
+
+	height, err := strconv.ParseInt(strings.TrimPrefix(note, ScheduleNotePrefix), 10, 64)
+	if err != nil || height <= 0 {
+		return 0, false
+	}
+	return height, true
+}
+
+//ScheduleCall prepays fee of call from sender's balance of genesis token and saves call,
+//nonce of call must be set by caller.
+func ScheduleCall(transID, txID int64, call *ScheduledCall, gasLimit, currentHeight int64) error {
+	if call.Height <= currentHeight || call.Height-currentHeight > MaxScheduleDelay {
+		return fmt.Errorf("scheduled height must be in (%d, %d]", currentHeight, currentHeight+MaxScheduleDelay)
+	}
+	if gasLimit <= 0 {
+		return errors.New("gas limit of scheduled call must be positive")
+	}
+
+	calls := GetScheduledCalls(transID, txID, call.Height)
+	if len(calls) >= MaxCallsPerSchedule {
+		return fmt.Errorf("calls scheduled at height %d are full", call.Height)
+	}
+
+	token := GetGenesisToken()
+	call.Token = token.Address
+	call.Prepaid = bn.N(gasLimit).MulI(token.GasPrice)
+	balance := BalanceOf(transID, txID, call.Sender, call.Token)
+	if balance.IsLessThan(call.Prepaid) {
+		return errors.New("insufficient balance to prepay fee of scheduled call")
+	}
+	SetBalance(transID, txID, call.Sender, call.Token, balance.Sub(call.Prepaid))
+
+	SetScheduledCalls(transID, txID, call.Height, append(calls, *call))
+	return nil
+}
+
+//ScheduleSignedTx schedules signed tx handed to contract, note of tx must schedule it as if it's
+//delivered, so sender agrees on the call and its height. Nonce of tx is used and fee of its gas
+//limit is prepaid by sender.
+func ScheduleSignedTx(transID, txID int64, tx string, currentHeight int64) (*ScheduledCall, error) {
+	chainID := GetChainID()
+	tx2.Init(chainID)
+	transaction, pubKey, err := tx2.TxParse(tx)
+	if err != nil {
+		tx3.Init(chainID)
+		if transaction, pubKey, err = tx3.TxParse(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	height, ok := ScheduleHeightOf(transaction.Note)
+	if !ok {
+		return nil, errors.New("note of tx doesn't schedule it")
+	}
+
+	sender := pubKey.Address(chainID)
+	if _, err := SetAccountNonce(transID, txID, sender, transaction.Nonce); err != nil {
+		return nil, err
+	}
+
+	call := NewScheduledCall(tx, sender, height)
+	if err := ScheduleCall(transID, txID, call, transaction.GasLimit, currentHeight); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+//GetScheduledCalls gets calls scheduled at height in order of scheduling
+func GetScheduledCalls(transID, txID, height int64) []ScheduledCall {
+	calls := make([]ScheduledCall, 0)
+	value := get(transID, txID, keyOfScheduledCalls(height))
+	if len(value) == 0 {
+		return calls
+	}
+
+	if err := jsoniter.Unmarshal(value, &calls); err != nil {
+		panic(err)
+	}
+	return calls
+}
+
+//SetScheduledCalls sets calls scheduled at height, empty calls deletes the key
+func SetScheduledCalls(transID, txID, height int64, calls []ScheduledCall) {
+	if len(calls) == 0 {
+		set(transID, txID, keyOfScheduledCalls(height), nil)
+		return
+	}
+
+	value, err := jsoniter.Marshal(calls)
+	if err != nil {
+		panic(err)
+	}
+	set(transID, txID, keyOfScheduledCalls(height), value)
+}
@@ -0,0 +1,143 @@
+package statedbhelper
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// TypeBytes is type of values which don't match any schema, they're decoded as hex string
+const TypeBytes = "bytes"
+
+//ValueSchema declares type of values of keys matched by Pattern, "*" segment of Pattern matches any segment
+type ValueSchema struct {
+	Pattern string
+	Type    string
+	decode  func(value []byte) (interface{}, error)
+}
+
+//DecodedValue is value of key decoded by its schema
+type DecodedValue struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+var schemas []ValueSchema
+
+//RegisterSchema registers type of prototype as type of values of keys matched by pattern,
+//values are decoded as JSON.
+func RegisterSchema(pattern string, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	RegisterSchemaFunc(pattern, t.String(), func(value []byte) (interface{}, error) {
+		v := reflect.New(t)
+		if err := jsoniter.Unmarshal(value, v.Interface()); err != nil {
+			return nil, err
+		}
+		return v.Elem().Interface(), nil
+	})
+}
+
+//RegisterSchemaFunc registers type of values of keys matched by pattern with its decoder
+func RegisterSchemaFunc(pattern, typeName string, decode func(value []byte) (interface{}, error)) {
+	schemas = append(schemas, ValueSchema{Pattern: pattern, Type: typeName, decode: decode})
+}
+
+//SchemaOf returns schema of key, the pattern with the fewest "*" segments is preferred
+func SchemaOf(key string) (schema ValueSchema, ok bool) {
+	ks := strings.Split(key, "/")
+	wildcards := len(ks) + 1
+	for _, s := range schemas {
+		if n, match := matchPattern(s.Pattern, ks); match && n < wildcards {
+			schema, ok, wildcards = s, true, n
+		}
+	}
+	return
+}
+
+//DecodeValue decodes value of key by its schema, value which doesn't match any schema or fails
+//to decode is kept as hex string of TypeBytes, empty value is decoded as nil.
+func DecodeValue(key string, value []byte) DecodedValue {
+	if len(value) == 0 {
+		return DecodedValue{Key: key}
+	}
+
+	if schema, ok := SchemaOf(key); ok {
+		if v, err := schema.decode(value); err == nil {
+			return DecodedValue{Key: key, Type: schema.Type, Value: v}
+		}
+	}
+	return DecodedValue{Key: key, Type: TypeBytes, Value: "0x" + hex.EncodeToString(value)}
+}
+
+// matchPattern returns count of "*" segments of pattern if key segments match it
+func matchPattern(pattern string, ks []string) (int, bool) {
+	ps := strings.Split(pattern, "/")
+	if len(ps) != len(ks) {
+		return 0, false
+	}
+
+	n := 0
+	for i := range ps {
+		if ps[i] == "*" {
+			n++
+		} else if ps[i] != ks[i] {
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+type accountNonce struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+func init() {
+	const seg = "*"
+
+	RegisterSchema(keyOfWorldAppState(), abci.AppState{})
+	RegisterSchema(keyOfGenesisChainID(), "")
+	RegisterSchema(std.KeyOfGenesisChainVersion(), int64(0))
+	RegisterSchema(keyOfGenesisOrgID(), "")
+	RegisterSchema(keyOfGasPriceRatio(), "")
+	RegisterSchema(std.KeyOfGenesisToken(), std.Token{})
+	RegisterSchema(std.KeyOfGenesisContractAddrList(), []types.Address{})
+	RegisterSchema(keyOfRewardStrategy(), []RewardStrategy{})
+	RegisterSchema(keyOfBlockLimits(), []BlockLimits{})
+	RegisterSchema("/schedule/"+seg, []ScheduledCall{})
+	RegisterSchema(keyOfSponsorship(seg), int64(0))
+
+	RegisterSchema(KeyOfAccount(seg), []string{})
+	RegisterSchema(KeyOfAccountNonce(seg), accountNonce{})
+	RegisterSchema(KeyOfAccountToken(seg, seg), std.AccountInfo{})
+	RegisterSchema(std.KeyOfAccountContracts(seg), []types.Address{})
+
+	RegisterSchema(KeyOfToken(seg), std.Token{})
+	RegisterSchema(std.KeyOfAllToken(), []types.Address{})
+	RegisterSchema(std.KeyOfTokenWithName(seg), types.Address(""))
+	RegisterSchema(std.KeyOfTokenWithSymbol(seg), types.Address(""))
+
+	RegisterSchema(keyOfContract(seg), std.Contract{})
+	RegisterSchema(keyOfContractMeta(seg), std.ContractMeta{})
+	RegisterSchema(keyOfContractOrgID(seg, seg), std.ContractVersionList{})
+	RegisterSchema(std.KeyOfAllContracts(), []types.Address{})
+	RegisterSchema(keyOfMineContracts(), []std.MineContract{})
+	RegisterSchema(keyOfGenesisContract(), types.Address(""))
+	RegisterSchema(keyOfContractWithHeight(seg), []std.ContractWithEffectHeight{})
+	RegisterSchema(keyOfOrganization(seg), std.Organization{})
+
+	RegisterSchema(keyOfValidators(), []string{})
+	RegisterSchema(keyOfValidator(seg), Validator{})
+	RegisterSchema(keyOfBlackList(seg), "")
+
+	RegisterSchema("/bvm/status", false)
+	RegisterSchema("/bvm/contract/"+seg, std.BvmContract{})
+	RegisterSchemaFunc("/bvm/"+seg+"/storage/"+seg, "bvm.Word", func(value []byte) (interface{}, error) {
+		return "0x" + hex.EncodeToString(value), nil
+	})
+}
@@ -0,0 +1,77 @@
+package statedbhelper
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+func TestDecodeValue(t *testing.T) {
+	token := std.Token{Address: "localToken", Owner: "localOwner", Name: "token", Symbol: "TK", TotalSupply: bn.N(1000000)}
+	balance := std.AccountInfo{Address: "localToken", Balance: bn.N(100)}
+	contract := std.Contract{Address: "localContract", Name: "mycoin", Version: "1.0", OrgID: "orgID"}
+
+	cases := []struct {
+		name     string
+		key      string
+		value    interface{}
+		typeName string
+	}{
+		{"token", KeyOfToken("localToken"), token, "std.Token"},
+		{"balance", KeyOfAccountToken("localAddr", "localToken"), balance, "std.AccountInfo"},
+		{"contract", keyOfContract("localContract"), contract, "std.Contract"},
+		{"bvm storage", "/bvm/localBvm/storage/0x01", []byte{0x0a, 0x0b}, "bvm.Word"},
+		// 未注册的键按原始字节以十六进制返回
+		{"unknown", "/unknown/key", []byte{0x01, 0xff}, TypeBytes},
+		// 注册的键解码失败时同样回退为原始字节
+		{"bad token", KeyOfToken("localToken"), []byte("{bad"), TypeBytes},
+	}
+
+	for _, c := range cases {
+		raw, ok := c.value.([]byte)
+		if !ok {
+			raw, _ = jsoniter.Marshal(c.value)
+		}
+
+		got := DecodeValue(c.key, raw)
+		if got.Key != c.key || got.Type != c.typeName {
+			t.Errorf("%s: key %s, type %s", c.name, got.Key, got.Type)
+			continue
+		}
+
+		// 以 JSON 比较解码结果与原值
+		want := c.value
+		if ok {
+			want = "0x" + hex.EncodeToString(raw)
+		}
+		if gotJSON, wantJSON := jsonOf(got.Value), jsonOf(want); gotJSON != wantJSON {
+			t.Errorf("%s: value %s, want %s", c.name, gotJSON, wantJSON)
+		}
+	}
+
+	if got := DecodeValue("/unknown/key", nil); got.Type != "" || got.Value != nil {
+		t.Errorf("empty value: %v", got)
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	// 通配符最少的模式优先
+	if s, ok := SchemaOf("/bvm/status"); !ok || s.Pattern != "/bvm/status" {
+		t.Errorf("schema of /bvm/status: %v %v", s.Pattern, ok)
+	}
+	if s, ok := SchemaOf("/bvm/contract/localBvm"); !ok || s.Type != "std.BvmContract" {
+		t.Errorf("schema of bvm contract: %v %v", s.Type, ok)
+	}
+	if _, ok := SchemaOf("/token/localToken/extra"); ok {
+		t.Error("key with more segments matches schema")
+	}
+}
+
+func jsonOf(v interface{}) string {
+	bz, _ := json.Marshal(v)
+	return string(bz)
+}
@@ -0,0 +1,191 @@
+package statedbhelper
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bcbchain/bclib/algorithm"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	"github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+//SponsoredMethod is a method whose fee is paid by sponsor, empty MethodID means all methods of contract
+type SponsoredMethod struct {
+	Contract types.Address `json:"contract"`
+	MethodID string        `json:"methodID,omitempty"` // hex like "44d8ca60"
+}
+
+//SponsorNotePrefix is prefix of note of sponsored tx, the note binds sponsorship to signature of sender
+const SponsorNotePrefix = "sponsor:"
+
+//Sponsorship is signed by sponsor, who agrees to pay fees of sender's txs invoking Methods until
+//total fee reaches Cap. A sponsored tx is a v2/v3 tx with base64 of JSON of sponsorship appended
+//as the 6th part, "<chainID><tx>.v2.<payload>.<1>.<signature>.<sponsorship>", note of the tx signed
+//by sender must be "sponsor:<hash of the 6th part>", see EncodeSponsorship.
+type Sponsorship struct {
+	Sponsor      string            `json:"sponsor"` // public key of sponsor in hex
+	Sender       types.Address     `json:"sender"`
+	Methods      []SponsoredMethod `json:"methods"`
+	Cap          int64             `json:"cap"`                    // max total fee, unit is cong of genesis token
+	ExpireHeight int64             `json:"expireHeight,omitempty"` // 0 means it never expires
+	Signature    string            `json:"signature,omitempty"`    // signature of SignBytes in hex
+
+	note string // note which binds the 6th part of tx
+}
+
+//SponsorSpent is fee paid by sponsor with a sponsorship
+type SponsorSpent struct {
+	ID      string        `json:"id"`
+	Sponsor types.Address `json:"sponsor"`
+	Sender  types.Address `json:"sender"`
+	Fee     int64         `json:"fee"`   // fee of this tx
+	Spent   int64         `json:"spent"` // total fee including this tx
+	Cap     int64         `json:"cap"`
+}
+
+//SplitSponsoredTx splits sponsored tx into tx signed by sender and sponsorship, sponsorship is
+//nil if tx isn't sponsored.
+func SplitSponsoredTx(tx string) (string, *Sponsorship, error) {
+	i := strings.LastIndex(tx, ".")
+	if strings.Count(tx, ".") != 5 || i < 0 {
+		return tx, nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(tx[i+1:])
+	if err != nil {
+		return "", nil, errors.New("invalid sponsorship")
+	}
+	sp := new(Sponsorship)
+	if err := jsoniter.Unmarshal(data, sp); err != nil {
+		return "", nil, errors.New("invalid sponsorship")
+	}
+	sp.note = sponsorNote(tx[i+1:])
+	return tx[:i], sp, nil
+}
+
+//EncodeSponsorship returns the 6th part of sponsored tx and the note which sender must sign with tx
+func EncodeSponsorship(sp *Sponsorship) (part, note string) {
+	bz, err := jsoniter.Marshal(sp)
+	if err != nil {
+		panic(err)
+	}
+	part = base64.StdEncoding.EncodeToString(bz)
+	return part, sponsorNote(part)
+}
+
+//VerifySponsorNote checks that sponsorship split from tx is bound by note signed by sender,
+//sp is nil if tx isn't sponsored, then note mustn't declare a sponsorship.
+func VerifySponsorNote(note string, sp *Sponsorship) error {
+	if sp == nil {
+		if strings.HasPrefix(note, SponsorNotePrefix) {
+			return errors.New("sponsorship of tx is missing")
+		}
+		return nil
+	}
+	if note != sp.note {
+		return errors.New("sponsorship is not signed by sender")
+	}
+	return nil
+}
+
+func sponsorNote(part string) string {
+	return fmt.Sprintf("%s%X", SponsorNotePrefix, algorithm.CalcCodeHash(part))
+}
+
+//SignBytes returns bytes signed by sponsor
+func (sp *Sponsorship) SignBytes(chainID string) []byte {
+	unsigned := *sp
+	unsigned.Signature = ""
+	bz, err := jsoniter.Marshal(unsigned)
+	if err != nil {
+		panic(err)
+	}
+	return append([]byte(chainID), bz...)
+}
+
+//ID returns hash of sponsorship, fee spent is saved by it
+func (sp *Sponsorship) ID(chainID string) string {
+	return fmt.Sprintf("%X", algorithm.CalcCodeHash(string(sp.SignBytes(chainID))))
+}
+
+//SponsorAddress verifies signature of sponsor and returns address of it
+func (sp *Sponsorship) SponsorAddress(chainID string) (types.Address, error) {
+	pubKey, err := hex.DecodeString(strings.TrimPrefix(sp.Sponsor, "0x"))
+	if err != nil || len(pubKey) != len(crypto.PubKeyEd25519{}) {
+		return "", errors.New("invalid public key of sponsor")
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(sp.Signature, "0x"))
+	if err != nil || len(sig) != len(crypto.SignatureEd25519{}) {
+		return "", errors.New("invalid signature of sponsor")
+	}
+
+	pk := crypto.PubKeyEd25519FromBytes(pubKey)
+	if !pk.VerifyBytes(sp.SignBytes(chainID), crypto.SignatureEd25519FromBytes(sig)) {
+		return "", errors.New("verify signature of sponsor failed")
+	}
+	return pk.Address(chainID), nil
+}
+
+//CheckSponsorship checks whether sponsor pays fee of tx, it returns address of sponsor
+func CheckSponsorship(transID, txID int64, sp *Sponsorship, sender types.Address, tx types.Transaction, height int64) (types.Address, error) {
+	chainID := GetChainID()
+	sponsor, err := sp.SponsorAddress(chainID)
+	if err != nil {
+		return "", err
+	}
+	if sp.Sender != sender {
+		return "", errors.New("sponsorship is not for sender")
+	}
+	if sp.ExpireHeight > 0 && height > sp.ExpireHeight {
+		return "", errors.New("sponsorship is expired")
+	}
+
+	for _, msg := range tx.Messages {
+		if !sp.allows(msg) {
+			return "", fmt.Errorf("method %x of %s is not sponsored", msg.MethodID, msg.Contract)
+		}
+	}
+
+	maxFee := tx.GasLimit * GetGenesisToken().GasPrice
+	if GetSponsorSpent(transID, txID, sp.ID(chainID))+maxFee > sp.Cap {
+		return "", errors.New("fee of tx may exceed cap of sponsorship")
+	}
+	return sponsor, nil
+}
+
+func (sp *Sponsorship) allows(msg types.Message) bool {
+	methodID := fmt.Sprintf("%x", msg.MethodID)
+	for _, m := range sp.Methods {
+		if m.Contract == msg.Contract && (m.MethodID == "" || m.MethodID == methodID) {
+			return true
+		}
+	}
+	return false
+}
+
+//GetSponsorSpent gets total fee paid with sponsorship of id
+func GetSponsorSpent(transID, txID int64, id string) int64 {
+	value := get(transID, txID, keyOfSponsorship(id))
+	if len(value) == 0 {
+		return 0
+	}
+
+	var spent int64
+	if err := jsoniter.Unmarshal(value, &spent); err != nil {
+		panic(err)
+	}
+	return spent
+}
+
+//SetSponsorSpent sets total fee paid with sponsorship of id
+func SetSponsorSpent(transID, txID int64, id string, spent int64) {
+	value, err := jsoniter.Marshal(spent)
+	if err != nil {
+		panic(err)
+	}
+	set(transID, txID, keyOfSponsorship(id), value)
+}
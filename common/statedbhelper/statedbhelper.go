@@ -2,6 +2,7 @@ package statedbhelper
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/bcbchain/bcbchain/statedb"
 	"github.com/bcbchain/bclib/types"
@@ -27,11 +28,47 @@ var (
 
 type Trans struct {
 	Transaction *statedb.Transaction
-	TxMap       map[int64]*statedb.Tx // txID => *statedb2.Tx
+	TxMap       map[int64]*statedb.Tx // txID => *statedb2.Tx, use GetTx and addTx to access
+
+	txMtx sync.RWMutex
+}
+
+//GetTx gets tx in transaction, it's safe for concurrent use
+func (t *Trans) GetTx(txID int64) (*statedb.Tx, bool) {
+	t.txMtx.RLock()
+	defer t.txMtx.RUnlock()
+
+	tx, ok := t.TxMap[txID]
+	return tx, ok
+}
+
+func (t *Trans) addTx(tx *statedb.Tx) {
+	t.txMtx.Lock()
+	defer t.txMtx.Unlock()
+
+	t.TxMap[tx.ID()] = tx
 }
 
 func Init(sdbName string, maxSnapshotCount int) {
 	stateDB = statedb.New(sdbName, maxSnapshotCount)
+	stateDB.SetHeightFunc(heightOfState)
+}
+
+//InitWithBackend init state db with named backend, such as statedb.MemDBBackend
+func InitWithBackend(backend, sdbName string, maxSnapshotCount int) {
+	stateDB = statedb.NewWithBackend(backend, sdbName, maxSnapshotCount)
+	stateDB.SetHeightFunc(heightOfState)
+}
+
+//InitReadOnly opens state db on disk for reading only, such as tools inspecting a stopped node
+func InitReadOnly(sdbName string) (err error) {
+	stateDB, err = statedb.OpenReadOnly(sdbName)
+	return
+}
+
+//Close closes state db
+func Close() {
+	stateDB.Close()
 }
 
 //NewCommittableTransactionID create a committable transaction and return ID
@@ -60,6 +97,35 @@ func NewRollbackTransactionID() (int64, *statedb.Transaction) {
 	return transaction.ID(), transaction
 }
 
+//NewRollbackTransactionIDAtHeight creates a rollback transaction which reads state right after
+//the block at height was committed, and returns its ID and app state at height
+func NewRollbackTransactionIDAtHeight(height int64) (int64, *abci.AppState, error) {
+	version, err := versionOfHeight(height)
+	if err != nil {
+		return 0, nil, err
+	}
+	transaction, err := stateDB.NewRollbackTransactionAtVersion(version)
+	if err != nil {
+		return 0, nil, err
+	}
+	appState, err := GetWorldAppStateAt(version)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	transactionMap.Store(transaction.ID(), &Trans{
+		Transaction: transaction,
+		TxMap:       make(map[int64]*statedb.Tx),
+	})
+	return transaction.ID(), appState, nil
+}
+
+//TransactionErr returns error of reading state db by transaction at height, it's always nil for
+//transactions reading the latest state
+func TransactionErr(transID int64) error {
+	return getTrans(transID).Transaction.Err()
+}
+
 func RollbackStateDB(rollbackTransactions int) {
 	stateDB.Rollback(rollbackTransactions)
 }
@@ -76,7 +142,7 @@ func NewTx(transID int64) int64 {
 	trans := temp.(*Trans)
 
 	tx := trans.Transaction.NewTx()
-	trans.TxMap[tx.ID()] = tx
+	trans.addTx(tx)
 	return tx.ID()
 }
 
@@ -125,19 +191,25 @@ func GetChainID() string {
 		return chainID
 	}
 
-	value := stateDB.Get(keyOfGenesisChainID())
+	chainID = chainIDOf(stateDB)
+	return chainID
+}
+
+func chainIDOf(sdb *statedb.StateDB) string {
+	value := sdb.Get(keyOfGenesisChainID())
 	if value == nil || len(value) == 0 {
 		return ""
 	}
 
-	err := jsoniter.Unmarshal(value, &chainID)
+	var id string
+	err := jsoniter.Unmarshal(value, &id)
 	if err != nil {
 		// if blockChain from v1 upgrade to v2, then "chainID" value would be []byte("xxxx"),
 		// otherwise it's be marshal result
-		chainID = string(value)
+		id = string(value)
 	}
 
-	return chainID
+	return id
 }
 
 func GetOrgID(transID, txID int64, contractAddr types.Address) string {
@@ -262,6 +334,44 @@ func CheckOrgInfo(transID, txID int64, orgID, orgAddr string) bool {
 
 //SetAccountNonce DeliverTx需要调用此接口检查并设置nonce。设置的nonce不会因为RollbackTx而取消。
 func SetAccountNonce(transID, txID int64, exAddress types.Address, nonce uint64) (nonceBuffer map[string][]byte, err error) {
+	nonceBuffer, err = accountNonceBuffer(transID, txID, exAddress, nonce)
+	if err != nil {
+		return
+	}
+
+	trans := getTrans(transID)
+	trans.Transaction.BatchSet(nonceBuffer)
+	return
+}
+
+//SetAccountNonceToTx 检查并将nonce设置到tx中，供并行执行的交易使用，交易结束时调用CommitAccountNonce
+func SetAccountNonceToTx(transID, txID int64, exAddress types.Address, nonce uint64) (nonceBuffer map[string][]byte, err error) {
+	nonceBuffer, err = accountNonceBuffer(transID, txID, exAddress, nonce)
+	if err != nil {
+		return
+	}
+
+	batchSet(transID, txID, nonceBuffer)
+	return
+}
+
+//CommitAccountNonce 将SetAccountNonceToTx设置的nonce从tx中移到transaction，与SetAccountNonce的结果一致
+func CommitAccountNonce(transID, txID int64, nonceBuffer map[string][]byte) {
+	trans := getTrans(transID)
+	tx, ok := trans.GetTx(txID)
+	if !ok {
+		panic(fmt.Sprintf("invalid txID: %d", txID))
+	}
+
+	keys := make([]string, 0, len(nonceBuffer))
+	for k := range nonceBuffer {
+		keys = append(keys, k)
+	}
+	tx.Detach(keys)
+	trans.Transaction.BatchSet(nonceBuffer)
+}
+
+func accountNonceBuffer(transID, txID int64, exAddress types.Address, nonce uint64) (nonceBuffer map[string][]byte, err error) {
 	//根据合约地址，账户地址，构造出key，然后保存
 	err = CheckAccountNonce(transID, txID, exAddress, nonce)
 	if err != nil {
@@ -282,12 +392,6 @@ func SetAccountNonce(transID, txID int64, exAddress types.Address, nonce uint64)
 	childKey := KeyOfAccountNonce(exAddress)
 	data := get(transID, txID, childKey)
 
-	temp, ok := transactionMap.Load(transID)
-	if !ok {
-		panic("invalid transID")
-	}
-	trans := temp.(*Trans)
-
 	if data == nil || len(data) == 0 {
 		accAllKeyBytes := get(transID, txID, key)
 		accAllKeys := new([]string)
@@ -304,16 +408,23 @@ func SetAccountNonce(transID, txID int64, exAddress types.Address, nonce uint64)
 			panic(err)
 		}
 		nonceBuffer[key] = resBytes
-		trans.Transaction.Set(key, resBytes)
 	}
 	nonceBuffer[childKey] = accountData
-	trans.Transaction.Set(childKey, accountData)
 
 	return
 }
 
 //CheckAccountNonce check account's nonce
 func CheckAccountNonce(transID, txID int64, exAddr types.Address, nonce uint64) error {
+	lastNonce := GetAccountNonce(transID, txID, exAddr)
+	if nonce != (lastNonce + 1) {
+		return fmt.Errorf("address:%s nonce invalid! expected: %d, got: %d", exAddr, lastNonce+1, nonce)
+	}
+	return nil
+}
+
+//GetAccountNonce get nonce of account's last tx, 0 if account has no tx
+func GetAccountNonce(transID, txID int64, exAddr types.Address) uint64 {
 	type AccountInfo struct {
 		Nonce uint64
 	}
@@ -321,22 +432,29 @@ func CheckAccountNonce(transID, txID int64, exAddr types.Address, nonce uint64)
 	key := KeyOfAccountNonce(exAddr)
 	value := get(transID, txID, key)
 
-	var lastNonce uint64
 	if value == nil || len(value) == 0 {
-		lastNonce = 0
-	} else {
-		accountInfo := new(AccountInfo)
-		err := jsoniter.Unmarshal(value, accountInfo)
-		if err != nil {
-			panic(err)
-		}
-		lastNonce = accountInfo.Nonce
+		return 0
 	}
 
-	if nonce != (lastNonce + 1) {
-		return fmt.Errorf("address:%s nonce invalid! expected: %d, got: %d", exAddr, lastNonce+1, nonce)
+	accountInfo := new(AccountInfo)
+	err := jsoniter.Unmarshal(value, accountInfo)
+	if err != nil {
+		panic(err)
 	}
-	return nil
+	return accountInfo.Nonce
+}
+
+//SetPendingNonce set nonce of account in tx, CheckTx checks the following txs of account over it
+func SetPendingNonce(transID, txID int64, exAddr types.Address, nonce uint64) {
+	type AccountInfo struct {
+		Nonce uint64
+	}
+
+	accountData, err := jsoniter.Marshal(&AccountInfo{nonce})
+	if err != nil {
+		panic(err)
+	}
+	set(transID, txID, KeyOfAccountNonce(exAddr), accountData)
 }
 
 //GetContract get specified contract data with contract address
@@ -377,7 +495,7 @@ func RollbackBlock(transID int64) {
 //RollbackTx rollback tx changes
 func RollbackTx(transID, txID int64) {
 	trans := getTrans(transID)
-	tx := trans.TxMap[txID]
+	tx, _ := trans.GetTx(txID)
 	tx.Rollback()
 }
 
@@ -390,10 +508,36 @@ func CommitBlock(transID int64) {
 	transactionMap.Delete(trans.Transaction.ID())
 }
 
+//GetTxReadWriteSet gets keys read and written by tx, they're used to detect conflicts between txs
+func GetTxReadWriteSet(transID, txID int64) (readSet, writeSet []string) {
+	trans := getTrans(transID)
+	tx, ok := trans.GetTx(txID)
+	if !ok {
+		panic(fmt.Sprintf("invalid txID: %d", txID))
+	}
+	return tx.ReadSet(), tx.WriteSet()
+}
+
+//TxConflicts checks whether tx read or wrote keys written by any of others
+func TxConflicts(transID, txID int64, others []int64) bool {
+	trans := getTrans(transID)
+	tx, ok := trans.GetTx(txID)
+	if !ok {
+		panic(fmt.Sprintf("invalid txID: %d", txID))
+	}
+
+	for _, id := range others {
+		if other, ok := trans.GetTx(id); ok && tx.Conflicts(other) {
+			return true
+		}
+	}
+	return false
+}
+
 //CommitTx commit tx changes
 func CommitTx(transID, txID int64) ([]byte, map[string][]byte) {
 	trans := getTrans(transID)
-	tx := trans.TxMap[txID]
+	tx, _ := trans.GetTx(txID)
 	return tx.Commit()
 }
 
@@ -403,6 +547,138 @@ func CommitTx2V1(transID int64, txBuffer map[string][]byte) {
 	trans.Transaction.BatchSet(txBuffer)
 }
 
+//CalcStateRoot updates the state tree with block changes and returns the state root,
+// world app state is left out of the tree because it holds the root itself
+func CalcStateRoot(transID int64) []byte {
+	trans := getTrans(transID)
+	return trans.Transaction.CalcStateRoot(keyOfWorldAppState())
+}
+
+//GetStateProof gets committed state root and proof of key, root is nil before the tree is built
+func GetStateProof(key string) ([]byte, *statedb.Proof) {
+	return stateDB.GetProof(key)
+}
+
+//GetAtHeight gets value of key right after the block at height was committed
+func GetAtHeight(key string, height int64) ([]byte, error) {
+	version, err := versionOfHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return stateDB.GetAtVersion(key, version)
+}
+
+//TransactionIDOfHeight gets ID of the transaction which committed block at height,
+// it fails if height is out of the retained snapshots
+func TransactionIDOfHeight(height int64) (int64, error) {
+	version, err := versionOfHeight(height)
+	if err == nil {
+		return version, nil
+	}
+
+	oldest, last, e := RetainedHeights()
+	if e != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("height %d is out of retained snapshots, heights from %d to %d can be used: %v",
+		height, oldest, last, err)
+}
+
+//RetainedHeights gets range of heights whose state can be read or rolled back to
+func RetainedHeights() (oldest, last int64, err error) {
+	if oldest, err = heightAtVersion(stateDB.OldestVersion()); err != nil {
+		return
+	}
+	last, err = heightAtVersion(stateDB.LastVersion())
+	return
+}
+
+//LastTransactionID gets ID of the last committed transaction
+func LastTransactionID() int64 {
+	return stateDB.LastVersion()
+}
+
+//GetAtTransaction gets value of key right after the transaction was committed
+func GetAtTransaction(key string, transactionID int64) ([]byte, error) {
+	return stateDB.GetAtVersion(key, transactionID)
+}
+
+//GetChangedKeys gets keys changed by committed transactions after fromTransID up to toTransID
+func GetChangedKeys(fromTransID, toTransID int64) ([]string, error) {
+	return stateDB.ChangedKeys(fromTransID, toTransID)
+}
+
+//GetStateDiff gets keys with prefix that differ between two committed transactions
+func GetStateDiff(fromTransID, toTransID int64, prefix string) ([]statedb.KeyDiff, error) {
+	return stateDB.DiffVersions(fromTransID, toTransID, prefix)
+}
+
+// versionOfHeight finds the last transaction committed at height, by height index which is
+// kept in snapshot db at commit, see SetHeightFunc. Heights committed before the index existed
+// are found by binary search, block height in world app state never decreases with transaction ID
+func versionOfHeight(height int64) (int64, error) {
+	if version, ok := stateDB.VersionOfHeight(height); ok {
+		return version, nil
+	}
+
+	lo, hi := stateDB.OldestVersion(), stateDB.LastVersion()
+
+	lastHeight, err := heightAtVersion(hi)
+	if err != nil {
+		return 0, err
+	}
+	if height > lastHeight {
+		return 0, fmt.Errorf("height %d is not committed, last height is %d", height, lastHeight)
+	}
+
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		h, err := heightAtVersion(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if h <= height {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	if h, err := heightAtVersion(lo); err != nil {
+		return 0, err
+	} else if h != height {
+		return 0, fmt.Errorf("height %d can not be read: %v", height, statedb.ErrVersionPruned)
+	}
+	return lo, nil
+}
+
+func heightAtVersion(version int64) (int64, error) {
+	appState, err := GetWorldAppStateAt(version)
+	if err != nil {
+		return 0, err
+	}
+	return appState.BlockHeight, nil
+}
+
+//GetWorldAppStateAt gets app state right after the transaction was committed
+func GetWorldAppStateAt(transactionID int64) (*abci.AppState, error) {
+	value, err := stateDB.GetAtVersion(keyOfWorldAppState(), transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return &abci.AppState{}, nil
+	}
+
+	var appState abci.AppState
+	if err := jsoniter.Unmarshal(value, &appState); err != nil {
+		return nil, err
+	}
+	return &appState, nil
+}
+
 //BalanceOf gets account's balance of given token
 func BalanceOf(transID, txID int64, addr types.Address, token types.Address) bn.Number {
 	key := KeyOfAccountToken(addr, token)
@@ -461,11 +737,23 @@ func AddAccountToken(transID, txID int64, addr, token types.Address) {
 	set(transID, txID, key, resBytes)
 }
 
+//kinds of rewarder, empty kind is RewardKindProposer if it's named "validators" without address,
+//otherwise it's RewardKindAddress
+const (
+	RewardKindAddress    = "address"    // 奖励给指定地址
+	RewardKindTreasury   = "treasury"   // 奖励给国库地址，与 address 相同
+	RewardKindProposer   = "proposer"   // 奖励给出块者的奖励地址
+	RewardKindValidators = "validators" // 按记账权重分给所有验证者的奖励地址
+	RewardKindBurn       = "burn"       // 销毁，减少代币的总供应量
+)
+
 //Rewarder declare reward information
 type Rewarder struct {
-	Name          string `json:"name"`          // 被奖励者名称
-	RewardPercent string `json:"rewardPercent"` // 奖励比例
-	Address       string `json:"address"`       // 被奖励者地址
+	Name          string `json:"name"`            // 被奖励者名称
+	RewardPercent string `json:"rewardPercent"`   // 奖励比例
+	Address       string `json:"address"`         // 被奖励者地址
+	Kind          string `json:"kind,omitempty"`  // 奖励类型
+	Token         string `json:"token,omitempty"` // 只分配该代币的手续费，为空时分配没有专门策略的代币
 }
 
 func (r *Rewarder) String() string {
@@ -508,6 +796,153 @@ func GetRewardStrategy(transID, txID int64, blockHeight int64) []Rewarder {
 	return []Rewarder{}
 }
 
+//BlockLimits declares budgets of a block, zero of a field means unlimited
+type BlockLimits struct {
+	MaxGas          int64 `json:"maxGas,omitempty"`          //区块内交易消耗燃料的上限
+	MaxInvocations  int64 `json:"maxInvocations,omitempty"`  //区块内合约调用次数的上限
+	MaxReceiptBytes int64 `json:"maxReceiptBytes,omitempty"` //区块内交易收据字节数的上限
+	EffectHeight    int64 `json:"effectHeight,omitempty"`    //生效高度
+}
+
+//GetBlockLimits gets block limits effective at blockHeight, they're set by governance in order of effect height
+func GetBlockLimits(transID, txID int64, blockHeight int64) BlockLimits {
+	value := get(transID, txID, keyOfBlockLimits())
+	if len(value) == 0 {
+		return BlockLimits{}
+	}
+	result := make([]BlockLimits, 0)
+	err := jsoniter.Unmarshal(value, &result)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := len(result) - 1; i >= 0; i-- {
+		if result[i].EffectHeight <= blockHeight {
+			return result[i]
+		}
+	}
+
+	return BlockLimits{}
+}
+
+//SetBlockLimits sets block limits of all effect heights
+func SetBlockLimits(transID, txID int64, limits []BlockLimits) {
+	value, err := jsoniter.Marshal(limits)
+	if err != nil {
+		panic(err)
+	}
+	set(transID, txID, keyOfBlockLimits(), value)
+}
+
+//UpdateBlockLimits sets block limits of all effect heights set by governance, limits effective
+//before fromHeight are loaded by blocks already, they can't be changed
+func UpdateBlockLimits(transID, txID int64, limits []BlockLimits, fromHeight int64) error {
+	if err := checkBlockLimits(transID, txID, limits, fromHeight); err != nil {
+		return err
+	}
+
+	SetBlockLimits(transID, txID, limits)
+	return nil
+}
+
+//UpdateBlockLimitsByContract updates block limits for contract invoked by tx in block of height, only
+//governance contract of genesis organization can update them, they take effect from the next block
+func UpdateBlockLimitsByContract(transID, txID int64, contractAddr types.Address, limits []BlockLimits, height int64) error {
+	contractBytes := get(transID, txID, keyOfContract(contractAddr))
+	if len(contractBytes) == 0 {
+		return errors.New("only governance contract can update block limits")
+	}
+	contract := new(std.Contract)
+	if err := jsoniter.Unmarshal(contractBytes, contract); err != nil {
+		return err
+	}
+	if contract.Name != "governance" || contract.OrgID != GetGenesisOrgID(transID, txID) {
+		return errors.New("only governance contract can update block limits")
+	}
+
+	return UpdateBlockLimits(transID, txID, limits, height+1)
+}
+
+func checkBlockLimits(transID, txID int64, limits []BlockLimits, fromHeight int64) error {
+	for i, l := range limits {
+		if l.MaxGas < 0 || l.MaxInvocations < 0 || l.MaxReceiptBytes < 0 || l.EffectHeight < 0 {
+			return fmt.Errorf("block limits effective at %d are negative", l.EffectHeight)
+		}
+		if i > 0 && l.EffectHeight <= limits[i-1].EffectHeight {
+			return errors.New("block limits must be in ascending order of effect height")
+		}
+	}
+
+	old := make([]BlockLimits, 0)
+	if value := get(transID, txID, keyOfBlockLimits()); len(value) != 0 {
+		if err := jsoniter.Unmarshal(value, &old); err != nil {
+			return err
+		}
+	}
+
+	effective := func(limits []BlockLimits) []BlockLimits {
+		for i, l := range limits {
+			if l.EffectHeight >= fromHeight {
+				return limits[:i]
+			}
+		}
+		return limits
+	}
+	oldEffective, newEffective := effective(old), effective(limits)
+	if len(oldEffective) != len(newEffective) {
+		return fmt.Errorf("block limits effective before %d can't be changed", fromHeight)
+	}
+	for i := range oldEffective {
+		if oldEffective[i] != newEffective[i] {
+			return fmt.Errorf("block limits effective before %d can't be changed", fromHeight)
+		}
+	}
+	return nil
+}
+
+//NewIterator returns an ordered iterator over keys of state, which merges uncommitted data
+// of the tx and the transaction over state db, use transID 0 to iterate committed data only
+func NewIterator(transID, txID int64, opts statedb.IterOptions) statedb.Iterator {
+	temp, ok := transactionMap.Load(transID)
+	if !ok {
+		if transID == 0 {
+			return stateDB.NewIterator(opts)
+		}
+
+		panic("invalid transID")
+	}
+	trans := temp.(*Trans)
+
+	if tx, ok := trans.GetTx(txID); ok {
+		return tx.NewIterator(opts)
+	}
+	return trans.Transaction.NewIterator(opts)
+}
+
+//GetKeysByPrefix gets keys with given prefix in ascending order, limit 0 means no limit
+func GetKeysByPrefix(transID, txID int64, prefix string, limit int) []string {
+	it := NewIterator(transID, txID, statedb.IterOptions{Prefix: prefix, Limit: limit})
+	defer it.Close()
+
+	keys := make([]string, 0)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+//GetAccountTokens gets addresses of tokens which account holds balance of
+func GetAccountTokens(transID, txID int64, addr types.Address) []types.Address {
+	prefix := KeyOfAccountToken(addr, "")
+	keys := GetKeysByPrefix(transID, txID, prefix, 0)
+
+	tokens := make([]types.Address, len(keys))
+	for i, key := range keys {
+		tokens[i] = key[len(prefix):]
+	}
+	return tokens
+}
+
 //AdapterGetCallBack callback of get function
 func AdapterGetCallBack(transID, txID int64, key string) ([]byte, error) {
 	resDB := get(transID, txID, key)
@@ -526,8 +961,36 @@ func AdapterGetCallBack(transID, txID int64, key string) ([]byte, error) {
 	return res, nil
 }
 
+//AdapterKeysCallBack callback of keys function
+func AdapterKeysCallBack(transID, txID int64, prefix string, limit int) ([]byte, error) {
+	result := new(std.GetResult)
+
+	if prefix == "" {
+		result.Code = types2.ErrInvalidParameter
+		result.Msg = "prefix cannot be empty."
+		res, _ := jsoniter.Marshal(result)
+		return res, nil
+	}
+
+	keys := GetKeysByPrefix(transID, txID, prefix, limit)
+	data, err := jsoniter.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Code = types.CodeOK
+	result.Data = data
+	res, _ := jsoniter.Marshal(result)
+	return res, nil
+}
+
 //AdapterSetCallBack callback of set function
 func AdapterSetCallBack(transID, txID int64, data map[string][]byte) (*bool, error) {
+	// governance contract updates block limits by UpdateBlockLimitsByContract
+	if _, ok := data[keyOfBlockLimits()]; ok {
+		return nil, errors.New("block limits can't be set by contract directly")
+	}
+
 	batchSet(transID, txID, data)
 	b := true
 	return &b, nil
@@ -707,6 +1170,14 @@ func SetContract(transID, txID int64, contract *std.Contract) {
 	set(transID, txID, key, value)
 }
 
+func SetToken(transID, txID int64, token *std.Token) {
+	value, err := jsoniter.Marshal(token)
+	if err != nil {
+		panic(err)
+	}
+	set(transID, txID, KeyOfToken(token.Address), value)
+}
+
 func SetContractMeta(transID, txID int64, contract *std.ContractMeta) {
 	key := keyOfContractMeta(contract.ContractAddr)
 	value, err := jsoniter.Marshal(contract)
@@ -856,7 +1327,7 @@ func get(transID, txID int64, key string) []byte {
 	}
 	trans := temp.(*Trans)
 
-	tx, ok := trans.TxMap[txID]
+	tx, ok := trans.GetTx(txID)
 	if ok {
 		value := tx.Get(key)
 		if len(value) != 0 {
@@ -876,7 +1347,7 @@ func set(transID, txID int64, key string, value []byte) {
 	trans := temp.(*Trans)
 
 	var tx *statedb.Tx
-	tx, ok = trans.TxMap[txID]
+	tx, ok = trans.GetTx(txID)
 	if !ok {
 		panic(fmt.Sprintf("invalid txID: %d", txID))
 	}
@@ -891,7 +1362,7 @@ func batchSet(transID, txID int64, data map[string][]byte) {
 	trans := temp.(*Trans)
 
 	var tx *statedb.Tx
-	tx, ok = trans.TxMap[txID]
+	tx, ok = trans.GetTx(txID)
 	if !ok {
 		panic(fmt.Sprintf("invalid txID: %d", txID))
 	}
@@ -0,0 +1,165 @@
+package statedbhelper
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bcbchain/bcbchain/statedb"
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	tx2 "github.com/bcbchain/bclib/tx/v2"
+	"github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// 并行执行时，失败交易提交的 nonce 必须与后续同一发送者的交易冲突，使其重新执行
+func TestTxConflictsOnNonceOfFailedTx(t *testing.T) {
+	InitWithBackend(statedb.MemDBBackend, "tnonceconflict"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer Close()
+
+	transID, _ := NewCommittableTransactionID()
+	defer CommitBlock(transID)
+	sender := "localSender"
+
+	// 两笔交易在不同的执行通道中同时执行
+	txID1 := NewTx(transID)
+	txID2 := NewTx(transID)
+
+	nonceBuffer, err := SetAccountNonceToTx(transID, txID1, sender, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第二笔交易读到旧的 nonce，按串行执行它本应有效
+	if _, err := SetAccountNonceToTx(transID, txID2, sender, 2); err == nil {
+		t.Fatal("tx with next nonce passes before the previous one is finished")
+	}
+
+	// 第一笔交易调用失败：nonce 移到交易中，其余数据回滚
+	CommitAccountNonce(transID, txID1, nonceBuffer)
+	RollbackTx(transID, txID1)
+
+	if !TxConflicts(transID, txID2, []int64{txID1}) {
+		t.Error("tx reading stale nonce doesn't conflict with failed tx")
+	}
+
+	// 重新执行后第二笔交易有效
+	txID3 := NewTx(transID)
+	if _, err := SetAccountNonceToTx(transID, txID3, sender, 2); err != nil {
+		t.Error(err)
+	}
+}
+
+// 治理合约修改区块限额，已经生效的限额不能修改
+func TestUpdateBlockLimits(t *testing.T) {
+	InitWithBackend(statedb.MemDBBackend, "tblocklimits"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer Close()
+
+	transID, _ := NewCommittableTransactionID()
+	defer CommitBlock(transID)
+	txID := NewTx(transID)
+
+	genesis := []BlockLimits{{MaxGas: 1000, EffectHeight: 0}, {MaxGas: 2000, EffectHeight: 100}}
+	if err := UpdateBlockLimits(transID, txID, genesis, 0); err != nil {
+		t.Fatal(err)
+	}
+	SetWorldAppState(transID, txID, &abci.AppState{BlockHeight: 100})
+
+	orgID, _ := jsoniter.Marshal("orgGenesis")
+	Set(transID, txID, keyOfGenesisOrgID(), orgID)
+	SetContract(transID, txID, &std.Contract{Address: "localGovernance", Name: "governance", OrgID: "orgGenesis"})
+	SetContract(transID, txID, &std.Contract{Address: "localOther", Name: "governance", OrgID: "orgOther"})
+	setLimits := func(limits []BlockLimits) error {
+		return UpdateBlockLimitsByContract(transID, txID, "localGovernance", limits, 101)
+	}
+
+	// 只有创世组织的治理合约可以修改限额，合约也不能直接写入
+	changed := append(genesis, BlockLimits{MaxGas: 3000, EffectHeight: 102})
+	if err := UpdateBlockLimitsByContract(transID, txID, "localOther", changed, 101); err == nil {
+		t.Error("limits are set by other contract")
+	}
+	value, _ := jsoniter.Marshal(changed)
+	if _, err := AdapterSetCallBack(transID, txID, map[string][]byte{keyOfBlockLimits(): value}); err == nil {
+		t.Error("limits are set by set callback")
+	}
+
+	bad := [][]BlockLimits{
+		// 修改正在生效的限额
+		{{MaxGas: 1000, EffectHeight: 0}, {MaxGas: 3000, EffectHeight: 100}},
+		// 在正在执行的区块生效
+		{{MaxGas: 1000, EffectHeight: 0}, {MaxGas: 2000, EffectHeight: 100}, {MaxGas: 3000, EffectHeight: 101}},
+		// 生效高度不是递增的
+		{{MaxGas: 1000, EffectHeight: 0}, {MaxGas: 2000, EffectHeight: 100}, {MaxGas: 3000, EffectHeight: 200}, {EffectHeight: 150}},
+		{{MaxGas: 1000, EffectHeight: 0}, {MaxGas: 2000, EffectHeight: 100}, {MaxGas: -1, EffectHeight: 200}},
+	}
+	for _, limits := range bad {
+		if err := setLimits(limits); err == nil {
+			t.Errorf("%v is set", limits)
+		}
+	}
+
+	good := append(genesis, BlockLimits{MaxGas: 3000, MaxInvocations: 10, EffectHeight: 102})
+	if err := setLimits(good); err != nil {
+		t.Fatal(err)
+	}
+	if limits := GetBlockLimits(transID, txID, 102); limits != good[2] {
+		t.Errorf("limits at 102: %v", limits)
+	}
+	if limits := GetBlockLimits(transID, txID, 101); limits != genesis[1] {
+		t.Errorf("limits at 101: %v", limits)
+	}
+}
+
+// 合约转交的签名交易按其备注中的高度排期，交易的 nonce 随之使用
+func TestScheduleSignedTx(t *testing.T) {
+	InitWithBackend(statedb.MemDBBackend, "tschedulesigned"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer Close()
+	SetChainIDOnce("local")
+	chainID := GetChainID()
+
+	// 预付手续费使用创世通证
+	token := std.Token{Address: "localToken", GasPrice: 2500}
+	transID, _ := NewCommittableTransactionID()
+	txID := NewTx(transID)
+	value, _ := jsoniter.Marshal(token)
+	Set(transID, txID, "/genesis/token", value)
+	CommitTx(transID, txID)
+	CommitBlock(transID)
+
+	transID, _ = NewCommittableTransactionID()
+	defer CommitBlock(transID)
+	txID = NewTx(transID)
+
+	privKey := crypto.GenPrivKeyEd25519()
+	sender := privKey.PubKey().(crypto.PubKeyEd25519).Address(chainID)
+	SetBalance(transID, txID, sender, token.Address, bn.N(1000000000))
+	signed := func(nonce uint64, note string) string {
+		msg := types.Message{Contract: "localContract", MethodID: 1}
+		return tx2.WrapTxEx(chainID, tx2.WrapPayload(nonce, 100000, note, msg), "0x"+hex.EncodeToString(privKey[:]))
+	}
+
+	// 备注没有排期的交易不能由合约排期
+	if _, err := ScheduleSignedTx(transID, txID, signed(1, "note"), 1); err == nil {
+		t.Error("tx without schedule note is scheduled")
+	}
+
+	tx := signed(1, ScheduleNotePrefix+"10")
+	call, err := ScheduleSignedTx(transID, txID, tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.Sender != sender || call.Height != 10 || len(GetScheduledCalls(transID, txID, 10)) != 1 {
+		t.Errorf("scheduled call: %v", call)
+	}
+	if balance := BalanceOf(transID, txID, sender, token.Address); balance.Cmp(bn.N(1000000000-100000*2500)) != 0 {
+		t.Errorf("balance after prepaid: %v", balance)
+	}
+
+	// 同一交易不能再次排期或执行
+	if _, err := ScheduleSignedTx(transID, txID, tx, 1); err == nil {
+		t.Error("tx is scheduled twice")
+	}
+}
@@ -1,6 +1,10 @@
 package statedbhelper
 
-import "github.com/bcbchain/bclib/types"
+import (
+	"strconv"
+
+	"github.com/bcbchain/bclib/types"
+)
 
 func keyOfWorldAppState() string {
 	return "/world/appstate"
@@ -14,6 +18,18 @@ func keyOfRewardStrategy() string {
 	return "/rewardstrategys"
 }
 
+func keyOfBlockLimits() string {
+	return "/blocklimits"
+}
+
+func keyOfScheduledCalls(height int64) string {
+	return "/schedule/" + strconv.FormatInt(height, 10)
+}
+
+func keyOfSponsorship(id string) string {
+	return "/sponsorship/" + id
+}
+
 func KeyOfAccountNonce(exAddress types.Address) string {
 	return "/account/ex/" + exAddress + "/account"
 }
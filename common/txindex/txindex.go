@@ -0,0 +1,513 @@
+package txindex
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/statedb"
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/go-crypto"
+	tx1 "github.com/bcbchain/bclib/tx/v1"
+	tx2 "github.com/bcbchain/bclib/tx/v2"
+	tx3 "github.com/bcbchain/bclib/tx/v3"
+	"github.com/bcbchain/bclib/types"
+	"github.com/bcbchain/sdk/sdk/bn"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/rlp"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+// kinds of secondary indexes
+const (
+	BySender   = "sender"
+	ByContract = "contract"
+	ByReceipt  = "receipt"
+)
+
+// MaxPageSize is the max count of txs returned by Find
+const MaxPageSize = 100
+
+const (
+	keyOfLastHeight    = "lastHeight"
+	transferMethodIDV1 = "af0228bc"
+	transferMethodIDV2 = "44d8ca60"
+)
+
+//TxRecord is a delivered tx kept in index
+type TxRecord struct {
+	TxHash   string        `json:"txHash"` // "0x" and hex in lower case
+	Height   int64         `json:"height"`
+	Index    int           `json:"index"` // index of tx in block
+	Code     uint32        `json:"code"`
+	Log      string        `json:"log"`
+	From     string        `json:"from"`
+	Nonce    uint64        `json:"nonce"`
+	Note     string        `json:"note"`
+	GasUsed  uint64        `json:"gasUsed"`
+	Fee      uint64        `json:"fee"`
+	Messages []std.Message `json:"messages"`
+	Receipts []std.Receipt `json:"receipts"`
+}
+
+//TxResult converts record to result of "$sdk$getTx"
+func (r *TxRecord) TxResult() std.TxResult {
+	return std.TxResult{
+		TxHash:      r.TxHash,
+		Code:        r.Code,
+		Log:         r.Log,
+		BlockHeight: r.Height,
+		From:        r.From,
+		Note:        r.Note,
+		Message:     r.Messages,
+	}
+}
+
+type deliveredTx struct {
+	height int64
+	index  int
+	tx     []byte
+	res    abci.ResponseDeliverTx
+}
+
+var (
+	mtx     sync.Mutex
+	db      statedb.Backend
+	pending []deliveredTx // txs of current block, they're indexed when block is committed
+)
+
+//Init opens or creates index db, relative name is in HOME like state db
+func Init(backend, name string) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db != nil {
+		return errors.New("tx index is already opened")
+	}
+
+	var err error
+	db, err = statedb.OpenBackend(backend, name)
+	return err
+}
+
+//Close closes index db
+func Close() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db != nil {
+		db.Close()
+		db = nil
+	}
+	pending = nil
+}
+
+//Enabled returns whether index db is opened
+func Enabled() bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	return db != nil
+}
+
+//BeginBlock drops txs left by a block which isn't committed
+func BeginBlock() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	pending = nil
+}
+
+//AddTx adds delivered tx of current block, response must have tx hash
+func AddTx(height int64, index int, tx []byte, res abci.ResponseDeliverTx) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return
+	}
+	pending = append(pending, deliveredTx{height: height, index: index, tx: tx, res: res})
+}
+
+//Commit indexes txs of committed block, it's done after state db is committed, so
+//contracts deployed in block can be found when messages are resolved. Block must be the
+//next one of the last indexed block, or index is empty, otherwise nothing is written.
+func Commit(height int64) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return nil
+	}
+	txs := pending
+	pending = nil
+
+	lastHeight, err := lastHeight()
+	if err != nil {
+		return err
+	}
+	if lastHeight != 0 && height != lastHeight+1 {
+		return fmt.Errorf("tx index is at height %d, block %d can't be indexed", lastHeight, height)
+	}
+
+	batch := db.NewBatch()
+	for _, dtx := range txs {
+		r := newTxRecord(dtx)
+		value, err := jsoniter.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		hash := strings.TrimPrefix(r.TxHash, "0x")
+		batch.Set([]byte(keyOfTx(hash)), value)
+		for _, k := range secondaryKeys(r) {
+			batch.Set([]byte(k), []byte(hash))
+		}
+	}
+	batch.Set([]byte(keyOfLastHeight), []byte(strconv.FormatInt(height, 10)))
+
+	return batch.Commit()
+}
+
+//Rollback deletes txs of blocks above height, it's done when state db is rolled back
+func Rollback(height int64) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return nil
+	}
+	pending = nil
+
+	lastHeight, err := lastHeight()
+	if err != nil || lastHeight <= height {
+		return err
+	}
+	return deleteAbove(height)
+}
+
+//Restore prepares index for state db restored from backup at height, txs above height are deleted,
+//or all txs are deleted if index is behind, so it indexes blocks from the next one.
+func Restore(height int64) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return nil
+	}
+	pending = nil
+
+	lastHeight, err := lastHeight()
+	if err != nil {
+		return err
+	}
+	if lastHeight >= height {
+		return deleteAbove(height)
+	}
+
+	batch := db.NewBatch()
+	it := db.Iterator(nil, nil, false)
+	for ; it.Valid(); it.Next() {
+		batch.Delete(it.Key())
+	}
+	it.Close()
+
+	return batch.Commit()
+}
+
+// deleteAbove deletes txs and their secondary keys of blocks above height, and sets last height.
+func deleteAbove(height int64) error {
+	batch := db.NewBatch()
+	it := db.Iterator([]byte(keyOfTx("")), []byte("tx0"), false)
+	for ; it.Valid(); it.Next() {
+		r := new(TxRecord)
+		if err := jsoniter.Unmarshal(it.Value(), r); err != nil {
+			it.Close()
+			return err
+		}
+		if r.Height <= height {
+			continue
+		}
+
+		batch.Delete(it.Key())
+		for _, k := range secondaryKeys(r) {
+			batch.Delete([]byte(k))
+		}
+	}
+	it.Close()
+	batch.Set([]byte(keyOfLastHeight), []byte(strconv.FormatInt(height, 10)))
+
+	return batch.Commit()
+}
+
+//LastHeight returns height of the last indexed block
+func LastHeight() int64 {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return 0
+	}
+	height, err := lastHeight()
+	if err != nil {
+		panic(err)
+	}
+	return height
+}
+
+func lastHeight() (int64, error) {
+	value, err := db.Get([]byte(keyOfLastHeight))
+	if err != nil {
+		return 0, err
+	}
+	height, _ := strconv.ParseInt(string(value), 10, 64)
+	return height, nil
+}
+
+//Get gets tx by hash, with or without "0x", it returns nil if tx isn't indexed
+func Get(txHash string) (*TxRecord, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return nil, errors.New("tx index is disabled")
+	}
+	return get(strings.ToLower(strings.TrimPrefix(txHash, "0x")))
+}
+
+//Find finds txs by secondary index in order of height, cursor is "" or next cursor returned by
+//the last page, next cursor is "" if there's no more txs.
+func Find(kind, value, cursor string, limit int, reverse bool) (records []*TxRecord, next string, err error) {
+	switch kind {
+	case BySender, ByContract, ByReceipt:
+	default:
+		return nil, "", fmt.Errorf("invalid index %s", kind)
+	}
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if db == nil {
+		return nil, "", errors.New("tx index is disabled")
+	}
+
+	prefix := kind + "/" + value + "/"
+	start, end := []byte(prefix), []byte(prefix[:len(prefix)-1]+"0")
+	if cursor != "" {
+		if reverse {
+			end = []byte(prefix + cursor)
+		} else {
+			start = []byte(prefix + cursor + "\x00")
+		}
+	}
+
+	it := db.Iterator(start, end, reverse)
+	defer it.Close()
+
+	records = make([]*TxRecord, 0)
+	for ; it.Valid(); it.Next() {
+		suffix := string(it.Key())[len(prefix):]
+		if len(suffix) != len(positionOf(0, 0)) {
+			// key of another value which has value as prefix
+			continue
+		}
+		if len(records) == limit {
+			return records, cursorOf(records[len(records)-1]), nil
+		}
+
+		r, err := get(string(it.Value()))
+		if err != nil {
+			return nil, "", err
+		}
+		if r != nil {
+			records = append(records, r)
+		}
+	}
+
+	return records, "", nil
+}
+
+func get(hash string) (*TxRecord, error) {
+	value, err := db.Get([]byte(keyOfTx(hash)))
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	r := new(TxRecord)
+	if err := jsoniter.Unmarshal(value, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func keyOfTx(hash string) string {
+	return "tx/" + hash
+}
+
+func positionOf(height int64, index int) string {
+	return fmt.Sprintf("%020d/%06d", height, index)
+}
+
+func cursorOf(r *TxRecord) string {
+	return positionOf(r.Height, r.Index)
+}
+
+func secondaryKeys(r *TxRecord) []string {
+	values := map[string]map[string]struct{}{
+		BySender:   {},
+		ByContract: {},
+		ByReceipt:  {},
+	}
+	if r.From != "" {
+		values[BySender][r.From] = struct{}{}
+	}
+	for _, m := range r.Messages {
+		if m.SmcAddress != "" {
+			values[ByContract][m.SmcAddress] = struct{}{}
+		}
+	}
+	for _, receipt := range r.Receipts {
+		if receipt.ContractAddr != "" {
+			values[ByContract][receipt.ContractAddr] = struct{}{}
+		}
+		if receipt.Name != "" {
+			values[ByReceipt][receipt.Name] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0)
+	for kind, vs := range values {
+		for v := range vs {
+			keys = append(keys, kind+"/"+v+"/"+cursorOf(r))
+		}
+	}
+	return keys
+}
+
+func newTxRecord(dtx deliveredTx) *TxRecord {
+	r := &TxRecord{
+		TxHash:   "0x" + hex.EncodeToString(dtx.res.TxHash),
+		Height:   dtx.height,
+		Index:    dtx.index,
+		Code:     dtx.res.Code,
+		Log:      dtx.res.Log,
+		GasUsed:  dtx.res.GasUsed,
+		Fee:      dtx.res.Fee,
+		Messages: make([]std.Message, 0),
+		Receipts: make([]std.Receipt, 0),
+	}
+
+	for _, tag := range dtx.res.Tags {
+		var receipt std.Receipt
+		if err := jsoniter.Unmarshal(tag.Value, &receipt); err == nil {
+			r.Receipts = append(r.Receipts, receipt)
+		}
+	}
+
+	parseTx(r, string(dtx.tx))
+	return r
+}
+
+// parseTx fills sender, nonce, note and messages of tx, they're left empty if tx can't be parsed.
+func parseTx(r *TxRecord, txStr string) {
+	if s, _, err := statedbhelper.SplitSponsoredTx(txStr); err == nil {
+		txStr = s
+	}
+	split := strings.Split(txStr, ".")
+	if len(split) < 2 {
+		return
+	}
+	chainID := statedbhelper.GetChainID()
+
+	var (
+		transaction types.Transaction
+		pubKey      crypto.PubKeyEd25519
+		err         error
+	)
+	switch split[1] {
+	case "v1":
+		var txv1 tx1.Transaction
+		from, _, err := txv1.TxParse(chainID, txStr)
+		if err != nil {
+			return
+		}
+		r.From, r.Nonce, r.Note = from, txv1.Nonce, txv1.Note
+		r.Messages = append(r.Messages, messageV1(txv1))
+		return
+	case "v2":
+		tx2.Init(chainID)
+		transaction, pubKey, err = tx2.TxParse(txStr)
+	case "v3":
+		tx3.Init(chainID)
+		transaction, pubKey, err = tx3.TxParse(txStr)
+	default:
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	r.From, r.Nonce, r.Note = pubKey.Address(chainID), transaction.Nonce, transaction.Note
+	for _, m := range transaction.Messages {
+		r.Messages = append(r.Messages, message(m))
+	}
+}
+
+func messageV1(tx tx1.Transaction) (msg std.Message) {
+	msg.SmcAddress = tx.To
+
+	var methodInfo tx1.MethodInfo
+	if err := rlp.DecodeBytes(tx.Data, &methodInfo); err != nil {
+		return
+	}
+	methodID := fmt.Sprintf("%x", methodInfo.MethodID)
+	msg.Method = methodOf(tx.To, methodID)
+
+	if methodID == transferMethodIDV1 {
+		var items = make([][]byte, 0)
+		if err := rlp.DecodeBytes(methodInfo.ParamData, &items); err != nil || len(items) != 2 {
+			return
+		}
+		msg.To = string(items[0])
+		msg.Value = new(big.Int).SetBytes(items[1]).String()
+	}
+	return
+}
+
+func message(m types.Message) (msg std.Message) {
+	methodID := fmt.Sprintf("%x", m.MethodID)
+	msg.SmcAddress = m.Contract
+	msg.Method = methodOf(m.Contract, methodID)
+
+	if methodID == transferMethodIDV2 && len(m.Items) == 2 {
+		var to types.Address
+		var value bn.Number
+		if rlp.DecodeBytes(m.Items[0], &to) == nil && rlp.DecodeBytes(m.Items[1], &value) == nil {
+			msg.To = to
+			msg.Value = value.String()
+		}
+	}
+	return
+}
+
+func methodOf(contractAddr types.Address, methodID string) string {
+	contract := statedbhelper.GetContract(contractAddr)
+	if contract == nil {
+		return ""
+	}
+
+	for _, method := range contract.Methods {
+		if method.MethodID == methodID {
+			return method.ProtoType
+		}
+	}
+	return ""
+}
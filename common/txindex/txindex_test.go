@@ -0,0 +1,150 @@
+package txindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcbchain/bcbchain/statedb"
+	abci "github.com/bcbchain/bclib/tendermint/abci/types"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+func TestIndex(t *testing.T) {
+	if err := Init(statedb.MemDBBackend, filepath.Join(os.TempDir(), "testtxindex")); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	// 两个区块各两笔交易，第 1、3 笔有转账收据
+	for height := int64(1); height <= 2; height++ {
+		BeginBlock()
+		for index := 0; index < 2; index++ {
+			AddTx(height, index, nil, testResponse(byte(height*10)+byte(index), index == 0))
+		}
+		if err := Commit(height); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 未提交的区块不建立索引
+	BeginBlock()
+	AddTx(3, 0, nil, testResponse(30, true))
+	BeginBlock()
+
+	if LastHeight() != 2 {
+		t.Errorf("last height: %d", LastHeight())
+	}
+
+	r, err := Get("0x0b")
+	if err != nil || r == nil || r.Height != 1 || r.Index != 1 {
+		t.Fatalf("get: %v %v", r, err)
+	}
+
+	// 按收据名称分页查询
+	txs, next, err := Find(ByReceipt, "std::transfer", "", 1, false)
+	if err != nil || len(txs) != 1 || txs[0].TxHash != "0x0a" || next == "" {
+		t.Fatalf("find first page: %v %s %v", txs, next, err)
+	}
+	txs, next, err = Find(ByReceipt, "std::transfer", next, 1, false)
+	if err != nil || len(txs) != 1 || txs[0].TxHash != "0x14" || next != "" {
+		t.Fatalf("find second page: %v %s %v", txs, next, err)
+	}
+
+	// 按合约地址倒序查询
+	txs, _, err = Find(ByContract, "bcbToken", "", 10, true)
+	if err != nil || len(txs) != 2 || txs[0].TxHash != "0x14" || txs[1].TxHash != "0x0a" {
+		t.Fatalf("find reverse: %v %v", txs, err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	if err := Init(statedb.MemDBBackend, filepath.Join(os.TempDir(), "testtxindexrollback")); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	for height := int64(1); height <= 3; height++ {
+		BeginBlock()
+		AddTx(height, 0, nil, testResponse(byte(height), true))
+		if err := Commit(height); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 高度不连续的区块不建立索引
+	BeginBlock()
+	AddTx(5, 0, nil, testResponse(5, true))
+	if err := Commit(5); err == nil || LastHeight() != 3 {
+		t.Fatalf("commit with gap: %v %d", err, LastHeight())
+	}
+
+	// 回滚后删除高于回滚高度的交易
+	if err := Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if LastHeight() != 1 {
+		t.Errorf("last height: %d", LastHeight())
+	}
+	if r, err := Get("0x02"); err != nil || r != nil {
+		t.Errorf("get rolled back tx: %v %v", r, err)
+	}
+	txs, _, err := Find(ByReceipt, "std::transfer", "", 10, false)
+	if err != nil || len(txs) != 1 || txs[0].TxHash != "0x01" {
+		t.Fatalf("find after rollback: %v %v", txs, err)
+	}
+
+	// 回滚后可以重新索引下一个区块
+	BeginBlock()
+	AddTx(2, 0, nil, testResponse(0x12, false))
+	if err := Commit(2); err != nil || LastHeight() != 2 {
+		t.Fatalf("commit after rollback: %v %d", err, LastHeight())
+	}
+}
+
+func TestRestore(t *testing.T) {
+	if err := Init(statedb.MemDBBackend, filepath.Join(os.TempDir(), "testtxindexrestore")); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	for height := int64(1); height <= 3; height++ {
+		BeginBlock()
+		AddTx(height, 0, nil, testResponse(byte(height), true))
+		if err := Commit(height); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 备份早于索引时删除高于备份的交易
+	if err := Restore(2); err != nil || LastHeight() != 2 {
+		t.Fatalf("restore older backup: %v %d", err, LastHeight())
+	}
+	if r, _ := Get("0x03"); r != nil {
+		t.Errorf("get tx above backup: %v", r)
+	}
+
+	// 备份晚于索引时清空索引，从下一个区块开始索引
+	if err := Restore(10); err != nil || LastHeight() != 0 {
+		t.Fatalf("restore newer backup: %v %d", err, LastHeight())
+	}
+	if r, _ := Get("0x01"); r != nil {
+		t.Errorf("get tx after index is cleared: %v", r)
+	}
+	BeginBlock()
+	AddTx(11, 0, nil, testResponse(11, false))
+	if err := Commit(11); err != nil || LastHeight() != 11 {
+		t.Fatalf("commit after restore: %v %d", err, LastHeight())
+	}
+}
+
+func testResponse(hash byte, transfer bool) abci.ResponseDeliverTx {
+	res := abci.ResponseDeliverTx{TxHash: []byte{hash}}
+	if transfer {
+		receipt, _ := jsoniter.Marshal(std.Receipt{Name: "std::transfer", ContractAddr: "bcbToken"})
+		res.Tags = []common.KVPair{{Key: []byte("/0/std::transfer"), Value: receipt}}
+	}
+	return res
+}
@@ -0,0 +1,118 @@
+package smcbuilder
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bclib/algorithm"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+	"github.com/bcbchain/sdk/sdk/std"
+)
+
+const orgKeyPrefix = "/organization/"
+
+// BinDirName returns name of the dir under <WorkDir>/bin/<orgID> which holds smcrunsvc
+// built from code of the organization.
+func BinDirName(orgID, genesisOrgID string, orgCodeHash, genesisOrgCodeHash []byte) string {
+	if orgID == genesisOrgID && len(orgCodeHash) == 0 {
+		return "genesis"
+	}
+
+	var genesisOrgHashStr string
+	if orgID != genesisOrgID {
+		genesisOrgHashStr = string(genesisOrgCodeHash)
+	}
+	return hex.EncodeToString(algorithm.CalcCodeHash(genesisOrgHashStr + string(orgCodeHash)))
+}
+
+// IntroducedBinDirs returns bin dirs built for organization code introduced by transactions
+// after transactionID, they are useless once state db is rolled back to transactionID.
+// It must be called before rolling back, snapshots of the transactions are needed.
+func IntroducedBinDirs(workDir string, transactionID int64) ([]string, error) {
+	last := statedbhelper.LastTransactionID()
+	keys, err := statedbhelper.GetChangedKeys(transactionID, last)
+	if err != nil {
+		return nil, err
+	}
+
+	genesisOrgID := statedbhelper.GetGenesisOrgID(0, 0)
+	orgIDs := make(map[string]struct{})
+	for _, k := range keys {
+		if orgID := strings.TrimPrefix(k, orgKeyPrefix); orgID != k && !strings.Contains(orgID, "/") {
+			orgIDs[orgID] = struct{}{}
+		}
+	}
+
+	// bin dirs of all organizations depend on code of genesis organization
+	if _, ok := orgIDs[genesisOrgID]; ok {
+		for _, k := range statedbhelper.GetKeysByPrefix(0, 0, orgKeyPrefix, 0) {
+			if orgID := strings.TrimPrefix(k, orgKeyPrefix); !strings.Contains(orgID, "/") {
+				orgIDs[orgID] = struct{}{}
+			}
+		}
+	}
+
+	dirs := make([]string, 0)
+	for orgID := range orgIDs {
+		keep, err := binDirAt(orgID, genesisOrgID, transactionID)
+		if err != nil {
+			return nil, err
+		}
+
+		introduced := make(map[string]struct{})
+		for id := transactionID + 1; id <= last; id++ {
+			dir, err := binDirAt(orgID, genesisOrgID, id)
+			if err != nil {
+				return nil, err
+			}
+			if dir != "" && dir != keep {
+				introduced[dir] = struct{}{}
+			}
+		}
+
+		for dir := range introduced {
+			dirs = append(dirs, filepath.Join(workDir, "bin", orgID, dir))
+		}
+	}
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
+
+// binDirAt returns bin dir name of organization right after the transaction,
+// empty string means the organization doesn't exist.
+func binDirAt(orgID, genesisOrgID string, transactionID int64) (string, error) {
+	org, err := orgAt(orgID, transactionID)
+	if err != nil || org == nil {
+		return "", err
+	}
+
+	var genesisOrgCodeHash []byte
+	if orgID != genesisOrgID {
+		genesisOrg, err := orgAt(genesisOrgID, transactionID)
+		if err != nil {
+			return "", err
+		}
+		if genesisOrg != nil {
+			genesisOrgCodeHash = genesisOrg.OrgCodeHash
+		}
+	}
+
+	return BinDirName(orgID, genesisOrgID, org.OrgCodeHash, genesisOrgCodeHash), nil
+}
+
+func orgAt(orgID string, transactionID int64) (*std.Organization, error) {
+	value, err := statedbhelper.GetAtTransaction(orgKeyPrefix+orgID, transactionID)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+
+	org := new(std.Organization)
+	if err := jsoniter.Unmarshal(value, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
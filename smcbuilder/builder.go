@@ -132,12 +132,11 @@ func (b *Builder) GetContractDllPath(transID int64, txID int64, orgID string) (s
 		return "", errors.New("BuildContract can't get orgCodeHash")
 	}*/
 
-	var genesisOrgHashStr string
+	var genesisOrgCodeHash []byte
 	if orgID != genesisOrgID {
-		genesisOrgHashStr = string(statedbhelper.GetOrgCodeHash(transID, txID, genesisOrgID))
+		genesisOrgCodeHash = statedbhelper.GetOrgCodeHash(transID, txID, genesisOrgID)
 	}
-	smcsvcFilePath := algorithm.CalcCodeHash(genesisOrgHashStr + string(orgCodeHash))
-	smcsvcFilePathStr := hex.EncodeToString(smcsvcFilePath)
+	smcsvcFilePathStr := BinDirName(orgID, genesisOrgID, orgCodeHash, genesisOrgCodeHash)
 	resPath := filepath.Join(b.WorkDir, "bin", orgID, smcsvcFilePathStr, "smcrunsvc")
 	ok := fs.CheckSha2(resPath)
 	if ok {
@@ -69,7 +69,7 @@ func FuncRecover(smc sdk.ISmartContract, response *bcType.Response) {
 		if _, ok := err.(types.Error); ok {
 			e := err.(types.Error)
 
-			if softforks.V2_0_1_13780(smc.Block().Height()) {
+			if !softforks.IsActive("sdkBlockHash", smc.Block().Height()) {
 				response.Code = e.ErrorCode
 				response.Log = e.ErrorDesc
 			} else {
@@ -78,7 +78,7 @@ func FuncRecover(smc sdk.ISmartContract, response *bcType.Response) {
 		} else if e, ok := err.(error); ok {
 			if strings.HasPrefix(e.Error(), "runtime error") {
 				logCaller()
-				if softforks.V2_0_1_13780(smc.Block().Height()) {
+				if !softforks.IsActive("sdkBlockHash", smc.Block().Height()) {
 					response.Code = types.ErrStubDefined
 					response.Log = e.Error()
 				} else {
@@ -89,7 +89,7 @@ func FuncRecover(smc sdk.ISmartContract, response *bcType.Response) {
 				}
 			} else if _, ok = recoverPanicMap[e.Error()]; ok {
 				logCaller()
-				if softforks.V2_0_1_13780(smc.Block().Height()) {
+				if !softforks.IsActive("sdkBlockHash", smc.Block().Height()) {
 					response.Code = types.ErrStubDefined
 					response.Log = e.Error()
 				} else {
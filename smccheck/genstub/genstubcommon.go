@@ -1,6 +1,7 @@
 package genstub
 
 import (
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
 	"github.com/bcbchain/bcbchain/smccheck/parsecode"
 	"bytes"
 	"os"
@@ -224,14 +225,34 @@ func Init(forksBytes []byte) {
 	}
 }
 
-// Fixs bug #4281, sdk block hash not equal tendermint block hahs.
-// Adds the softfork to reset sdk block hash
-func V2_0_1_13780(blockHeight int64) bool {
-	if forkInfo, ok := TagToForkInfo["fork-abci#2.0.1.13780"]; ok {
-		return blockHeight < forkInfo.EffectBlockHeight
+type feature struct {
+	tag           string
+	window        bool
+	defaultActive bool
+}
+
+// features of contracts in containers, they're generated from features registered in bcchain
+var features = map[string]feature{
+{{- range .}}
+	"{{.Name}}": {tag: "{{.Tag}}", window: {{.Window}}, defaultActive: {{.Default}}},
+{{- end}}
+}
+
+//IsActive returns whether feature is active at height, it panics if feature isn't registered
+func IsActive(name string, blockHeight int64) bool {
+	f, ok := features[name]
+	if !ok {
+		panic("unknown softfork feature " + name)
 	}
 
-	return false
+	forkInfo, ok := TagToForkInfo[f.tag]
+	if !ok {
+		return f.defaultActive
+	}
+	if f.window {
+		return blockHeight > forkInfo.BugBlockHeight && blockHeight < forkInfo.EffectBlockHeight
+	}
+	return blockHeight >= forkInfo.EffectBlockHeight
 }`
 
 // GenStubCommon - generate the stub common go source
@@ -318,7 +339,7 @@ func genSoftforks(rootDir string) error {
 
 	var buf bytes.Buffer
 
-	if err = tmpl.Execute(&buf, nil); err != nil {
+	if err = tmpl.Execute(&buf, softforks.Features(softforks.ScopeContainers)); err != nil {
 		return err
 	}
 
@@ -63,7 +63,12 @@ func SetDockerLogLevel(url, level string, logger log.Logger) {
 }
 
 func InitDockerSoftForks(url string, logger log.Logger) {
-	forksBytes, err := jsoniter.Marshal(softforks.TagToForkInfo)
+	// only forks of features in containers are sent, keyed by tag as before
+	forks := make(map[string]softforks.ForkInfo)
+	for _, forkInfo := range softforks.Forks(softforks.ScopeContainers) {
+		forks[forkInfo.Tag] = forkInfo
+	}
+	forksBytes, err := jsoniter.Marshal(forks)
 	if err != nil {
 		panic(err)
 	}
@@ -9,6 +9,7 @@ import (
 	types2 "github.com/bcbchain/bclib/tendermint/abci/types"
 	"sync"
 
+	"github.com/bcbchain/bclib/tendermint/tmlibs/common"
 	"github.com/bcbchain/bclib/tendermint/tmlibs/log"
 )
 
@@ -54,6 +55,19 @@ func (ad *Adapter) InvokeTx(
 	publicKey types.PubKey,
 	txHash types.Hash,
 	blockHash types.Hash) *types.Response {
+
+	return ad.InvokeSponsoredTx(blockHeader, transID, txID, sender, "", tx, publicKey, txHash, blockHash)
+}
+
+//InvokeSponsoredTx invokes tx whose fee is paid by sponsor if it's not empty, BVM tx can't be sponsored
+func (ad *Adapter) InvokeSponsoredTx(
+	blockHeader types2.Header,
+	transID, txID int64,
+	sender, sponsor types.Address,
+	tx types.Transaction,
+	publicKey types.PubKey,
+	txHash types.Hash,
+	blockHash types.Hash) *types.Response {
 	// Sender can do nothing if it's in black list
 	if statedbhelper.CheckBlackList(transID, txID, sender) == true {
 		err := types.BcError{
@@ -67,16 +81,28 @@ func (ad *Adapter) InvokeTx(
 
 	methodID := tx.Messages[len(tx.Messages)-1].MethodID
 	if methodID == 0 || methodID == 0xFFFFFFFF {
+		if sponsor != "" {
+			return &types.Response{
+				Code: types.ErrLogicError,
+				Log:  "BVM tx can't be sponsored",
+			}
+		}
 		if !statedbhelper.CheckBVMEnable(transID, txID) {
 			return &types.Response{
 				Code: types.ErrLogicError,
 				Log:  "BVM is disabled",
 			}
 		}
+		invokermgr.GetInstance().AddInvocations(transID, txID, 1)
 		return burrow.GetInstance(ad.logger).InvokeTx(blockHeader, blockHash, transID, txID, sender, tx, publicKey)
 	}
 
-	return invokermgr.GetInstance().InvokeTx(blockHeader, transID, txID, sender, tx, publicKey, txHash, blockHash)
+	return invokermgr.GetInstance().InvokeSponsoredTx(blockHeader, transID, txID, sender, sponsor, tx, publicKey, txHash, blockHash)
+}
+
+//TakeInvocations returns count of contracts invoked by the last invoking of tx and forgets it
+func (ad *Adapter) TakeInvocations(transID, txID int64) int64 {
+	return invokermgr.GetInstance().TakeInvocations(transID, txID)
 }
 
 //Commit commit transaction
@@ -94,6 +120,16 @@ func (ad *Adapter) RollbackTx(transID, txID int64) {
 	invokermgr.GetInstance().RollbackTx(transID, txID)
 }
 
+//CleansDockerCache checks whether receipts of tx clean cache of dockers
+func (ad *Adapter) CleansDockerCache(tags []common.KVPair) bool {
+	return invokermgr.CleansDockerCache(tags)
+}
+
+//DirtyToken cleans cache of token in all dockers, if it's changed out of contracts
+func (ad *Adapter) DirtyToken(tokenAddr types.Address) {
+	invokermgr.GetInstance().McDirtyToken(tokenAddr)
+}
+
 // InitSMC init or upgrade chain for smart contact
 func (ad *Adapter) InitOrUpdateSMC(transId, txId int64, header types2.Header, contractAddr, owner types.Address, isUpgarde bool) (result *types.Response) {
 	result = invokermgr.GetInstance().InitOrUpdateSMC(transId, txId, header, contractAddr, owner, isUpgarde)
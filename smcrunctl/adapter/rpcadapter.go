@@ -9,6 +9,7 @@ import (
 
 	"github.com/bcbchain/bcbchain/abciapp/common"
 	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/common/txindex"
 	rpcclient "github.com/bcbchain/bclib/rpc/lib/client"
 	"github.com/bcbchain/bclib/socket"
 	"github.com/bcbchain/bclib/tendermint/go-crypto"
@@ -41,8 +42,16 @@ const (
 var Routes = map[string]socket.CallBackFunc{
 	"get":   SdbGet,
 	"set":   SdbSet,
+	"keys":  SdbKeys,
 	"build": SdbBuild,
 	"block": GetBlock,
+
+	"schedule":    Schedule,
+	"blocklimits": SetBlockLimits,
+
+	"subscribe":   Subscribe,
+	"poll":        PollEvents,
+	"unsubscribe": Unsubscribe,
 }
 
 var logger log.Logger
@@ -86,7 +95,7 @@ func processSDKGet(key, prefix string) (interface{}, error) {
 			return string(res), nil
 		}
 
-		txResult, err := Tx(subList[2])
+		txResult, err := indexedTx(subList[2])
 		if err != nil {
 			result.Code = types2.ErrInvalidParameter
 			result.Msg = err.Error()
@@ -127,6 +136,21 @@ func SdbSet(req map[string]interface{}) (result interface{}, err error) {
 	return Set(transID, txID, data)
 }
 
+//SdbKeys calls sdb keys function
+func SdbKeys(req map[string]interface{}) (result interface{}, err error) {
+
+	transID := int64(req["transID"].(float64))
+	txID := int64(req["txID"].(float64))
+	prefix := req["prefix"].(string)
+	limit := 0
+	if l, ok := req["limit"].(float64); ok {
+		limit = int(l)
+	}
+
+	rBytes, err := Keys(transID, txID, prefix, limit)
+	return string(rBytes), err
+}
+
 //SdbBuild calls sdb build function
 func SdbBuild(req map[string]interface{}) (result interface{}, err error) {
 
@@ -207,6 +231,27 @@ func GetBlock(req map[string]interface{}) (result interface{}, err error) {
 	return
 }
 
+// indexedTx gets tx from tx index, or from tendermint if tx isn't indexed.
+func indexedTx(txHash string) (result string, err error) {
+	if !txindex.Enabled() {
+		return Tx(txHash)
+	}
+
+	record, err := txindex.Get(txHash)
+	if err != nil {
+		return "", err
+	}
+	if record == nil {
+		return Tx(txHash)
+	}
+
+	resultByte, err := jsoniter.Marshal(record.TxResult())
+	if err != nil {
+		return "", err
+	}
+	return string(resultByte), nil
+}
+
 func Tx(txHash string) (result string, err error) {
 	if len(txHash) > 2 && txHash[:2] == "0x" {
 		txHash = txHash[2:]
@@ -0,0 +1,37 @@
+package adapter
+
+import (
+	"errors"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/bcbchain/smcrunctl/invokermgr"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+//SetBlockLimits updates block limits of all effect heights for governance contract, limits effective
+//before the next block can't be changed.
+func SetBlockLimits(req map[string]interface{}) (result interface{}, err error) {
+	transID := int64(req["transID"].(float64))
+	txID := int64(req["txID"].(float64))
+	limitsStr, ok := req["limits"].(string)
+	if !ok {
+		return nil, errors.New("invalid limits")
+	}
+	limits := make([]statedbhelper.BlockLimits, 0)
+	if err = jsoniter.Unmarshal([]byte(limitsStr), &limits); err != nil {
+		return nil, err
+	}
+
+	// world app state is of the last block
+	height := statedbhelper.GetWorldAppState(transID, txID).BlockHeight + 1
+	if !softforks.IsActive(softforks.BlockLimits, height) {
+		return nil, errors.New("block limits are not enabled")
+	}
+
+	contract := invokermgr.GetInstance().InvokingContract(transID, txID)
+	if err = statedbhelper.UpdateBlockLimitsByContract(transID, txID, contract, limits, height); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package adapter
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bcbchain/bcbchain/abciapp/service/events"
+)
+
+//Subscribe subscribes block, tx and receipt events matching query, it returns ID of subscription
+func Subscribe(req map[string]interface{}) (result interface{}, err error) {
+	qry, _ := req["query"].(string)
+	logger.Debug("Adapter RPC", "subscribe", qry)
+
+	id, err := events.NewSubscription(qry)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"id": id}, nil
+}
+
+//PollEvents returns events of subscription, it waits at most "wait" milliseconds for the first event
+func PollEvents(req map[string]interface{}) (result interface{}, err error) {
+	id, ok := req["id"].(string)
+	if !ok {
+		return nil, errors.New("invalid id")
+	}
+	wait, _ := req["wait"].(float64)
+
+	return events.Poll(id, time.Duration(wait)*time.Millisecond)
+}
+
+//Unsubscribe cancels subscription
+func Unsubscribe(req map[string]interface{}) (result interface{}, err error) {
+	id, ok := req["id"].(string)
+	if !ok {
+		return nil, errors.New("invalid id")
+	}
+
+	return nil, events.Unsubscribe(id)
+}
@@ -0,0 +1,34 @@
+package adapter
+
+import (
+	"errors"
+
+	"github.com/bcbchain/bcbchain/abciapp/softforks"
+	"github.com/bcbchain/bcbchain/common/statedbhelper"
+	"github.com/bcbchain/sdk/sdk/jsoniter"
+)
+
+//Schedule schedules signed tx handed to contract at height of its note "schedule:<height>",
+//it returns the scheduled call, contract emits receipt of it.
+func Schedule(req map[string]interface{}) (result interface{}, err error) {
+	transID := int64(req["transID"].(float64))
+	txID := int64(req["txID"].(float64))
+	tx, ok := req["tx"].(string)
+	if !ok {
+		return nil, errors.New("invalid tx")
+	}
+
+	// world app state is of the last block
+	height := statedbhelper.GetWorldAppState(transID, txID).BlockHeight + 1
+	if !softforks.IsActive(softforks.ScheduledCall, height) {
+		return nil, errors.New("scheduled call is not enabled")
+	}
+
+	call, err := statedbhelper.ScheduleSignedTx(transID, txID, tx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	resBytes, _ := jsoniter.Marshal(call)
+	return string(resBytes), nil
+}
@@ -8,6 +8,7 @@ var (
 	get   GetCallback
 	set   SetCallback
 	build BuildCallback
+	keys  KeysCallback
 )
 
 //GetCallback callback of get()
@@ -16,6 +17,9 @@ type GetCallback func(int64, int64, string) ([]byte, error)
 //SetCallback callback of set()
 type SetCallback func(int64, int64, map[string][]byte) (*bool, error)
 
+//KeysCallback callback of keys()
+type KeysCallback func(int64, int64, string, int) ([]byte, error)
+
 //BuildCallback callback of build()
 type BuildCallback func(int64, int64, std.ContractMeta) (*std.BuildResult, error)
 
@@ -26,6 +30,11 @@ func SetSdbCallback(getFunc GetCallback, setFunc SetCallback, buildCallback Buil
 	build = buildCallback
 }
 
+//SetSdbKeysCallback set sdb callback of listing keys
+func SetSdbKeysCallback(keysFunc KeysCallback) {
+	keys = keysFunc
+}
+
 //Get get key's value from sdb
 func Get(transID, txID int64, key string) ([]byte, error) {
 	return get(transID, txID, key)
@@ -36,6 +45,11 @@ func Set(transID, txID int64, data map[string][]byte) (*bool, error) {
 	return set(transID, txID, data)
 }
 
+//Keys list keys with prefix from sdb
+func Keys(transID, txID int64, prefix string, limit int) ([]byte, error) {
+	return keys(transID, txID, prefix, limit)
+}
+
 //Build build contract and save to sdb
 func Build(transID, txID int64, contractMeta std.ContractMeta) (*std.BuildResult, error) {
 
@@ -36,6 +36,17 @@ type TxID2ContractAddrMap struct {
 	Map map[int64][]string
 }
 
+// TxID2CountMap - txID to count of invocations
+type TxID2CountMap struct {
+	Map map[int64]int64
+}
+
+// invokingKey - key of tx in invokingMap
+type invokingKey struct {
+	transID int64
+	txID    int64
+}
+
 // InvokerMgr - class of invoke manager
 type InvokerMgr struct {
 	logger log.Logger
@@ -45,7 +56,12 @@ type InvokerMgr struct {
 	dockerUrlMap          sync.Map // map[transID]map[url]struct{}
 	dockerMapConnPool     sync.Map // map[url]*socket.ConnectionPool
 	transIDToContractAddr sync.Map // map[transID]map[txID][]types.Address
+	invocationMap         sync.Map // map[transID]map[txID]count of contracts invoked by tx
+	invokingMap           sync.Map // map[invokingKey]address of contract whose message is being invoked
 	contractBuffer        sync.Map // map[contractAddr_methodID]gas/map[contract]acctAddr/map[contractToken]token
+
+	mapMtx sync.Mutex // guards inner maps of transMap, dockerUrlMap, transIDToContractAddr and invocationMap
+	urlMtx sync.Mutex // txs of a block may be invoked in parallel, dockers are started one by one
 }
 
 var (
@@ -81,6 +97,9 @@ func (im *InvokerMgr) Init(log log.Logger) {
 func (im *InvokerMgr) DirtyURL(url string) {
 	im.dockerMapConnPool.Delete(url)
 
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
 	im.dockerUrlMap.Range(func(key, value interface{}) bool {
 		urlMap := value.(*UrlMap)
 		delete(urlMap.Map, url)
@@ -136,6 +155,19 @@ func (im *InvokerMgr) InvokeTx(
 	txHash types.Hash,
 	blockHash types.Hash) (result *types.Response) {
 
+	return im.InvokeSponsoredTx(blockHeader, transId, txId, sender, "", tx, pubKey, txHash, blockHash)
+}
+
+// InvokeSponsoredTx - invoke tx's message one by one, sponsor pays fee instead of sender if it's not empty
+func (im *InvokerMgr) InvokeSponsoredTx(
+	blockHeader types2.Header,
+	transId, txId int64,
+	sender, sponsor types.Address,
+	tx types.Transaction,
+	pubKey types.PubKey,
+	txHash types.Hash,
+	blockHash types.Hash) (result *types.Response) {
+
 	//从tx中解析出多个Message，InvokeMessage
 	receipts := make([]common.KVPair, 0)
 	result = new(types.Response)
@@ -151,12 +183,16 @@ func (im *InvokerMgr) InvokeTx(
 			result.Log = e.Error()
 			return
 		}
+		if sponsor != "" && payer == sender {
+			payer = sponsor
+		}
 
 		url, result, err = im.invoke(blockHeader, transId, txId, tx.GasLimit-gasUsed, sender, payer, tx, message, result.Tags, pubKey, txHash, blockHash)
 
 		// 无论失败与成功，均将收据和Fee等数据返回给调用者
 		// 调用者是 checker将会把无用数据丢弃， deliver根据手续费收据从发送者账户扣除手续费
-		if len(urls) != 0 && !inSlice(url, urls) {
+		// 分叉前 urls 始终为空，失败交易在 docker 中的缓存留到区块结束
+		if softforks.IsActive(softforks.ParallelDeliver, blockHeader.Height) && url != "" && !inSlice(url, urls) {
 			urls = append(urls, url)
 		}
 		// 在收据前部加上message序号
@@ -193,7 +229,7 @@ func (im *InvokerMgr) InvokeTx(
 	}
 
 	// if height in [23706999, forkHeight] then reset gas_used
-	if softforks.V2_0_2_14654(blockHeader.Height) {
+	if softforks.IsActive(softforks.ResetGasUsed, blockHeader.Height) {
 		im.resetGasUsed(blockHeader.Height, result, tx)
 	}
 
@@ -232,7 +268,9 @@ func (im *InvokerMgr) invoke(
 	var to types.Address
 
 	//进行rpc调用
+	im.urlMtx.Lock()
 	contractAddr, url, err := smcdocker.GetInstance().GetContractInvokeURL(transId, txId, message.Contract)
+	im.urlMtx.Unlock()
 	if err != nil {
 		error.ErrorCode = types.ErrInternalFailed
 		error.ErrorDesc = err.Error()
@@ -268,7 +306,7 @@ func (im *InvokerMgr) invoke(
 		Message:         message,
 		Receipts:        receipts,
 		SenderPublicKey: pubKey}
-	if softforks.V2_0_1_13780(blockHeader.Height) {
+	if !softforks.IsActive(softforks.SdkBlockHash, blockHeader.Height) {
 		invokeParam.BlockHash = nil
 	} else {
 		invokeParam.BlockHash = blockHash
@@ -287,12 +325,15 @@ func (im *InvokerMgr) invoke(
 	if message.Contract == std.GetGenesisContractAddr(statedbhelper.GetChainID()) {
 		timeout = 300
 	}
+	im.invokingMap.Store(invokingKey{transId, txId}, message.Contract)
 	resp, err := cli.Call("Invoke", map[string]interface{}{"blockHeader": blockHeader, "transID": transId, "txID": txId, "callParam": invokeParam}, timeout)
+	im.invokingMap.Delete(invokingKey{transId, txId})
 	if err != nil {
 		im.logger.Info("Client call error: " + err.Error())
 		// 之前有在失败时再重试一次，现在改为失败了直接 panic
 		panic(err)
 	}
+	im.AddInvocations(transId, txId, 1)
 	result = new(types.Response)
 	err = jsoniter.Unmarshal([]byte(resp.(string)), result)
 	if err != nil {
@@ -308,42 +349,29 @@ func (im *InvokerMgr) invoke(
 // Rollback - rollback transaction's data when it failed
 func (im *InvokerMgr) Rollback(transID int64) {
 	//依次获取url，进行rollback
-	if v, ok := im.dockerUrlMap.Load(transID); ok {
-		urlMap := v.(*UrlMap).Map
-		for url := range urlMap {
-			pool := im.dockerConnPool(transID, url)
-			cli, err := pool.GetClient()
-			if err != nil {
-				panic(err)
-			}
+	for _, url := range im.dockerURLs(transID) {
+		pool := im.dockerConnPool(transID, url)
+		cli, err := pool.GetClient()
+		if err != nil {
+			panic(err)
+		}
 
-			_, err = cli.Call("McDirtyTrans", map[string]interface{}{"transID": transID}, 60)
-			if err != nil {
-				panic(err)
-			}
-			pool.ReleaseClient(cli)
+		_, err = cli.Call("McDirtyTrans", map[string]interface{}{"transID": transID}, 60)
+		if err != nil {
+			panic(err)
 		}
+		pool.ReleaseClient(cli)
 	}
 
 	im.dockerUrlMap.Delete(transID)
 	im.transMap.Delete(transID)
 	im.transIDToContractAddr.Delete(transID)
+	im.invocationMap.Delete(transID)
 }
 
 // RollbackTx - rollback tx's data when it failed
 func (im *InvokerMgr) RollbackTx(transID, txID int64) {
-	v1, ok := im.transMap.Load(transID)
-	if !ok {
-		return
-	}
-
-	vEx := v1.(*TxID2UrlMap).Map
-	urls, ok := vEx[txID]
-	if !ok {
-		return
-	}
-
-	for _, url := range urls {
+	for _, url := range im.takeTxURLs(transID, txID) {
 		pool := im.dockerConnPool(transID, url)
 		cli, err := pool.GetClient()
 		if err != nil {
@@ -356,39 +384,53 @@ func (im *InvokerMgr) RollbackTx(transID, txID int64) {
 		}
 		pool.ReleaseClient(cli)
 	}
+}
 
-	delete(vEx, txID)
+// takeTxURLs - remove urls, new contracts and invocations of tx from maps, return the urls
+func (im *InvokerMgr) takeTxURLs(transID, txID int64) []string {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
 
-	v, ok := im.transIDToContractAddr.Load(transID)
+	v1, ok := im.transMap.Load(transID)
 	if !ok {
-		return
+		return nil
+	}
+
+	vEx := v1.(*TxID2UrlMap).Map
+	urls, ok := vEx[txID]
+	if !ok {
+		return nil
 	}
-	vEx = v.(*TxID2ContractAddrMap).Map
 	delete(vEx, txID)
+
+	if v, ok := im.transIDToContractAddr.Load(transID); ok {
+		delete(v.(*TxID2ContractAddrMap).Map, txID)
+	}
+	if v, ok := im.invocationMap.Load(transID); ok {
+		delete(v.(*TxID2CountMap).Map, txID)
+	}
+	return urls
 }
 
 // Commit - commit data when block finished
 func (im *InvokerMgr) Commit(transId int64) {
 
 	//依次获取url，进行commit
-	if v, ok := im.dockerUrlMap.Load(transId); ok {
-		urlMap := v.(*UrlMap).Map
-		for url := range urlMap {
-			pool := im.dockerConnPool(transId, url)
-			cli, err := pool.GetClient()
-			if err != nil {
-				panic(err)
-			}
+	for _, url := range im.dockerURLs(transId) {
+		pool := im.dockerConnPool(transId, url)
+		cli, err := pool.GetClient()
+		if err != nil {
+			panic(err)
+		}
 
-			result, err := cli.Call("McCommitTrans", map[string]interface{}{"transID": transId}, 60)
-			if err != nil {
-				panic(err)
-			}
-			pool.ReleaseClient(cli)
+		result, err := cli.Call("McCommitTrans", map[string]interface{}{"transID": transId}, 60)
+		if err != nil {
+			panic(err)
+		}
+		pool.ReleaseClient(cli)
 
-			if !result.(bool) {
-				panic("Commit result is false")
-			}
+		if !result.(bool) {
+			panic("Commit result is false")
 		}
 	}
 
@@ -405,6 +447,7 @@ func (im *InvokerMgr) Commit(transId int64) {
 	im.dockerUrlMap.Delete(transId)
 	im.transMap.Delete(transId)
 	im.transIDToContractAddr.Delete(transId)
+	im.invocationMap.Delete(transId)
 
 	// 检查长时间没有发生交易的docker并杀掉
 	smcdocker.GetInstance().CheckDockerLiveTime()
@@ -566,6 +609,25 @@ func (im *InvokerMgr) cleanDockerCache(result *types.Response) (newContractAddr
 	return
 }
 
+// CleansDockerCache - whether tags has receipts which make cleanDockerCache clean cache of dockers,
+// txs invoked in parallel with such tx may have read cache which is stale now
+func CleansDockerCache(tags []common.KVPair) bool {
+	for _, v := range tags {
+		var receipt std.Receipt
+		if err := jsoniter.Unmarshal(v.Value, &receipt); err != nil {
+			continue
+		}
+
+		switch receipt.Name {
+		case "std::setGasPrice", "std::burn", "std::addSupply", "burnFee",
+			"std::setOwner", "smartcontract.forbidContract", "IBC.setGasPriceRatio", "smartcontract.deployContract":
+			return true
+		}
+	}
+
+	return false
+}
+
 // dockerConnPool get connectionPool object from dockerMapConnPool if it's exist,
 // or NewConnectionPool for create connection pool and object,
 // Note: bNew means the docker pointed by url is new docker,
@@ -688,8 +750,25 @@ func (im *InvokerMgr) Mine(transId, txId int64, header types2.Header, contractAd
 	return
 }
 
+// dockerURLs - urls of dockers invoked in transaction
+func (im *InvokerMgr) dockerURLs(transID int64) []string {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
+	urls := make([]string, 0)
+	if v, ok := im.dockerUrlMap.Load(transID); ok {
+		for url := range v.(*UrlMap).Map {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
 // setValToTransMap - set value to transMap
 func (im *InvokerMgr) setValToTransMap(transID, txID int64, url []string) {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
 	var m *TxID2UrlMap
 	if v, ok := im.transMap.Load(transID); !ok {
 		m = &TxID2UrlMap{Map: make(map[int64][]string)}
@@ -704,6 +783,9 @@ func (im *InvokerMgr) setValToTransMap(transID, txID int64, url []string) {
 
 // setValToTransCon - set value to transContractAddr
 func (im *InvokerMgr) setValToTransCon(transID, txID int64, addrs []string) {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
 	var m *TxID2ContractAddrMap
 	if v, ok := im.transIDToContractAddr.Load(transID); !ok {
 		m = &TxID2ContractAddrMap{Map: make(map[int64][]string)}
@@ -716,8 +798,52 @@ func (im *InvokerMgr) setValToTransCon(transID, txID int64, addrs []string) {
 	im.transIDToContractAddr.Store(transID, m)
 }
 
+// AddInvocations - add count of contracts invoked by tx, adapter adds BVM txs which aren't invoked here
+func (im *InvokerMgr) AddInvocations(transID, txID, count int64) {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
+	var m *TxID2CountMap
+	if v, ok := im.invocationMap.Load(transID); !ok {
+		m = &TxID2CountMap{Map: make(map[int64]int64)}
+	} else {
+		m = v.(*TxID2CountMap)
+	}
+
+	m.Map[txID] += count
+
+	im.invocationMap.Store(transID, m)
+}
+
+// TakeInvocations - remove count of contracts invoked by tx from map, return the count
+func (im *InvokerMgr) TakeInvocations(transID, txID int64) int64 {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
+	v, ok := im.invocationMap.Load(transID)
+	if !ok {
+		return 0
+	}
+
+	m := v.(*TxID2CountMap).Map
+	count := m[txID]
+	delete(m, txID)
+	return count
+}
+
+// InvokingContract - address of contract whose message of tx is being invoked, it's empty if tx isn't invoking contract
+func (im *InvokerMgr) InvokingContract(transID, txID int64) types.Address {
+	if v, ok := im.invokingMap.Load(invokingKey{transID, txID}); ok {
+		return v.(types.Address)
+	}
+	return ""
+}
+
 // setValDockerMap - set value to dockerUrlMap
 func (im *InvokerMgr) setValDockerMap(transID int64, url string) {
+	im.mapMtx.Lock()
+	defer im.mapMtx.Unlock()
+
 	var m *UrlMap
 	if v, ok := im.dockerUrlMap.Load(transID); !ok {
 		m = &UrlMap{Map: make(map[string]struct{})}
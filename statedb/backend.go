@@ -0,0 +1,103 @@
+package statedb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Names of builtin backends.
+const (
+	GoLevelDBBackend = "goleveldb" // default, persisted on disk
+	MemDBBackend     = "memdb"     // in memory, data is lost when process exits
+)
+
+// Backend is the key/value storage of state db and snapshot db.
+// Get returns nil without error if key doesn't exist.
+type Backend interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) bool
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	NewBatch() Batch
+	Iterator(start, end []byte, reverse bool) BackendIterator
+	Snapshot() (BackendSnapshot, error)
+	Close()
+}
+
+// Batch writes all data atomically when it's committed.
+type Batch interface {
+	Set(key, value []byte)
+	Delete(key []byte)
+	Commit() error
+}
+
+// BackendIterator iterates over [start, end), nil start or end means unbounded.
+// Key and Value return copies which can be kept by caller.
+type BackendIterator interface {
+	Valid() bool
+	Next()
+	Key() []byte
+	Value() []byte
+	Close()
+}
+
+// BackendSnapshot is a read-only view of backend at the time it's taken,
+// it must be released after using.
+type BackendSnapshot interface {
+	Get(key []byte) ([]byte, error)
+	Iterator(start, end []byte, reverse bool) BackendIterator
+	Release()
+}
+
+// BackendCreator opens or creates the backend with name.
+type BackendCreator func(name string) (Backend, error)
+
+var (
+	backendsMtx sync.RWMutex
+	backends    = map[string]BackendCreator{
+		GoLevelDBBackend: func(name string) (Backend, error) { return openGoLevelDB(name) },
+		MemDBBackend:     func(name string) (Backend, error) { return openMemDB(name) },
+	}
+)
+
+// RegisterBackend registers creator of backend, it panics if the name is used.
+func RegisterBackend(backend string, creator BackendCreator) {
+	backendsMtx.Lock()
+	defer backendsMtx.Unlock()
+
+	if _, ok := backends[backend]; ok {
+		panic(fmt.Sprintf("backend %s is already registered", backend))
+	}
+	backends[backend] = creator
+}
+
+// Backends returns names of registered backends.
+func Backends() []string {
+	backendsMtx.RLock()
+	defer backendsMtx.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func openBackend(backend, name string) (Backend, error) {
+	backendsMtx.RLock()
+	creator, ok := backends[backend]
+	backendsMtx.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %s", backend)
+	}
+	return creator(name)
+}
+
+// OpenBackend opens or creates a standalone backend with name, it's used by databases
+// kept beside state db, such as the tx index.
+func OpenBackend(backend, name string) (Backend, error) {
+	return openBackend(backend, name)
+}
@@ -0,0 +1,97 @@
+package statedb
+
+import (
+	"fmt"
+	"github.com/bcbchain/bclib/jsoniter"
+	"os"
+	"path/filepath"
+)
+
+// backupBatchSize is the count of keys written to backup in a batch.
+const backupBatchSize = 10000
+
+// Backup copies committed data of state db and snapshot db into new goleveldb databases
+// name.db and name.snapshot.db in dir, while state db keeps committing. Both are copied
+// from snapshots taken between two commits, it returns ID of the last committed transaction
+// in backup.
+func (s *StateDB) Backup(dir, name string) (int64, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range []string{name, name + ".snapshot"} {
+		if _, err := os.Stat(filepath.Join(dir, n+".db")); err == nil {
+			return 0, fmt.Errorf("backup %s already exists", filepath.Join(dir, n+".db"))
+		}
+	}
+
+	sdbSnapshot, sndbSnapshot, err := s.takeSnapshots()
+	if err != nil {
+		return 0, err
+	}
+	defer sdbSnapshot.Release()
+	defer sndbSnapshot.Release()
+
+	var transactionID int64
+	if value, err := sdbSnapshot.Get([]byte(keyOfLastTransactionID())); err != nil {
+		return 0, err
+	} else if len(value) != 0 {
+		if err := jsoniter.Unmarshal(value, &transactionID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := copySnapshot(sdbSnapshot, filepath.Join(dir, name)); err != nil {
+		return 0, err
+	}
+	if err := copySnapshot(sndbSnapshot, filepath.Join(dir, name+".snapshot")); err != nil {
+		return 0, err
+	}
+
+	return transactionID, nil
+}
+
+// takeSnapshots takes snapshots of state db and snapshot db with no commit in between.
+func (s *StateDB) takeSnapshots() (BackendSnapshot, BackendSnapshot, error) {
+	s.commitMtx.Lock()
+	defer s.commitMtx.Unlock()
+
+	sdbSnapshot, err := s.sdb.Snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sndbSnapshot, err := s.snapshot.snapshotDB.Snapshot()
+	if err != nil {
+		sdbSnapshot.Release()
+		return nil, nil, err
+	}
+
+	return sdbSnapshot, sndbSnapshot, nil
+}
+
+func copySnapshot(sn BackendSnapshot, name string) error {
+	db, err := openGoLevelDB(name)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	it := sn.Iterator(nil, nil, false)
+	defer it.Close()
+
+	batch, count := db.NewBatch(), 0
+	for ; it.Valid(); it.Next() {
+		batch.Set(it.Key(), it.Value())
+		count++
+
+		if count == backupBatchSize {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			batch, count = db.NewBatch(), 0
+		}
+	}
+
+	return batch.Commit()
+}
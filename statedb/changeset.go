@@ -0,0 +1,234 @@
+package statedb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Change is a state key changed by a block, empty New means the key is deleted.
+type Change struct {
+	Key string `json:"key"`
+	Old []byte `json:"old,omitempty"`
+	New []byte `json:"new,omitempty"`
+}
+
+// ChangeSet is all state changes of a committed transaction, changes are sorted by key.
+// A rollback emits a change set with Rollback set, its TransactionID is the last transaction
+// left after rolling back, and its changes restore the state to that transaction.
+type ChangeSet struct {
+	TransactionID int64    `json:"transactionID"`
+	Height        int64    `json:"height"`
+	Rollback      bool     `json:"rollback,omitempty"`
+	Changes       []Change `json:"changes"`
+}
+
+// HeightFunc returns block height of the state read by get.
+type HeightFunc func(get func(key string) []byte) int64
+
+// SetHeightFunc sets how to get block height of change sets, height is 0 if it's not set.
+func (s *StateDB) SetHeightFunc(f HeightFunc) {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	s.heightFunc = f
+}
+
+// Subscribe returns a channel which receives change sets committed after subscribing, in order.
+// Commit never waits for subscribers, the channel of a subscriber which can't keep up with
+// bufferSize change sets is closed and the subscription is removed, the outbox can be used
+// to catch up.
+func (s *StateDB) Subscribe(subscriber string, bufferSize int) (<-chan *ChangeSet, error) {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	if _, ok := s.subscribers[subscriber]; ok {
+		return nil, fmt.Errorf("subscriber %s already exists", subscriber)
+	}
+	if s.subscribers == nil {
+		s.subscribers = make(map[string]chan *ChangeSet)
+	}
+
+	ch := make(chan *ChangeSet, bufferSize)
+	s.subscribers[subscriber] = ch
+	return ch, nil
+}
+
+// Unsubscribe removes the subscription and closes its channel.
+func (s *StateDB) Unsubscribe(subscriber string) {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	if ch, ok := s.subscribers[subscriber]; ok {
+		close(ch)
+		delete(s.subscribers, subscriber)
+	}
+}
+
+// SetOutbox appends change sets to outbox from now on, change sets committed since the last
+// record of outbox are appended first if their snapshots are retained.
+func (s *StateDB) SetOutbox(outbox *Outbox) error {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	if err := s.syncOutbox(outbox); err != nil {
+		return err
+	}
+	s.outbox = outbox
+	return nil
+}
+
+func (s *StateDB) hasFeed() bool {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	return s.outbox != nil || len(s.subscribers) != 0
+}
+
+// publish appends change set to outbox and sends it to subscribers, state db must
+// have been written so the height is read from it.
+func (s *StateDB) publish(cs *ChangeSet) {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	if s.outbox == nil && len(s.subscribers) == 0 {
+		return
+	}
+
+	s.withHeight(cs, s.Get)
+	if s.outbox != nil {
+		if err := s.outbox.Append(cs); err != nil {
+			// state db is committed already, outbox catches up when it's opened again
+			logger.Error("statedb outbox is broken, change sets aren't appended until it's opened again",
+				"transactionID", cs.TransactionID, "error", err)
+			s.outbox = nil
+		}
+	}
+
+	for subscriber, ch := range s.subscribers {
+		select {
+		case ch <- cs:
+		default:
+			logger.Error("statedb change set subscriber is too slow, unsubscribed", "subscriber", subscriber)
+			close(ch)
+			delete(s.subscribers, subscriber)
+		}
+	}
+}
+
+// syncOutbox appends the change sets outbox missed while it was not attached.
+func (s *StateDB) syncOutbox(outbox *Outbox) error {
+	last := s.LastVersion()
+	outboxLast, ok := outbox.LastID()
+	if !ok {
+		// new outbox starts from current state
+		return nil
+	}
+
+	if outboxLast > last {
+		// rolled back without the outbox, keys of change sets after last version are restored
+		keys, err := outbox.keysAfter(last)
+		if err != nil {
+			return err
+		}
+
+		changes := make([]Change, 0, len(keys))
+		for _, k := range keys {
+			changes = append(changes, Change{Key: k, New: s.Get(k)})
+		}
+		return outbox.Append(s.withHeight(&ChangeSet{TransactionID: last, Rollback: true, Changes: changes}, s.Get))
+	}
+
+	from := outboxLast + 1
+	if oldest := s.OldestVersion(); from <= oldest {
+		logger.Error("statedb change sets are pruned, outbox skips them", "from", from, "to", oldest)
+		from = oldest + 1
+	}
+	for id := from; id <= last; id++ {
+		version := id
+		cs := &ChangeSet{
+			TransactionID: id,
+			Changes:       changesOf(s.snapshot.getOriginData(id), s.snapshot.getNewData(id)),
+		}
+		get := func(key string) []byte {
+			value, err := s.GetAtVersion(key, version)
+			if err != nil {
+				panic(err)
+			}
+			return value
+		}
+		if err := outbox.Append(s.withHeight(cs, get)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StateDB) withHeight(cs *ChangeSet, get func(key string) []byte) *ChangeSet {
+	if s.heightFunc != nil {
+		cs.Height = s.heightFunc(get)
+	}
+	return cs
+}
+
+// heightOfCommit returns block height of the state after buffer is committed.
+func (s *StateDB) heightOfCommit(buffer map[string][]byte) int64 {
+	s.feedMtx.Lock()
+	defer s.feedMtx.Unlock()
+
+	get := func(key string) []byte {
+		if value, ok := buffer[key]; ok {
+			return value
+		}
+		return s.Get(key)
+	}
+	return s.withHeight(&ChangeSet{}, get).Height
+}
+
+// rollbackChangeSet collects changes of rolling back to the transaction before targetID,
+// New of the changes are filled by fillNew after rolling back.
+func (s *StateDB) rollbackChangeSet(targetID int64) *ChangeSet {
+	keys, err := s.ChangedKeys(targetID-1, s.LastVersion())
+	if err != nil {
+		panic(err)
+	}
+
+	cs := &ChangeSet{TransactionID: targetID - 1, Rollback: true, Changes: make([]Change, 0, len(keys))}
+	for _, k := range keys {
+		if isStateKey(k) {
+			cs.Changes = append(cs.Changes, Change{Key: k, Old: s.Get(k)})
+		}
+	}
+	return cs
+}
+
+func (cs *ChangeSet) fillNew(get func(key string) []byte) {
+	changes := cs.Changes[:0]
+	for _, c := range cs.Changes {
+		c.New = get(c.Key)
+		if !bytes.Equal(c.Old, c.New) {
+			changes = append(changes, c)
+		}
+	}
+	cs.Changes = changes
+}
+
+// changesOf returns sorted changes of state keys, internal keys such as
+// merkle nodes are left out.
+func changesOf(originData, newData map[string][]byte) []Change {
+	keys := make([]string, 0, len(newData))
+	for k := range newData {
+		if isStateKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]Change, 0, len(keys))
+	for _, k := range keys {
+		if !bytes.Equal(originData[k], newData[k]) {
+			changes = append(changes, Change{Key: k, Old: originData[k], New: newData[k]})
+		}
+	}
+	return changes
+}
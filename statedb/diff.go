@@ -0,0 +1,104 @@
+package statedb
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Types of KeyDiff.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// KeyDiff is a key which differs between two states, Old is empty if it's added
+// and New is empty if it's removed.
+type KeyDiff struct {
+	Key  string
+	Type string
+	Old  []byte
+	New  []byte
+}
+
+// Diff compares two iterators in ascending order and returns keys that differ, in order.
+// Both iterators are closed after comparing.
+func Diff(a, b Iterator) []KeyDiff {
+	defer a.Close()
+	defer b.Close()
+
+	diffs := make([]KeyDiff, 0)
+	for a.Valid() || b.Valid() {
+		cmp := 0
+		switch {
+		case !a.Valid():
+			cmp = 1
+		case !b.Valid():
+			cmp = -1
+		default:
+			cmp = strings.Compare(a.Key(), b.Key())
+		}
+
+		switch {
+		case cmp < 0:
+			diffs = append(diffs, KeyDiff{Key: a.Key(), Type: DiffRemoved, Old: a.Value()})
+			a.Next()
+		case cmp > 0:
+			diffs = append(diffs, KeyDiff{Key: b.Key(), Type: DiffAdded, New: b.Value()})
+			b.Next()
+		default:
+			if !bytes.Equal(a.Value(), b.Value()) {
+				diffs = append(diffs, KeyDiff{Key: a.Key(), Type: DiffChanged, Old: a.Value(), New: b.Value()})
+			}
+			a.Next()
+			b.Next()
+		}
+	}
+
+	return diffs
+}
+
+// DiffDB compares committed data of two state db, keys with prefix only.
+func DiffDB(from, to *StateDB, prefix string) []KeyDiff {
+	return Diff(from.NewIterator(IterOptions{Prefix: prefix}), to.NewIterator(IterOptions{Prefix: prefix}))
+}
+
+// DiffVersions compares two versions of state db with the snapshots, keys with prefix only.
+func (s *StateDB) DiffVersions(fromVersion, toVersion int64, prefix string) ([]KeyDiff, error) {
+	low, high := fromVersion, toVersion
+	if low > high {
+		low, high = high, low
+	}
+
+	keys, err := s.ChangedKeys(low, high)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]KeyDiff, 0)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		oldValue, err := s.GetAtVersion(k, fromVersion)
+		if err != nil {
+			return nil, err
+		}
+		newValue, err := s.GetAtVersion(k, toVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case len(oldValue) == 0 && len(newValue) != 0:
+			diffs = append(diffs, KeyDiff{Key: k, Type: DiffAdded, New: newValue})
+		case len(oldValue) != 0 && len(newValue) == 0:
+			diffs = append(diffs, KeyDiff{Key: k, Type: DiffRemoved, Old: oldValue})
+		case !bytes.Equal(oldValue, newValue):
+			diffs = append(diffs, KeyDiff{Key: k, Type: DiffChanged, Old: oldValue, New: newValue})
+		}
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,255 @@
+package statedb
+
+import (
+	"sort"
+	"strings"
+)
+
+// IterOptions declares the key range of an iterator.
+// The range is [Start, End) restricted to keys with Prefix, empty fields mean unbounded.
+type IterOptions struct {
+	Prefix  string // only keys with this prefix
+	Start   string // first key, inclusive
+	End     string // last key, exclusive
+	Reverse bool   // iterate in descending order
+	Limit   int    // max count of items, 0 means no limit
+}
+
+// Iterator iterates over keys in order, it must be closed after using.
+//
+//	it := transaction.NewIterator(IterOptions{Prefix: "/account/ex/"})
+//	defer it.Close()
+//	for ; it.Valid(); it.Next() {
+//		k, v := it.Key(), it.Value()
+//	}
+type Iterator interface {
+	Valid() bool
+	Next()
+	Key() string
+	Value() []byte
+	Close()
+}
+
+// NewIterator returns an iterator over committed data in state db.
+func (s *StateDB) NewIterator(opts IterOptions) Iterator {
+	return newMergedIterator(s, opts)
+}
+
+// NewIterator returns an iterator over transaction buffer and state db,
+// data in buffer overlays state db and zero-length value in buffer means deleted.
+func (t *Transaction) NewIterator(opts IterOptions) Iterator {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return newMergedIterator(t.stateDB, opts, t.buffer)
+}
+
+// NewIterator returns an iterator over tx buffer, transaction buffer and state db,
+// keys visited and the range of options are recorded as read.
+func (t *Tx) NewIterator(opts IterOptions) Iterator {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.transaction.mtx.RLock()
+	defer t.transaction.mtx.RUnlock()
+
+	t.recordReadRange(opts)
+
+	return &txIterator{
+		mergedIterator: newMergedIterator(t.transaction.stateDB, opts, t.transaction.buffer, t.buffer),
+		tx:             t,
+	}
+}
+
+// txIterator records keys it visits to read set of tx.
+type txIterator struct {
+	*mergedIterator
+	tx *Tx
+}
+
+func (it *txIterator) Key() string {
+	key := it.mergedIterator.Key()
+	it.tx.recordRead(key)
+	return key
+}
+
+func (it *txIterator) Value() []byte {
+	it.tx.recordRead(it.mergedIterator.Key())
+	return it.mergedIterator.Value()
+}
+
+// bounds returns key range of options, an empty end means unbounded.
+func (o IterOptions) bounds() (start, end string) {
+	start, end = o.Start, o.End
+
+	if o.Prefix != "" {
+		if start < o.Prefix {
+			start = o.Prefix
+		}
+
+		prefixEnd := prefixEndKey(o.Prefix)
+		if prefixEnd != "" && (end == "" || end > prefixEnd) {
+			end = prefixEnd
+		}
+	}
+
+	return
+}
+
+// prefixEndKey returns the smallest key greater than all keys with prefix,
+// empty string means there is no such key.
+func prefixEndKey(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+
+	return ""
+}
+
+func inRange(key, start, end string) bool {
+	return key >= start && (end == "" || key < end)
+}
+
+type kvPair struct {
+	key   string
+	value []byte
+}
+
+// mergedIterator merges sorted overlay data over state db.
+type mergedIterator struct {
+	db      BackendIterator
+	overlay []kvPair
+	pos     int
+	reverse bool
+	limit   int
+	count   int
+
+	key   string
+	value []byte
+	valid bool
+}
+
+// newMergedIterator creates iterator, the latter buffer overlays the former ones.
+func newMergedIterator(s *StateDB, opts IterOptions, buffers ...map[string][]byte) *mergedIterator {
+	start, end := opts.bounds()
+
+	it := &mergedIterator{
+		reverse: opts.Reverse,
+		limit:   opts.Limit,
+	}
+
+	if end != "" && start >= end {
+		return it
+	}
+
+	merged := make(map[string][]byte)
+	for _, buffer := range buffers {
+		for k, v := range buffer {
+			if inRange(k, start, end) {
+				merged[k] = v
+			}
+		}
+	}
+	it.overlay = make([]kvPair, 0, len(merged))
+	for k, v := range merged {
+		it.overlay = append(it.overlay, kvPair{key: k, value: v})
+	}
+	sort.Slice(it.overlay, func(i, j int) bool {
+		if it.reverse {
+			return it.overlay[i].key > it.overlay[j].key
+		}
+		return it.overlay[i].key < it.overlay[j].key
+	})
+
+	var endBytes []byte
+	if end != "" {
+		endBytes = []byte(end)
+	}
+	it.db = s.sdb.Iterator([]byte(start), endBytes, opts.Reverse)
+
+	it.advance()
+	return it
+}
+
+func (it *mergedIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *mergedIterator) Next() {
+	if !it.valid {
+		panic("iterator is invalid")
+	}
+	it.advance()
+}
+
+func (it *mergedIterator) Key() string {
+	if !it.valid {
+		panic("iterator is invalid")
+	}
+	return it.key
+}
+
+func (it *mergedIterator) Value() []byte {
+	if !it.valid {
+		panic("iterator is invalid")
+	}
+	return it.value
+}
+
+func (it *mergedIterator) Close() {
+	if it.db != nil {
+		it.db.Close()
+		it.db = nil
+	}
+	it.valid = false
+}
+
+// advance moves to next key which is not deleted.
+func (it *mergedIterator) advance() {
+	it.valid = false
+
+	for it.limit <= 0 || it.count < it.limit {
+		dbValid := it.db != nil && it.db.Valid()
+		overlayValid := it.pos < len(it.overlay)
+		if !dbValid && !overlayValid {
+			return
+		}
+
+		var key string
+		var value []byte
+		if !overlayValid {
+			key, value = string(it.db.Key()), it.db.Value()
+			it.db.Next()
+		} else {
+			cmp := 1
+			if dbValid {
+				cmp = strings.Compare(string(it.db.Key()), it.overlay[it.pos].key)
+				if it.reverse {
+					cmp = -cmp
+				}
+			}
+
+			if cmp < 0 {
+				key, value = string(it.db.Key()), it.db.Value()
+				it.db.Next()
+			} else {
+				key, value = it.overlay[it.pos].key, it.overlay[it.pos].value
+				it.pos++
+				if cmp == 0 {
+					it.db.Next()
+				}
+			}
+		}
+
+		if len(value) == 0 {
+			continue
+		}
+
+		it.key, it.value, it.valid = key, value, true
+		it.count++
+		return
+	}
+}
@@ -0,0 +1,183 @@
+package statedb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// goLevelDB wraps goleveldb the same way as bcdb.GILevelDB does, but it also
+// exposes ranged iteration, which bcdb.GILevelDB keeps private.
+type goLevelDB struct {
+	db *leveldb.DB
+}
+
+// openGoLevelDB opens or creates the database with the same path rules as bcdb.OpenDB:
+// an absolute name is used as is, otherwise the database is placed in $HOME.
+func openGoLevelDB(name string) (*goLevelDB, error) {
+	return openGoLevelDBWithOptions(name, nil)
+}
+
+// openGoLevelDBReadOnly opens an existing database, all writes to it fail.
+func openGoLevelDBReadOnly(name string) (*goLevelDB, error) {
+	return openGoLevelDBWithOptions(name, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+}
+
+func openGoLevelDBWithOptions(name string, o *opt.Options) (*goLevelDB, error) {
+	var dbPath string
+	if strings.HasPrefix(name, "/") {
+		dbPath = name + ".db"
+	} else {
+		dbPath = filepath.Join(os.Getenv("HOME"), name+".db")
+	}
+
+	db, err := leveldb.OpenFile(dbPath, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &goLevelDB{db: db}, nil
+}
+
+// Get returns nil without error if key doesn't exist.
+func (l *goLevelDB) Get(key []byte) ([]byte, error) {
+	value, err := l.db.Get(nonNilBytes(key), nil)
+	if err == errors.ErrNotFound {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+func (l *goLevelDB) Has(key []byte) bool {
+	value, _ := l.Get(key)
+	return value != nil
+}
+
+func (l *goLevelDB) Set(key, value []byte) error {
+	return l.db.Put(nonNilBytes(key), nonNilBytes(value), &opt.WriteOptions{Sync: true})
+}
+
+func (l *goLevelDB) Delete(key []byte) error {
+	return l.db.Delete(nonNilBytes(key), &opt.WriteOptions{Sync: true})
+}
+
+func (l *goLevelDB) Close() {
+	_ = l.db.Close()
+}
+
+func (l *goLevelDB) NewBatch() Batch {
+	return &goLevelDBBatch{db: l, batch: new(leveldb.Batch)}
+}
+
+// Iterator returns an iterator over [start, end), nil start or end means unbounded.
+func (l *goLevelDB) Iterator(start, end []byte, reverse bool) BackendIterator {
+	return newDBIterator(l.db.NewIterator(&util.Range{Start: start, Limit: end}, nil), reverse)
+}
+
+// Snapshot returns a read-only view of current data, it must be released after using.
+func (l *goLevelDB) Snapshot() (BackendSnapshot, error) {
+	sn, err := l.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &goLevelDBSnapshot{sn: sn}, nil
+}
+
+type goLevelDBSnapshot struct {
+	sn *leveldb.Snapshot
+}
+
+// Get returns nil without error if key doesn't exist.
+func (s *goLevelDBSnapshot) Get(key []byte) ([]byte, error) {
+	value, err := s.sn.Get(nonNilBytes(key), nil)
+	if err == errors.ErrNotFound {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+func (s *goLevelDBSnapshot) Iterator(start, end []byte, reverse bool) BackendIterator {
+	return newDBIterator(s.sn.NewIterator(&util.Range{Start: start, Limit: end}, nil), reverse)
+}
+
+func (s *goLevelDBSnapshot) Release() {
+	s.sn.Release()
+}
+
+type goLevelDBBatch struct {
+	db    *goLevelDB
+	batch *leveldb.Batch
+}
+
+func (b *goLevelDBBatch) Set(key, value []byte) {
+	b.batch.Put(key, value)
+}
+
+func (b *goLevelDBBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+func (b *goLevelDBBatch) Commit() error {
+	return b.db.db.Write(b.batch, &opt.WriteOptions{Sync: true})
+}
+
+// dbIterator walks a goleveldb iterator in either direction,
+// it's used by both leveldb and memdb backends.
+type dbIterator struct {
+	source  iterator.Iterator
+	reverse bool
+	valid   bool
+}
+
+func newDBIterator(source iterator.Iterator, reverse bool) *dbIterator {
+	var valid bool
+	if reverse {
+		valid = source.Last()
+	} else {
+		valid = source.First()
+	}
+
+	return &dbIterator{source: source, reverse: reverse, valid: valid}
+}
+
+func (it *dbIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *dbIterator) Next() {
+	if it.reverse {
+		it.valid = it.source.Prev()
+	} else {
+		it.valid = it.source.Next()
+	}
+}
+
+// Key returns a copy of current key, goleveldb reuses its buffers.
+func (it *dbIterator) Key() []byte {
+	return append([]byte{}, it.source.Key()...)
+}
+
+// Value returns a copy of current value, goleveldb reuses its buffers.
+func (it *dbIterator) Value() []byte {
+	return append([]byte{}, it.source.Value()...)
+}
+
+func (it *dbIterator) Close() {
+	it.source.Release()
+}
+
+func nonNilBytes(bz []byte) []byte {
+	if bz == nil {
+		return []byte{}
+	}
+	return bz
+}
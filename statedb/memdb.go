@@ -0,0 +1,186 @@
+package statedb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	lvlmemdb "github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// memDBs keeps data of memory backends by name, so a backend can be closed
+// and opened again in the same process like a database on disk.
+var (
+	memDBsMtx sync.Mutex
+	memDBs    = make(map[string]*memDBData)
+)
+
+type memDBData struct {
+	mtx    sync.RWMutex // write lock for batch and set, read lock for get and snapshot
+	db     *lvlmemdb.DB
+	opened bool
+}
+
+// memDB is an in memory backend on the skip list of goleveldb,
+// keys are kept in order and iteration is deterministic.
+type memDB struct {
+	name string
+	data *memDBData
+}
+
+func openMemDB(name string) (*memDB, error) {
+	memDBsMtx.Lock()
+	defer memDBsMtx.Unlock()
+
+	data, ok := memDBs[name]
+	if !ok {
+		data = &memDBData{db: lvlmemdb.New(comparer.DefaultComparer, 0)}
+		memDBs[name] = data
+	}
+	if data.opened {
+		return nil, fmt.Errorf("memdb %s is already opened", name)
+	}
+	data.opened = true
+
+	return &memDB{name: name, data: data}, nil
+}
+
+// newEmptyMemDB returns a memory backend which isn't kept by name.
+func newEmptyMemDB() *memDB {
+	return &memDB{data: &memDBData{db: lvlmemdb.New(comparer.DefaultComparer, 0), opened: true}}
+}
+
+// Get returns nil without error if key doesn't exist.
+func (m *memDB) Get(key []byte) ([]byte, error) {
+	m.data.mtx.RLock()
+	defer m.data.mtx.RUnlock()
+
+	return memDBGet(m.data.db, key)
+}
+
+func (m *memDB) Has(key []byte) bool {
+	m.data.mtx.RLock()
+	defer m.data.mtx.RUnlock()
+
+	return m.data.db.Contains(nonNilBytes(key))
+}
+
+func (m *memDB) Set(key, value []byte) error {
+	m.data.mtx.Lock()
+	defer m.data.mtx.Unlock()
+
+	return m.data.db.Put(nonNilBytes(key), nonNilBytes(value))
+}
+
+func (m *memDB) Delete(key []byte) error {
+	m.data.mtx.Lock()
+	defer m.data.mtx.Unlock()
+
+	return memDBDelete(m.data.db, key)
+}
+
+func (m *memDB) NewBatch() Batch {
+	return &memDBBatch{db: m}
+}
+
+func (m *memDB) Iterator(start, end []byte, reverse bool) BackendIterator {
+	return newDBIterator(m.data.db.NewIterator(&util.Range{Start: start, Limit: end}), reverse)
+}
+
+// Snapshot copies data, so writing isn't blocked by the snapshot.
+func (m *memDB) Snapshot() (BackendSnapshot, error) {
+	m.data.mtx.RLock()
+	defer m.data.mtx.RUnlock()
+
+	db := lvlmemdb.New(comparer.DefaultComparer, m.data.db.Size())
+	it := m.data.db.NewIterator(nil)
+	defer it.Release()
+	for it.Next() {
+		if err := db.Put(it.Key(), it.Value()); err != nil {
+			return nil, err
+		}
+	}
+	return &memDBSnapshot{db: db}, nil
+}
+
+// Close keeps data, it can be opened again with the same name.
+func (m *memDB) Close() {
+	memDBsMtx.Lock()
+	defer memDBsMtx.Unlock()
+
+	m.data.opened = false
+}
+
+func memDBGet(db *lvlmemdb.DB, key []byte) ([]byte, error) {
+	value, err := db.Get(nonNilBytes(key))
+	if errors.Is(err, lvlmemdb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+func memDBDelete(db *lvlmemdb.DB, key []byte) error {
+	err := db.Delete(nonNilBytes(key))
+	if errors.Is(err, lvlmemdb.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// memDBSnapshot is a copy of memDB, it's never written.
+type memDBSnapshot struct {
+	db *lvlmemdb.DB
+}
+
+func (s *memDBSnapshot) Get(key []byte) ([]byte, error) {
+	return memDBGet(s.db, key)
+}
+
+func (s *memDBSnapshot) Iterator(start, end []byte, reverse bool) BackendIterator {
+	return newDBIterator(s.db.NewIterator(&util.Range{Start: start, Limit: end}), reverse)
+}
+
+func (s *memDBSnapshot) Release() {}
+
+type memDBOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+type memDBBatch struct {
+	db  *memDB
+	ops []memDBOp
+}
+
+func (b *memDBBatch) Set(key, value []byte) {
+	b.ops = append(b.ops, memDBOp{key: append([]byte{}, key...), value: append([]byte{}, value...)})
+}
+
+func (b *memDBBatch) Delete(key []byte) {
+	b.ops = append(b.ops, memDBOp{key: append([]byte{}, key...), delete: true})
+}
+
+func (b *memDBBatch) Commit() error {
+	b.db.data.mtx.Lock()
+	defer b.db.data.mtx.Unlock()
+
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = memDBDelete(b.db.data.db, op.key)
+		} else {
+			err = b.db.data.db.Put(op.key, nonNilBytes(op.value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
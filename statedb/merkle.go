@@ -0,0 +1,402 @@
+package statedb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// The state root is the root of a sparse merkle tree over all state keys beginning with "/".
+// A leaf sits at the path of SHA3-256(key) and commits to SHA3-256(value), a subtree which holds
+// only one leaf is replaced by the leaf itself, so the root depends only on the set of key/value.
+//
+//	leaf     = SHA3-256(0x00 || keyHash || valueHash)
+//	internal = SHA3-256(0x01 || left || right)
+//	empty    = 32 zero bytes
+//
+// Nodes are stored in state db as "$smt/node/<hex hash>" => preimage, so they are committed,
+// snapshotted and rolled back together with the data they cover.
+
+const (
+	smtLeafPrefix     byte = 0x00
+	smtInternalPrefix byte = 0x01
+
+	smtHashSize  = 32
+	smtNodeSize  = 1 + 2*smtHashSize
+	smtMaxDepth  = smtHashSize * 8
+	smtChunkSize = 100000 // count of keys applied at once while building the tree from scratch
+)
+
+var smtEmptyHash = make([]byte, smtHashSize)
+
+func keyOfStateRoot() string {
+	return "$smt/root"
+}
+
+func keyOfSMTNode(hash []byte) string {
+	return "$smt/node/" + hex.EncodeToString(hash)
+}
+
+// isStateKey reports whether key is covered by the state root.
+func isStateKey(key string) bool {
+	return strings.HasPrefix(key, "/")
+}
+
+func smtHash(data ...[]byte) []byte {
+	hasher := sha3.New256()
+	for _, d := range data {
+		hasher.Write(d)
+	}
+	return hasher.Sum(nil)
+}
+
+func smtLeafHash(keyHash, valueHash []byte) []byte {
+	return smtHash([]byte{smtLeafPrefix}, keyHash, valueHash)
+}
+
+func smtInternalHash(left, right []byte) []byte {
+	return smtHash([]byte{smtInternalPrefix}, left, right)
+}
+
+// smtBit returns bit of hash at depth, bit 0 goes left and bit 1 goes right.
+func smtBit(hash []byte, depth int) byte {
+	return (hash[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+func isEmptyHash(hash []byte) bool {
+	return len(hash) == 0 || bytes.Equal(hash, smtEmptyHash)
+}
+
+// smtNode is the decoded preimage of a node.
+type smtNode struct {
+	leaf  bool
+	left  []byte // key hash of leaf
+	right []byte // value hash of leaf
+}
+
+func (n *smtNode) encode() []byte {
+	prefix := smtInternalPrefix
+	if n.leaf {
+		prefix = smtLeafPrefix
+	}
+
+	b := make([]byte, 0, smtNodeSize)
+	b = append(b, prefix)
+	b = append(b, n.left...)
+	return append(b, n.right...)
+}
+
+// getSMTNode loads node by hash with the get function, it panics if node is missing.
+func getSMTNode(get func(key string) []byte, hash []byte) *smtNode {
+	value := get(keyOfSMTNode(hash))
+	if len(value) != smtNodeSize {
+		panic("missing state tree node " + hex.EncodeToString(hash))
+	}
+
+	return &smtNode{
+		leaf:  value[0] == smtLeafPrefix,
+		left:  value[1 : 1+smtHashSize],
+		right: value[1+smtHashSize:],
+	}
+}
+
+// smtOp sets or deletes (nil valueHash) a leaf.
+type smtOp struct {
+	keyHash   []byte
+	valueHash []byte
+}
+
+func sortSMTOps(ops []smtOp) {
+	sort.Slice(ops, func(i, j int) bool {
+		return bytes.Compare(ops[i].keyHash, ops[j].keyHash) < 0
+	})
+}
+
+// smtUpdater applies ops to the tree in transaction buffer.
+type smtUpdater struct {
+	t     *Transaction
+	nodes map[string]bool // nodes touched by update, false means it's no longer in the tree
+}
+
+// CalcStateRoot applies the changes in transaction buffer to the state tree,
+// stores new nodes to buffer and returns the new state root.
+// Keys in excludeKeys are left out of the tree, it must be the same at every call.
+// If the tree doesn't exist yet, it's built from all data in state db first.
+func (t *Transaction) CalcStateRoot(excludeKeys ...string) []byte {
+	excluded := make(map[string]struct{}, len(excludeKeys))
+	for _, k := range excludeKeys {
+		excluded[k] = struct{}{}
+	}
+
+	u := &smtUpdater{
+		t:     t,
+		nodes: make(map[string]bool),
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	root := t.get(keyOfStateRoot())
+	if len(root) == 0 {
+		root = u.build(excluded)
+	} else {
+		ops := make([]smtOp, 0)
+		for k, v := range t.buffer {
+			if _, ok := excluded[k]; ok || !isStateKey(k) {
+				continue
+			}
+			op := smtOp{keyHash: smtHash([]byte(k))}
+			if len(v) != 0 {
+				op.valueHash = smtHash(v)
+			}
+			ops = append(ops, op)
+		}
+		sortSMTOps(ops)
+		root = u.update(root, 0, ops)
+	}
+	u.prune()
+
+	t.buffer[keyOfStateRoot()] = root
+	return root
+}
+
+// build creates the tree from all state keys, in chunks to limit memory.
+func (u *smtUpdater) build(excluded map[string]struct{}) []byte {
+	root := smtEmptyHash
+
+	it := newMergedIterator(u.t.stateDB, IterOptions{Prefix: "/"}, u.t.buffer)
+	defer it.Close()
+
+	ops := make([]smtOp, 0)
+	for ; it.Valid(); it.Next() {
+		if _, ok := excluded[it.Key()]; ok {
+			continue
+		}
+		ops = append(ops, smtOp{keyHash: smtHash([]byte(it.Key())), valueHash: smtHash(it.Value())})
+
+		if len(ops) == smtChunkSize {
+			sortSMTOps(ops)
+			root = u.update(root, 0, ops)
+			ops = make([]smtOp, 0)
+		}
+	}
+	sortSMTOps(ops)
+
+	return u.update(root, 0, ops)
+}
+
+// update applies sorted ops to the subtree at depth and returns hash of the new subtree.
+func (u *smtUpdater) update(hash []byte, depth int, ops []smtOp) []byte {
+	if len(ops) == 0 {
+		return hash
+	}
+
+	if !isEmptyHash(hash) {
+		node := getSMTNode(u.t.get, hash)
+		u.nodes[string(hash)] = false
+
+		if !node.leaf {
+			i := sort.Search(len(ops), func(i int) bool { return smtBit(ops[i].keyHash, depth) == 1 })
+			left := u.update(node.left, depth+1, ops[:i])
+			right := u.update(node.right, depth+1, ops[i:])
+			return u.combine(left, right)
+		}
+
+		// the leaf is moved down together with ops unless it's overridden
+		i := sort.Search(len(ops), func(i int) bool { return bytes.Compare(ops[i].keyHash, node.left) >= 0 })
+		if i == len(ops) || !bytes.Equal(ops[i].keyHash, node.left) {
+			merged := make([]smtOp, 0, len(ops)+1)
+			merged = append(merged, ops[:i]...)
+			merged = append(merged, smtOp{keyHash: node.left, valueHash: node.right})
+			ops = append(merged, ops[i:]...)
+		}
+	}
+
+	return u.insert(depth, ops)
+}
+
+// insert creates a subtree at depth from sorted ops, deletions are ignored.
+func (u *smtUpdater) insert(depth int, ops []smtOp) []byte {
+	sets := make([]smtOp, 0, len(ops))
+	for _, op := range ops {
+		if op.valueHash != nil {
+			sets = append(sets, op)
+		}
+	}
+
+	switch len(sets) {
+	case 0:
+		return smtEmptyHash
+	case 1:
+		return u.put(&smtNode{leaf: true, left: sets[0].keyHash, right: sets[0].valueHash})
+	}
+
+	if depth >= smtMaxDepth {
+		panic("state tree key hash collision")
+	}
+
+	i := sort.Search(len(sets), func(i int) bool { return smtBit(sets[i].keyHash, depth) == 1 })
+	return u.combine(u.insert(depth+1, sets[:i]), u.insert(depth+1, sets[i:]))
+}
+
+// combine joins two subtrees, a single leaf is lifted up instead of being wrapped.
+func (u *smtUpdater) combine(left, right []byte) []byte {
+	if isEmptyHash(left) && isEmptyHash(right) {
+		return smtEmptyHash
+	}
+	if isEmptyHash(left) && getSMTNode(u.t.get, right).leaf {
+		return right
+	}
+	if isEmptyHash(right) && getSMTNode(u.t.get, left).leaf {
+		return left
+	}
+
+	return u.put(&smtNode{left: left, right: right})
+}
+
+func (u *smtUpdater) put(node *smtNode) []byte {
+	preimage := node.encode()
+	hash := smtHash(preimage)
+
+	u.nodes[string(hash)] = true
+	u.t.buffer[keyOfSMTNode(hash)] = preimage
+	return hash
+}
+
+// prune deletes nodes which are no longer in the tree,
+// nodes that never reached state db are simply dropped from buffer.
+func (u *smtUpdater) prune() {
+	for h, alive := range u.nodes {
+		if alive {
+			continue
+		}
+
+		key := keyOfSMTNode([]byte(h))
+		if u.t.stateDB.sdb.Has([]byte(key)) {
+			u.t.buffer[key] = []byte{}
+		} else {
+			delete(u.t.buffer, key)
+		}
+	}
+}
+
+// Proof proves that Key has Value in the state tree, or Key is absent if Value is empty.
+// Siblings are listed from root down to the leaf, an absence proof ends at either
+// an empty subtree or another leaf given by LeafKeyHash and LeafValueHash.
+type Proof struct {
+	Key           string   `json:"key"`
+	Value         []byte   `json:"value,omitempty"`
+	Siblings      [][]byte `json:"siblings"`
+	LeafKeyHash   []byte   `json:"leafKeyHash,omitempty"`
+	LeafValueHash []byte   `json:"leafValueHash,omitempty"`
+}
+
+// Exists reports whether it's an inclusion proof.
+func (p *Proof) Exists() bool {
+	return len(p.Value) != 0
+}
+
+// Verify checks the proof against state root.
+func (p *Proof) Verify(root []byte) error {
+	if len(p.Siblings) > smtMaxDepth {
+		return errors.New("too many siblings")
+	}
+
+	keyHash := smtHash([]byte(p.Key))
+
+	var hash []byte
+	switch {
+	case p.Exists():
+		hash = smtLeafHash(keyHash, smtHash(p.Value))
+	case len(p.LeafKeyHash) != 0:
+		if len(p.LeafKeyHash) != smtHashSize || len(p.LeafValueHash) != smtHashSize {
+			return errors.New("invalid leaf in proof")
+		}
+		if bytes.Equal(p.LeafKeyHash, keyHash) {
+			return errors.New("leaf in absence proof has the same key")
+		}
+		for d := range p.Siblings {
+			if smtBit(p.LeafKeyHash, d) != smtBit(keyHash, d) {
+				return errors.New("leaf in absence proof is not on the path of key")
+			}
+		}
+		hash = smtLeafHash(p.LeafKeyHash, p.LeafValueHash)
+	default:
+		hash = smtEmptyHash
+	}
+
+	for d := len(p.Siblings) - 1; d >= 0; d-- {
+		if len(p.Siblings[d]) != smtHashSize {
+			return errors.New("invalid sibling in proof")
+		}
+		if smtBit(keyHash, d) == 0 {
+			hash = smtInternalHash(hash, p.Siblings[d])
+		} else {
+			hash = smtInternalHash(p.Siblings[d], hash)
+		}
+	}
+
+	if !bytes.Equal(hash, root) {
+		return errors.New("state root mismatch")
+	}
+	return nil
+}
+
+// StateRoot returns the committed state root, nil if the tree hasn't been built.
+func (s *StateDB) StateRoot() []byte {
+	return s.Get(keyOfStateRoot())
+}
+
+// GetProof returns the committed state root and the proof of key against it.
+// It returns nil root if the tree hasn't been built.
+func (s *StateDB) GetProof(key string) (root []byte, proof *Proof) {
+	// read from snapshot, so the proof isn't broken by a concurrent commit
+	sn, err := s.sdb.Snapshot()
+	if err != nil {
+		panic(err)
+	}
+	defer sn.Release()
+
+	get := func(k string) []byte {
+		value, err := sn.Get([]byte(k))
+		if err != nil {
+			panic(err)
+		}
+		return value
+	}
+
+	root = get(keyOfStateRoot())
+	if len(root) == 0 {
+		return nil, nil
+	}
+
+	proof = &Proof{Key: key, Siblings: make([][]byte, 0)}
+	keyHash := smtHash([]byte(key))
+
+	hash := root
+	for depth := 0; !isEmptyHash(hash); depth++ {
+		node := getSMTNode(get, hash)
+		if node.leaf {
+			if bytes.Equal(node.left, keyHash) {
+				proof.Value = get(key)
+			} else {
+				proof.LeafKeyHash, proof.LeafValueHash = node.left, node.right
+			}
+			break
+		}
+
+		if smtBit(keyHash, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, node.right)
+			hash = node.left
+		} else {
+			proof.Siblings = append(proof.Siblings, node.left)
+			hash = node.right
+		}
+	}
+
+	return root, proof
+}
@@ -0,0 +1,308 @@
+package statedb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bcbchain/bclib/jsoniter"
+)
+
+// ErrCursorTruncated means change sets at cursor are removed from outbox by retention.
+var ErrCursorTruncated = errors.New("change sets at cursor are truncated")
+
+// Outbox is an append-only file of change sets, one JSON ChangeSet a line. Consumers read
+// it with ReadChangeSets from a cursor, and keep the returned cursor.
+// The change sets are appended after state db is written, so after a crash the outbox
+// catches up from snapshots when it's set to state db again. Outbox is broken if it fails
+// to append, then nothing is appended until it's opened again and catches up, consumers
+// which find transaction IDs are not continuous resync from state db.
+// Outbox keeps change sets of the last retain transactions at least, when they're twice as
+// many, the older ones are removed. The first line of file is header with cursor of the first
+// change set after it, so cursors are not changed by removing.
+type Outbox struct {
+	mtx    sync.Mutex
+	path   string
+	file   *os.File
+	base   int64 // cursor of the first change set in file
+	header int64 // bytes of header line, change set at cursor is at offset cursor-base+header
+	count  int   // count of change sets in file
+	retain int   // 0 keeps all change sets
+	lastID int64
+	empty  bool
+	err    error // outbox is broken after the error
+}
+
+type outboxHeader struct {
+	Base int64 `json:"base"`
+}
+
+// OpenOutbox opens or creates outbox file, an incomplete last line left by crash is removed.
+// It keeps change sets of the last retain transactions at least, 0 keeps all.
+func OpenOutbox(path string, retain int) (*Outbox, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{path: path, file: file, retain: retain, empty: true}
+	if err := o.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// load truncates incomplete last line and reads transaction ID of the last change set.
+func (o *Outbox) load() error {
+	base, header, err := readHeader(o.file)
+	if err != nil {
+		return err
+	}
+	o.base, o.header = base, header
+
+	offset := header
+	for {
+		changeSets, next, err := readChangeSets(o.file, offset, 1000)
+		if err != nil {
+			return err
+		}
+		if len(changeSets) == 0 {
+			break
+		}
+		o.lastID = changeSets[len(changeSets)-1].TransactionID
+		o.empty = false
+		o.count += len(changeSets)
+		offset = next
+	}
+
+	if err := o.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err = o.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// LastID returns transaction ID of the last change set, ok is false if outbox is empty.
+func (o *Outbox) LastID() (id int64, ok bool) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	return o.lastID, !o.empty
+}
+
+// Append writes change set and syncs file, outbox is broken if it fails.
+func (o *Outbox) Append(cs *ChangeSet) error {
+	line, err := jsoniter.Marshal(cs)
+	if err != nil {
+		return err
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.err != nil {
+		return o.err
+	}
+	if _, err := o.file.Write(append(line, '\n')); err != nil {
+		o.err = err
+		return err
+	}
+	if err := o.file.Sync(); err != nil {
+		o.err = err
+		return err
+	}
+
+	o.lastID = cs.TransactionID
+	o.empty = false
+	o.count++
+
+	if o.retain > 0 && o.count >= 2*o.retain {
+		if err := o.removeBefore(o.count - o.retain); err != nil {
+			// change sets are kept, removing is tried again at the next change set
+			logger.Error("statedb outbox removes old change sets failed", "path", o.path, "error", err)
+		}
+	}
+	return nil
+}
+
+// removeBefore rewrites file without the first n change sets, the new file replaces the old
+// one by renaming, so readers see either of them.
+func (o *Outbox) removeBefore(n int) error {
+	_, offset, err := readChangeSets(o.file, o.header, n)
+	if err != nil {
+		return err
+	}
+	header, _ := jsoniter.Marshal(outboxHeader{Base: o.base + offset - o.header})
+	header = append(header, '\n')
+
+	tmpPath := o.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(header)
+	if err == nil {
+		_, err = io.Copy(tmp, io.NewSectionReader(o.file, offset, 1<<62))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, o.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	o.file.Close()
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		// renamed already, outbox must not write to the old file
+		o.err = err
+	}
+	o.file = tmp
+	o.base += offset - o.header
+	o.header = int64(len(header))
+	o.count -= n
+	return nil
+}
+
+// Restore prepares outbox for state db restored at transaction id. Outbox ahead of id is kept
+// if it has all change sets after id, they're rolled back when it's set to state db, otherwise
+// all change sets are removed, consumers get ErrCursorTruncated and resync from state db.
+func (o *Outbox) Restore(id int64) error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.empty || o.lastID <= id {
+		return nil
+	}
+	first, _, err := readChangeSets(o.file, o.header, 1)
+	if err != nil {
+		return err
+	}
+	if len(first) != 0 && first[0].TransactionID <= id+1 {
+		return nil
+	}
+
+	if err := o.removeBefore(o.count); err != nil {
+		return err
+	}
+	o.lastID, o.empty = 0, true
+	return nil
+}
+
+func (o *Outbox) Close() error {
+	return o.file.Close()
+}
+
+// keysAfter returns sorted keys of change sets whose transaction ID is larger than id.
+func (o *Outbox) keysAfter(id int64) ([]string, error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	keySet := make(map[string]struct{})
+	cursor := o.header
+	for {
+		changeSets, next, err := readChangeSets(o.file, cursor, 1000)
+		if err != nil {
+			return nil, err
+		}
+		if len(changeSets) == 0 {
+			break
+		}
+		for _, cs := range changeSets {
+			if cs.TransactionID > id {
+				for _, c := range cs.Changes {
+					keySet[c.Key] = struct{}{}
+				}
+			}
+		}
+		cursor = next
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ReadChangeSets reads at most limit change sets of outbox file from cursor, which is 0 at
+// first, it returns the cursor to read next change sets. A line being written is not returned.
+// If change sets at cursor are removed, it returns ErrCursorTruncated with cursor of the first
+// change set kept.
+func ReadChangeSets(path string, cursor int64, limit int) ([]*ChangeSet, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer file.Close()
+
+	base, header, err := readHeader(file)
+	if err != nil {
+		return nil, cursor, err
+	}
+	if cursor < base {
+		return nil, base, ErrCursorTruncated
+	}
+
+	changeSets, next, err := readChangeSets(file, cursor-base+header, limit)
+	if err != nil {
+		return nil, cursor, err
+	}
+	return changeSets, next-header+base, nil
+}
+
+// readHeader returns cursor of the first change set and bytes of header, they're 0 if file
+// has no header.
+func readHeader(r io.ReaderAt) (base, header int64, err error) {
+	line, err := bufio.NewReader(io.NewSectionReader(r, 0, 1<<62)).ReadBytes('\n')
+	if err == io.EOF || !bytes.HasPrefix(line, []byte(`{"base":`)) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var h outboxHeader
+	if err := jsoniter.Unmarshal(bytes.TrimSuffix(line, []byte("\n")), &h); err != nil {
+		return 0, 0, err
+	}
+	return h.Base, int64(len(line)), nil
+}
+
+// readChangeSets reads at most limit change sets from byte offset of file.
+func readChangeSets(r io.ReaderAt, cursor int64, limit int) ([]*ChangeSet, int64, error) {
+	if limit <= 0 {
+		return nil, cursor, errors.New("limit must be positive")
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(r, cursor, 1<<62))
+	changeSets := make([]*ChangeSet, 0)
+	for len(changeSets) < limit {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, cursor, err
+		}
+
+		cs := new(ChangeSet)
+		if err := jsoniter.Unmarshal(bytes.TrimSuffix(line, []byte("\n")), cs); err != nil {
+			return nil, cursor, err
+		}
+		changeSets = append(changeSets, cs)
+		cursor += int64(len(line))
+	}
+
+	return changeSets, cursor, nil
+}
@@ -0,0 +1,114 @@
+package statedb
+
+import (
+	"github.com/bcbchain/bclib/jsoniter"
+	"github.com/bcbchain/bclib/tendermint/tmlibs/log"
+)
+
+var logger = log.NewNopLogger()
+
+// SetLogger sets logger of statedb, it's used to report recovery at New.
+func SetLogger(l log.Logger) {
+	logger = l
+}
+
+// Committing or rolling back writes both snapshot db and state db, they can't be written
+// atomically, so the intent is written to snapshot db before state db is touched:
+//   - commit: the intent is written together with the snapshot, which also holds the new data,
+//     so a commit interrupted after the snapshot can be replayed to state db.
+//   - rollback: the intent is written before rolling back state db and deleted together
+//     with the snapshots, so an interrupted rollback can be finished.
+//
+// New checks the intent and the last transaction IDs of both db to recover.
+const (
+	intentCommit   = "commit"
+	intentRollback = "rollback"
+)
+
+type intent struct {
+	Op            string `json:"op"`
+	TransactionID int64  `json:"transactionID"` // the committed transaction, or the target of rollback
+}
+
+func keyOfIntent() string {
+	return "$intent"
+}
+
+func (s *snapshot) getIntent() *intent {
+	it := new(intent)
+	s.snapshotDBGet(keyOfIntent(), it)
+	if it.Op == "" {
+		return nil
+	}
+	return it
+}
+
+func (s *snapshot) setIntent(it *intent) {
+	value, err := jsoniter.Marshal(it)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := s.snapshotDB.Set([]byte(keyOfIntent()), value); err != nil {
+		panic(err)
+	}
+}
+
+// recover replays or discards the half-applied transaction, or finishes the interrupted rollback.
+func (s *snapshot) recover() {
+	lastTransactionID := getInt64(s.snapshotDB, keyOfLastTransactionID())
+	sdbLastTransactionID := getInt64(s.stateDB.sdb, keyOfLastTransactionID())
+
+	it := s.getIntent()
+	if it == nil {
+		if lastTransactionID != 0 && lastTransactionID != sdbLastTransactionID {
+			logger.Error("statedb recover: last transaction ID mismatch without intent",
+				"snapshot", lastTransactionID, "statedb", sdbLastTransactionID)
+		}
+		return
+	}
+
+	switch it.Op {
+	case intentRollback:
+		logger.Warn("statedb recover: finish interrupted rollback",
+			"target", it.TransactionID, "snapshot", lastTransactionID, "statedb", sdbLastTransactionID)
+		s.rollbackTo(it.TransactionID)
+
+	case intentCommit:
+		if it.TransactionID != lastTransactionID || it.TransactionID != sdbLastTransactionID+1 {
+			// the commit has finished, or it's followed by a finished rollback
+			return
+		}
+
+		newData := s.getNewData(it.TransactionID)
+		if len(newData) == 0 {
+			// no snapshot is kept, nothing is written to state db, forget the transaction
+			logger.Warn("statedb recover: discard half-applied transaction", "transactionID", it.TransactionID)
+			batch := s.snapshotDB.NewBatch()
+			setToBatch(batch, keyOfLastTransactionID(), sdbLastTransactionID)
+			batch.Delete([]byte(keyOfIntent()))
+			if err := batch.Commit(); err != nil {
+				panic(err)
+			}
+			return
+		}
+
+		logger.Warn("statedb recover: replay half-applied transaction",
+			"transactionID", it.TransactionID, "keys", len(newData))
+		sBatch := s.stateDB.sdb.NewBatch()
+		for k, v := range newData {
+			if len(v) == 0 {
+				sBatch.Delete([]byte(k))
+			} else {
+				sBatch.Set([]byte(k), v)
+			}
+		}
+		setToBatch(sBatch, keyOfLastTransactionID(), it.TransactionID)
+		if err := sBatch.Commit(); err != nil {
+			panic(err)
+		}
+
+	default:
+		logger.Error("statedb recover: unknown intent", "op", it.Op)
+	}
+}
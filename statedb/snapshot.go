@@ -2,14 +2,13 @@ package statedb
 
 import (
 	"bytes"
-	"github.com/bcbchain/bclib/bcdb"
 	"github.com/bcbchain/bclib/jsoniter"
 	"fmt"
 )
 
 type snapshot struct {
 	stateDB    *StateDB
-	snapshotDB *bcdb.GILevelDB
+	snapshotDB Backend
 }
 
 func (s *snapshot) rollback(rollbackTransactions int) {
@@ -33,16 +32,31 @@ func (s *snapshot) rollback(rollbackTransactions int) {
 		panic(fmt.Sprintf("no this transactionID snapshot, transactionID=%d", targetID))
 	}
 
+	s.setIntent(&intent{Op: intentRollback, TransactionID: targetID})
+	s.rollbackTo(targetID)
+}
+
+// rollbackTo rolls back state db to the transaction before targetID, then deletes snapshots
+// and the intent, transactions already rolled back in state db are skipped.
+func (s *snapshot) rollbackTo(targetID int64) {
+	lastTransactionID := getInt64(s.snapshotDB, keyOfLastTransactionID())
+	sdbLastTransactionID := getInt64(s.stateDB.sdb, keyOfLastTransactionID())
+
 	batch := s.snapshotDB.NewBatch()
 	for id := lastTransactionID; id >= targetID; id-- {
-		s.rollbackStateDB(id)
+		if id <= sdbLastTransactionID {
+			s.rollbackStateDB(id)
+		}
 
+		s.deleteVersionIndex(id, batch)
+		s.deleteHeightIndex(id, targetID-1, batch)
 		batch.Delete([]byte(keyOfNewData(id)))
 		batch.Delete([]byte(keyOfOriginData(id)))
 	}
 
 	// update snapshot db last transaction ID
 	setToBatch(batch, keyOfLastTransactionID(), targetID-1)
+	batch.Delete([]byte(keyOfIntent()))
 
 	if err := batch.Commit(); err != nil {
 		panic(err)
@@ -89,7 +103,8 @@ func (s *snapshot) rollbackStateDB(transactionID int64) {
 	}
 }
 
-func (s *snapshot) commit(transactionID int64, originData, newData map[string][]byte) {
+// commit writes snapshot of transaction committed at block height, height is 0 if it's unknown.
+func (s *snapshot) commit(transactionID, height int64, originData, newData map[string][]byte) {
 
 	var maxCount int
 
@@ -119,24 +134,38 @@ func (s *snapshot) commit(transactionID int64, originData, newData map[string][]
 
 		// set new data
 		setToBatch(batch, keyOfNewData(transactionID), newData)
+
+		// set version index
+		s.setVersionIndex(transactionID, originData, batch)
+
+		// set height index
+		s.setHeightIndex(transactionID, height, batch)
 	}
 
 	// set last transaction ID
 	setToBatch(batch, keyOfLastTransactionID(), transactionID)
 
+	// state db is written after this, see recover
+	setToBatch(batch, keyOfIntent(), &intent{Op: intentCommit, TransactionID: transactionID})
+
 	// commit to snapshot db
 	if err := batch.Commit(); err != nil {
 		panic(err)
 	}
 }
 
-func (s *snapshot) checkMaxCount(transactionID int64, maxCount int, batch *bcdb.GILevelDBBatch) {
+func (s *snapshot) checkMaxCount(transactionID int64, maxCount int, batch Batch) {
 
 	minID := transactionID - int64(maxCount)
 	if minID <= 0 {
 		return
 	}
 
+	// versions before minID can not be read any more
+	if from := getInt64(s.snapshotDB, keyOfVersionIndexFrom()); from != 0 && from <= minID {
+		setToBatch(batch, keyOfVersionIndexFrom(), minID+1)
+	}
+
 	for id := minID; id > 0; id-- {
 
 		originKey := []byte(keyOfOriginData(id))
@@ -144,6 +173,8 @@ func (s *snapshot) checkMaxCount(transactionID int64, maxCount int, batch *bcdb.
 			return
 		}
 
+		s.deleteVersionIndex(id, batch)
+		s.deleteHeightIndex(id, 0, batch)
 		batch.Delete(originKey)
 		batch.Delete([]byte(keyOfNewData(id)))
 	}
@@ -169,7 +200,7 @@ func (s *snapshot) setMaxSnapshotCount(count int) {
 		panic(err)
 	}
 
-	if err := s.snapshotDB.SetSync([]byte(keyOfMaxSnapshotCount()), value); err != nil {
+	if err := s.snapshotDB.Set([]byte(keyOfMaxSnapshotCount()), value); err != nil {
 		panic(err)
 	}
 }
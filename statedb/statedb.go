@@ -1,7 +1,7 @@
 package statedb
 
 import (
-	"github.com/bcbchain/bclib/bcdb"
+	"fmt"
 	"github.com/bcbchain/bclib/jsoniter"
 	"sync"
 	"sync/atomic"
@@ -10,28 +10,40 @@ import (
 var mu sync.Mutex
 
 type StateDB struct {
-	sdb      *bcdb.GILevelDB // state db
-	snapshot *snapshot       // snapshot db
+	sdb      Backend   // state db
+	snapshot *snapshot // snapshot db
 
 	committableTransaction *Transaction // current committable transaction
 
 	lastCommittableTransactionID int64
 	lastRollbackTransactionID    int64
+
+	commitMtx sync.Mutex // held while committing or rolling back, so backup sees whole blocks
+
+	feedMtx     sync.Mutex                 // guards change set feed
+	subscribers map[string]chan *ChangeSet // subscriber => channel of change sets
+	outbox      *Outbox
+	heightFunc  HeightFunc
 }
 
 func New(sdbName string, maxSnapshotCount int) *StateDB {
+	return NewWithBackend(GoLevelDBBackend, sdbName, maxSnapshotCount)
+}
+
+// NewWithBackend opens state db and snapshot db with the named backend.
+func NewWithBackend(backend, sdbName string, maxSnapshotCount int) *StateDB {
 	if maxSnapshotCount < 0 {
 		panic("invalid parameter")
 	}
 
 	// open state db
-	sdb, err := bcdb.OpenDB(sdbName, "", "")
+	sdb, err := openBackend(backend, sdbName)
 	if err != nil {
 		panic(err)
 	}
 
 	// open snapshot db
-	sndb, err := bcdb.OpenDB(sdbName+".snapshot", "", "")
+	sndb, err := openBackend(backend, sdbName+".snapshot")
 	if err != nil {
 		panic(err)
 	}
@@ -39,6 +51,10 @@ func New(sdbName string, maxSnapshotCount int) *StateDB {
 	sn := &snapshot{snapshotDB: sndb}
 	sn.setMaxSnapshotCount(maxSnapshotCount)
 
+	// recover the commit or rollback interrupted by crash
+	sn.stateDB = &StateDB{sdb: sdb, snapshot: sn}
+	sn.recover()
+
 	var lastCommittableTransactionID int64
 
 	// Get last committable transaction ID from db.
@@ -65,6 +81,29 @@ func New(sdbName string, maxSnapshotCount int) *StateDB {
 	return statedb
 }
 
+// OpenReadOnly opens state db on disk for reading, nothing is recovered or written,
+// snapshot db is optional, versions can't be read without it.
+func OpenReadOnly(sdbName string) (*StateDB, error) {
+	sdb, err := openGoLevelDBReadOnly(sdbName)
+	if err != nil {
+		return nil, err
+	}
+
+	var sndb Backend
+	if sndb, err = openGoLevelDBReadOnly(sdbName + ".snapshot"); err != nil {
+		sndb = newEmptyMemDB()
+	}
+
+	statedb := &StateDB{
+		sdb:                          sdb,
+		snapshot:                     &snapshot{snapshotDB: sndb},
+		lastCommittableTransactionID: getInt64(sdb, keyOfLastTransactionID()),
+	}
+	statedb.snapshot.stateDB = statedb
+
+	return statedb, nil
+}
+
 func (s *StateDB) Get(key string) []byte {
 	value, err := s.sdb.Get([]byte(key))
 	if err != nil {
@@ -99,6 +138,24 @@ func (s *StateDB) NewRollbackTransaction() *Transaction {
 	}
 }
 
+// NewRollbackTransactionAtVersion creates a rollback transaction which reads state right after
+// transaction with ID version was committed, iterators of it still read the latest state.
+func (s *StateDB) NewRollbackTransactionAtVersion(version int64) (*Transaction, error) {
+	last := s.LastVersion()
+	if version > last {
+		return nil, fmt.Errorf("version %d is not committed, last version is %d", version, last)
+	}
+	if version < s.OldestVersion() {
+		return nil, ErrVersionPruned
+	}
+
+	t := s.NewRollbackTransaction()
+	if version < last {
+		t.version = version
+	}
+	return t, nil
+}
+
 func (s *StateDB) Rollback(rollbackTransactions int) {
 
 	if rollbackTransactions <= 0 {
@@ -110,7 +167,21 @@ func (s *StateDB) Rollback(rollbackTransactions int) {
 		panic("cannot be rollback when a committable transaction is not committed")
 	}
 
+	s.commitMtx.Lock()
+	defer s.commitMtx.Unlock()
+
+	// collect changes before snapshots are deleted
+	var cs *ChangeSet
+	if s.hasFeed() {
+		cs = s.rollbackChangeSet(s.LastVersion() - int64(rollbackTransactions) + 1)
+	}
+
 	s.snapshot.rollback(rollbackTransactions)
+
+	if cs != nil {
+		cs.fillNew(s.Get)
+		s.publish(cs)
+	}
 }
 
 func (s *StateDB) Close() {
@@ -136,7 +207,7 @@ func keyOfLastTransactionID() string {
 	return "$last_transaction_id"
 }
 
-func getInt64(db *bcdb.GILevelDB, key string) int64 {
+func getInt64(db Backend, key string) int64 {
 	value, err := db.Get([]byte(key))
 	if err != nil {
 		panic(err)
@@ -154,7 +225,7 @@ func getInt64(db *bcdb.GILevelDB, key string) int64 {
 	return result
 }
 
-func setToBatch(batch *bcdb.GILevelDBBatch, key string, value interface{}) {
+func setToBatch(batch Batch, key string, value interface{}) {
 	valuerByte, err := jsoniter.Marshal(value)
 	if err != nil {
 		panic(err)
@@ -4,6 +4,8 @@ import (
 	"github.com/bcbchain/bclib/jsoniter"
 	"fmt"
 	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -62,6 +64,10 @@ func (s *MySuite) TestTransaction(c *C) {
 func (s *MySuite) TestTx(c *C) {
 	fmt.Println(c.TestName())
 	testTxGetSet(c)
+	testTxReadWriteSet(c) // 记录 tx 读写的键并检测冲突
+	testTxReadRange(c)    // 遍历过的范围内写入新键也算冲突
+	testTxDetach(c)       // 从 tx 中取出的键不随 tx 提交
+	testTxConcurrent(c)   // 并发读写 transaction 和 tx
 }
 
 func (s *MySuite) TestRollback(c *C) {
@@ -71,6 +77,65 @@ func (s *MySuite) TestRollback(c *C) {
 	testRollbackPanicMaxZero(c) // 测试最大快照数为零
 }
 
+func (s *MySuite) TestBackend(c *C) {
+	fmt.Println(c.TestName())
+	testBackendSameResult(c) // 不同存储后端的读写、遍历及回滚结果一致
+	testMemDBReopen(c)       // 内存数据库关闭后可以重新打开
+	testMemDBSnapshot(c)     // 内存数据库的快照不阻塞写入
+}
+
+func (s *MySuite) TestRecover(c *C) {
+	fmt.Println(c.TestName())
+	testRecoverCommit(c)           // 快照已写入而状态库未写入时重放
+	testRecoverCommitNoSnapshot(c) // 不保存快照时丢弃未完成的提交
+	testRecoverRollback(c)         // 回滚中断后继续完成回滚
+}
+
+func (s *MySuite) TestIterator(c *C) {
+	fmt.Println(c.TestName())
+	testIteratorStateDB(c)     // 测试遍历数据库
+	testIteratorTransaction(c) // 测试 transaction 缓存覆盖数据库
+	testIteratorTx(c)          // 测试 tx 缓存覆盖 transaction 缓存
+}
+
+func (s *MySuite) TestStateRoot(c *C) {
+	fmt.Println(c.TestName())
+	testStateRootDeterminism(c) // 相同数据不同写入顺序得到相同的根
+	testStateProof(c)           // 存在性证明与不存在证明
+	testStateRootRollback(c)    // 回滚后根与证明恢复
+}
+
+func (s *MySuite) TestDiff(c *C) {
+	fmt.Println(c.TestName())
+	testDiffDB(c)       // 比较两个状态库
+	testDiffVersions(c) // 比较同一状态库的两个版本
+	testOpenReadOnly(c) // 只读打开状态库
+}
+
+func (s *MySuite) TestChangeSet(c *C) {
+	fmt.Println(c.TestName())
+	testSubscribe(c)      // 订阅按顺序收到提交和回滚的变化集合
+	testSubscribeSlow(c)  // 处理过慢的订阅者被取消订阅
+	testOutbox(c)         // 按偏移量读取输出文件，重新打开后补齐缺失的变化集合
+	testOutboxTruncate(c) // 崩溃留下的不完整行被删除
+	testOutboxRetain(c)   // 超过保留数量的两倍时删除旧的变化集合，游标不变
+	testOutboxBroken(c)   // 写入失败后不再写入，重新打开后补齐
+	testOutboxRestore(c)  // 恢复备份时保留完整的变化集合，否则清空，游标不变
+}
+
+func (s *MySuite) TestBackup(c *C) {
+	fmt.Println(c.TestName())
+	testBackupWhileCommitting(c) // 提交区块的同时备份，备份停在区块边界
+}
+
+func (s *MySuite) TestGetAtVersion(c *C) {
+	fmt.Println(c.TestName())
+	testGetAtVersion(c)         // 读取历史版本的值
+	testGetAtVersionPruned(c)   // 快照被清理后无法读取
+	testGetAtVersionRollback(c) // 回滚后历史版本索引同步删除
+	testVersionOfHeight(c)      // 区块高度对应的版本随提交、回滚和清理更新
+}
+
 // 并发创建 rollback transaction
 func (s *MySuite) TestConcurrentRollbackTransaction(c *C) {
 	fmt.Println(c.TestName())
@@ -330,6 +395,125 @@ func testTxGetSet(c *C) {
 	ts.Commit()
 }
 
+func testTxReadWriteSet(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "ttxrwset"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/rw/1": []byte("1"), "/rw/2": []byte("2")})
+
+	tx1 := ts.NewTx()
+	tx1.Get("/rw/1")
+	tx1.Set("/rw/3", []byte("3"))
+	tx1.Get("/rw/3") // 读自己写入的键不记录
+
+	tx2 := ts.NewTx()
+	iterKeys(tx2.NewIterator(IterOptions{Prefix: "/rw/"}))
+	tx2.Set("/rw/1", []byte("11"))
+
+	tx3 := ts.NewTx()
+	tx3.Set("/rw/4", []byte("4"))
+
+	c.Check(tx1.ReadSet(), DeepEquals, []string{"/rw/1"})
+	c.Check(tx1.WriteSet(), DeepEquals, []string{"/rw/3"})
+	c.Check(tx2.ReadSet(), DeepEquals, []string{"/rw/1", "/rw/2"})
+	c.Check(tx2.WriteSet(), DeepEquals, []string{"/rw/1"})
+
+	c.Check(tx1.Conflicts(tx2), Equals, true)
+	c.Check(tx1.Conflicts(tx3), Equals, false)
+	c.Check(tx3.Conflicts(tx1), Equals, false)
+
+	// 提交后写集合保留，回滚后清空
+	tx1.Commit()
+	c.Check(tx1.WriteSet(), DeepEquals, []string{"/rw/3"})
+	tx2.Rollback()
+	c.Check(tx2.WriteSet(), HasLen, 0)
+	c.Check(tx2.ReadSet(), HasLen, 2)
+
+	ts.Commit()
+}
+
+func testTxReadRange(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "ttxreadrange"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/rr/a/1": []byte("1")})
+
+	tx1 := ts.NewTx()
+	iterKeys(tx1.NewIterator(IterOptions{Prefix: "/rr/a/", Limit: 1}))
+
+	tx2 := ts.NewTx()
+	tx2.Set("/rr/a/2", []byte("2"))
+
+	tx3 := ts.NewTx()
+	tx3.Set("/rr/b/1", []byte("1"))
+
+	c.Check(tx1.ReadSet(), DeepEquals, []string{"/rr/a/1"})
+	c.Check(tx1.Conflicts(tx2), Equals, true)
+	c.Check(tx1.Conflicts(tx3), Equals, false)
+
+	// 回滚后遍历范围保留
+	tx1.Rollback()
+	c.Check(tx1.Conflicts(tx2), Equals, true)
+
+	ts.Commit()
+}
+
+func testTxDetach(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "ttxdetach"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	tx := ts.NewTx()
+	tx.BatchSet(map[string][]byte{"/dt/1": []byte("1"), "/dt/2": []byte("2")})
+
+	data := tx.Detach([]string{"/dt/1", "/dt/3"})
+	c.Check(data, DeepEquals, map[string][]byte{"/dt/1": []byte("1")})
+	c.Check(tx.WriteSet(), DeepEquals, []string{"/dt/1", "/dt/2"})
+
+	stateTx, _ := tx.Commit()
+	c.Check(string(stateTx), Equals, "/dt/22")
+	c.Check(ts.Get("/dt/1"), IsNil)
+
+	// 回滚后分离的键仍在写集合中，它们已经另行提交到交易
+	tx = ts.NewTx()
+	tx.BatchSet(map[string][]byte{"/dt/4": []byte("4"), "/dt/5": []byte("5")})
+	ts.BatchSet(tx.Detach([]string{"/dt/4"}))
+	tx.Rollback()
+	c.Check(tx.WriteSet(), DeepEquals, []string{"/dt/4"})
+
+	ts.Commit()
+}
+
+func testTxConcurrent(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "ttxconcurrent"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			tx := ts.NewTx()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("/con/%d/%d", i, j)
+				tx.Set(key, []byte(key))
+				tx.Get(key)
+				ts.Get(key)
+			}
+			tx.Commit()
+		}(i)
+	}
+	wg.Wait()
+
+	c.Check(iterKeys(ts.NewIterator(IterOptions{Prefix: "/con/"})), HasLen, 1000)
+	ts.Commit()
+}
+
 func testRollbackPanicMaxZero(c *C) {
 	sdb := New("testrollbackpaniczero", 0)
 
@@ -407,6 +591,976 @@ func testRollbackNormal(c *C) {
 	c.Check(string(value), Equals, "")
 }
 
+func testIteratorStateDB(c *C) {
+	sdb := newTestStateDB("titersdb", 100)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	for i := 0; i < 10; i++ {
+		temp := strconv.Itoa(i)
+		ts.Set("/iter/a/"+temp, []byte("value"+temp))
+	}
+	ts.Set("/iter/b/0", []byte("value0"))
+	ts.Commit()
+
+	c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/iter/a/"})), DeepEquals,
+		[]string{"/iter/a/0", "/iter/a/1", "/iter/a/2", "/iter/a/3", "/iter/a/4",
+			"/iter/a/5", "/iter/a/6", "/iter/a/7", "/iter/a/8", "/iter/a/9"})
+
+	// 前缀与起止范围同时生效
+	c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/iter/a/", Start: "/iter/a/3", End: "/iter/a/6"})), DeepEquals,
+		[]string{"/iter/a/3", "/iter/a/4", "/iter/a/5"})
+
+	// 逆序并限制数量
+	c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/iter/", Reverse: true, Limit: 3})), DeepEquals,
+		[]string{"/iter/b/0", "/iter/a/9", "/iter/a/8"})
+
+	c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/iter/c/"})), HasLen, 0)
+}
+
+func testIteratorTransaction(c *C) {
+	sdb := newTestStateDB("titerts", 100)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/k/1": []byte("1"), "/k/3": []byte("3"), "/k/5": []byte("5")})
+	ts.Commit()
+
+	ts = sdb.NewCommittableTransaction()
+	ts.Set("/k/2", []byte("2"))
+	ts.Set("/k/3", []byte("33"))
+	ts.Set("/k/5", nil) // 长度为零的值视为删除
+
+	it := ts.NewIterator(IterOptions{Prefix: "/k/"})
+	keys := make([]string, 0)
+	values := make([]string, 0)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+		values = append(values, string(it.Value()))
+	}
+	it.Close()
+	c.Check(keys, DeepEquals, []string{"/k/1", "/k/2", "/k/3"})
+	c.Check(values, DeepEquals, []string{"1", "2", "33"})
+
+	c.Check(iterKeys(ts.NewIterator(IterOptions{Prefix: "/k/", Reverse: true})), DeepEquals,
+		[]string{"/k/3", "/k/2", "/k/1"})
+
+	// 未提交的数据对数据库迭代器不可见
+	c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/k/"})), DeepEquals,
+		[]string{"/k/1", "/k/3", "/k/5"})
+
+	ts.Commit()
+	c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/k/"})), DeepEquals,
+		[]string{"/k/1", "/k/2", "/k/3"})
+}
+
+func testIteratorTx(c *C) {
+	sdb := newTestStateDB("titertx", 100)
+	defer sdb.Close()
+
+	ts := sdb.NewRollbackTransaction()
+	ts.Set("/t/1", []byte("1"))
+	ts.Set("/t/2", []byte("2"))
+
+	tx := ts.NewTx()
+	tx.Set("/t/2", nil)
+	tx.Set("/t/3", []byte("3"))
+
+	c.Check(iterKeys(tx.NewIterator(IterOptions{Prefix: "/t/"})), DeepEquals, []string{"/t/1", "/t/3"})
+	c.Check(iterKeys(ts.NewIterator(IterOptions{Prefix: "/t/"})), DeepEquals, []string{"/t/1", "/t/2"})
+	c.Check(iterKeys(tx.NewIterator(IterOptions{Prefix: "/t/", Limit: 1})), DeepEquals, []string{"/t/1"})
+}
+
+// 使用内存数据库，名字加上时间避免同一进程内重复运行时复用数据
+func newTestStateDB(name string, maxSnapshotCount int) *StateDB {
+	return NewWithBackend(MemDBBackend, name+strconv.FormatInt(time.Now().UnixNano(), 10), maxSnapshotCount)
+}
+
+func testStateRootDeterminism(c *C) {
+	// 一次写入全部数据
+	sdb1 := newTestStateDB("tsroot1", 100)
+	defer sdb1.Close()
+
+	ts := sdb1.NewCommittableTransaction()
+	for i := 0; i < 50; i++ {
+		temp := strconv.Itoa(i)
+		ts.Set("/root/"+temp, []byte("value"+temp))
+	}
+	ts.Set("$ignored", []byte("value"))
+	ts.Set("/world/appstate", []byte("appstate"))
+	root1 := ts.CalcStateRoot("/world/appstate")
+	ts.Commit()
+	c.Check(sdb1.StateRoot(), DeepEquals, root1)
+
+	// 先写入数据再建树，分多次逆序写入并删除多余的键
+	sdb2 := newTestStateDB("tsroot2", 100)
+	defer sdb2.Close()
+
+	ts = sdb2.NewCommittableTransaction()
+	for i := 49; i >= 25; i-- {
+		temp := strconv.Itoa(i)
+		ts.Set("/root/"+temp, []byte("value"+temp))
+	}
+	ts.Set("/extra", []byte("extra"))
+	ts.Commit()
+
+	ts = sdb2.NewCommittableTransaction()
+	c.Check(ts.CalcStateRoot(), Not(DeepEquals), root1)
+	ts.Commit()
+
+	ts = sdb2.NewCommittableTransaction()
+	for i := 24; i >= 0; i-- {
+		temp := strconv.Itoa(i)
+		ts.Set("/root/"+temp, []byte("value"+temp))
+	}
+	ts.Set("/extra", nil)
+	c.Check(ts.CalcStateRoot(), DeepEquals, root1)
+	c.Check(ts.CalcStateRoot(), DeepEquals, root1) // 重复计算结果不变
+	ts.Commit()
+
+	c.Check(sdb2.StateRoot(), DeepEquals, root1)
+
+	// 删除全部数据后得到空树
+	ts = sdb2.NewCommittableTransaction()
+	for i := 0; i < 50; i++ {
+		ts.Set("/root/"+strconv.Itoa(i), nil)
+	}
+	c.Check(ts.CalcStateRoot(), DeepEquals, smtEmptyHash)
+	ts.Commit()
+
+	// 已删除的节点不再保留在数据库中
+	it := sdb2.NewIterator(IterOptions{Prefix: "$smt/node/"})
+	c.Check(it.Valid(), Equals, false)
+	it.Close()
+}
+
+func testStateProof(c *C) {
+	sdb := newTestStateDB("tsproof", 100)
+	defer sdb.Close()
+
+	root, proof := sdb.GetProof("/proof/1")
+	c.Check(root, IsNil)
+	c.Check(proof, IsNil)
+
+	ts := sdb.NewCommittableTransaction()
+	for i := 0; i < 20; i++ {
+		temp := strconv.Itoa(i)
+		ts.Set("/proof/"+temp, []byte("value"+temp))
+	}
+	root = ts.CalcStateRoot()
+	ts.Commit()
+
+	for i := 0; i < 20; i++ {
+		temp := strconv.Itoa(i)
+		r, proof := sdb.GetProof("/proof/" + temp)
+		c.Check(r, DeepEquals, root)
+		c.Check(proof.Exists(), Equals, true)
+		c.Check(string(proof.Value), Equals, "value"+temp)
+		c.Check(proof.Verify(root), IsNil)
+
+		// 篡改值后验证失败
+		proof.Value = []byte("fake")
+		c.Check(proof.Verify(root), NotNil)
+	}
+
+	for i := 20; i < 40; i++ {
+		_, proof := sdb.GetProof("/proof/" + strconv.Itoa(i))
+		c.Check(proof.Exists(), Equals, false)
+		c.Check(proof.Verify(root), IsNil)
+
+		// 伪造存在性证明验证失败
+		proof.Value = []byte("fake")
+		c.Check(proof.Verify(root), NotNil)
+	}
+
+	// 证明经过 JSON 编解码后仍然有效
+	_, proof = sdb.GetProof("/proof/3")
+	data, err := jsoniter.Marshal(proof)
+	c.Assert(err, IsNil)
+	decoded := new(Proof)
+	c.Assert(jsoniter.Unmarshal(data, decoded), IsNil)
+	c.Check(decoded.Verify(root), IsNil)
+}
+
+func testStateRootRollback(c *C) {
+	sdb := newTestStateDB("tsrootrb", 100)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/rb/1": []byte("1"), "/rb/2": []byte("2"), "/rb/3": []byte("3")})
+	root := ts.CalcStateRoot()
+	ts.Commit()
+
+	ts = sdb.NewCommittableTransaction()
+	ts.Set("/rb/2", nil)
+	ts.Set("/rb/4", []byte("4"))
+	c.Check(ts.CalcStateRoot(), Not(DeepEquals), root)
+	ts.Commit()
+
+	sdb.Rollback(1)
+	c.Check(sdb.StateRoot(), DeepEquals, root)
+
+	_, proof := sdb.GetProof("/rb/2")
+	c.Check(string(proof.Value), Equals, "2")
+	c.Check(proof.Verify(root), IsNil)
+}
+
+func testGetAtVersion(c *C) {
+	sdb := newTestStateDB("tversion", KeepAllSnapshots)
+	defer sdb.Close()
+
+	// 版本 i 时 /v/a 的值为 i，/v/b 只在版本 3 写入并在版本 5 删除
+	for i := 1; i <= 6; i++ {
+		ts := sdb.NewCommittableTransaction()
+		ts.Set("/v/a", []byte(strconv.Itoa(i)))
+		if i == 3 {
+			ts.Set("/v/b", []byte("b"))
+		}
+		if i == 5 {
+			ts.Set("/v/b", nil)
+		}
+		ts.Commit()
+	}
+	last := sdb.LastVersion()
+	first := last - 5
+
+	c.Check(sdb.OldestVersion() <= first-1, Equals, true)
+	for i := int64(1); i <= 6; i++ {
+		value, err := sdb.GetAtVersion("/v/a", first+i-1)
+		c.Check(err, IsNil)
+		c.Check(string(value), Equals, strconv.FormatInt(i, 10))
+
+		value, err = sdb.GetAtVersion("/v/b", first+i-1)
+		c.Check(err, IsNil)
+		if i >= 3 && i < 5 {
+			c.Check(string(value), Equals, "b")
+		} else {
+			c.Check(value, HasLen, 0)
+		}
+	}
+
+	_, err := sdb.GetAtVersion("/v/a", last+1)
+	c.Check(err, NotNil)
+
+	// 按历史版本读取的 rollback transaction，缓存中的修改优先
+	ts, err := sdb.NewRollbackTransactionAtVersion(first + 2)
+	c.Check(err, IsNil)
+	c.Check(string(ts.Get("/v/a")), Equals, "3")
+	c.Check(string(ts.Get("/v/b")), Equals, "b")
+	ts.Set("/v/a", []byte("x"))
+	c.Check(string(ts.Get("/v/a")), Equals, "x")
+	ts.Rollback()
+	_, err = sdb.NewRollbackTransactionAtVersion(last + 1)
+	c.Check(err, NotNil)
+
+	// 版本之后修改过的键
+	keys, err := sdb.ChangedKeys(first+3, last)
+	c.Check(err, IsNil)
+	c.Check(keys, DeepEquals, []string{"/v/a", "/v/b"})
+	keys, err = sdb.ChangedKeys(first+4, last)
+	c.Check(err, IsNil)
+	c.Check(keys, DeepEquals, []string{"/v/a"})
+}
+
+func testGetAtVersionPruned(c *C) {
+	sdb := newTestStateDB("tversionpruned", 3)
+	defer sdb.Close()
+
+	for i := 1; i <= 10; i++ {
+		ts := sdb.NewCommittableTransaction()
+		ts.Set("/v/a", []byte(strconv.Itoa(i)))
+		ts.Commit()
+	}
+
+	c.Check(sdb.OldestVersion(), Equals, int64(7))
+
+	value, err := sdb.GetAtVersion("/v/a", 7)
+	c.Check(err, IsNil)
+	c.Check(string(value), Equals, "7")
+
+	_, err = sdb.GetAtVersion("/v/a", 6)
+	c.Check(err, Equals, ErrVersionPruned)
+
+	_, err = sdb.ChangedKeys(6, 10)
+	c.Check(err, Equals, ErrVersionPruned)
+
+	// 读取过程中版本被清理，记录错误而不是 panic
+	tv, err := sdb.NewRollbackTransactionAtVersion(8)
+	c.Assert(err, IsNil)
+	c.Check(string(tv.Get("/v/a")), Equals, "8")
+	for i := 11; i <= 12; i++ {
+		ts := sdb.NewCommittableTransaction()
+		ts.Set("/v/a", []byte(strconv.Itoa(i)))
+		ts.Commit()
+	}
+	c.Check(tv.Get("/v/a"), IsNil)
+	c.Check(tv.Err(), Equals, ErrVersionPruned)
+}
+
+func testGetAtVersionRollback(c *C) {
+	name := "tversionrb" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+
+	for i := 1; i <= 5; i++ {
+		ts := sdb.NewCommittableTransaction()
+		ts.Set("/v/a", []byte(strconv.Itoa(i)))
+		ts.Commit()
+	}
+	sdb.Rollback(2)
+
+	// 回滚后重新打开数据库，与节点回滚的流程一致
+	sdb.Close()
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	ts.Set("/v/c", []byte("c"))
+	ts.Commit()
+
+	// 版本 3 之后 /v/a 未再修改，回滚前的索引不应再生效
+	value, err := sdb.GetAtVersion("/v/a", 3)
+	c.Check(err, IsNil)
+	c.Check(string(value), Equals, "3")
+
+	value, err = sdb.GetAtVersion("/v/a", 2)
+	c.Check(err, IsNil)
+	c.Check(string(value), Equals, "2")
+}
+
+func testVersionOfHeight(c *C) {
+	name := "tversionheight" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	sdb := NewWithBackend(MemDBBackend, name, 4)
+	sdb.SetHeightFunc(appStateHeight)
+
+	// 同一高度的多笔提交，索引指向最后一笔
+	commitHeight(sdb, 1, nil)
+	commitHeight(sdb, 2, nil)
+	ts := sdb.NewCommittableTransaction()
+	ts.Set("/v/a", []byte("a"))
+	ts.Commit()
+	commitHeight(sdb, 3, nil)
+
+	for height, want := range map[int64]int64{1: 1, 2: 3, 3: 4} {
+		id, ok := sdb.VersionOfHeight(height)
+		c.Check(ok, Equals, true)
+		c.Check(id, Equals, want)
+	}
+
+	// 回滚后高度指回保留的交易，回滚掉的高度不再有索引
+	sdb.Rollback(2)
+	sdb.Close()
+	sdb = NewWithBackend(MemDBBackend, name, 4)
+	defer sdb.Close()
+	sdb.SetHeightFunc(appStateHeight)
+
+	id, ok := sdb.VersionOfHeight(2)
+	c.Check(ok, Equals, true)
+	c.Check(id, Equals, int64(2))
+	_, ok = sdb.VersionOfHeight(3)
+	c.Check(ok, Equals, false)
+
+	// 快照被清理的高度不再有索引
+	for height := 3; height <= 6; height++ {
+		commitHeight(sdb, height, nil)
+	}
+	_, ok = sdb.VersionOfHeight(1)
+	c.Check(ok, Equals, false)
+	id, ok = sdb.VersionOfHeight(6)
+	c.Check(ok, Equals, true)
+	c.Check(id, Equals, int64(6))
+}
+
+func testBackendSameResult(c *C) {
+	// 磁盘数据库放在测试结束后自动删除的临时目录中
+	dir := c.MkDir()
+
+	roots := make([][]byte, 0)
+	for _, backend := range []string{GoLevelDBBackend, MemDBBackend} {
+		sdb := NewWithBackend(backend, filepath.Join(dir, "tbackend"+backend), 10)
+
+		for i := 0; i < 5; i++ {
+			temp := strconv.Itoa(i)
+			ts := sdb.NewCommittableTransaction()
+			tx := ts.NewTx()
+			tx.Set("/b/"+temp, []byte("value"+temp))
+			tx.Set("/b/0", []byte("value0"+temp))
+			tx.Commit()
+			ts.CalcStateRoot()
+			ts.Commit()
+		}
+		sdb.Rollback(1)
+
+		c.Check(string(sdb.Get("/b/0")), Equals, "value03", Commentf("backend %s", backend))
+		c.Check(sdb.Get("/b/4"), HasLen, 0, Commentf("backend %s", backend))
+		c.Check(iterKeys(sdb.NewIterator(IterOptions{Prefix: "/b/", Reverse: true})), DeepEquals,
+			[]string{"/b/3", "/b/2", "/b/1", "/b/0"}, Commentf("backend %s", backend))
+
+		roots = append(roots, sdb.StateRoot())
+		sdb.Close()
+	}
+
+	c.Check(roots[0], DeepEquals, roots[1])
+}
+
+func testMemDBReopen(c *C) {
+	name := "tmemdb" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+	ts := sdb.NewCommittableTransaction()
+	ts.Set("/m/1", []byte("1"))
+	ts.Commit()
+
+	// 已打开的数据库不能重复打开
+	func() {
+		defer func() {
+			c.Check(recover(), NotNil)
+		}()
+		NewWithBackend(MemDBBackend, name, 10)
+	}()
+	sdb.Close()
+
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	defer sdb.Close()
+	c.Check(string(sdb.Get("/m/1")), Equals, "1")
+	c.Check(sdb.lastCommittableTransactionID, Equals, int64(1))
+}
+
+func testMemDBSnapshot(c *C) {
+	m, err := openMemDB("tmemdbsnap" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	c.Assert(err, IsNil)
+	defer m.Close()
+	c.Check(m.Set([]byte("a"), []byte("1")), IsNil)
+
+	snap, err := m.Snapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	// 快照未释放时写入不被阻塞
+	done := make(chan struct{})
+	go func() {
+		m.Set([]byte("a"), []byte("2"))
+		m.Set([]byte("b"), []byte("2"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		c.Fatal("writing is blocked by snapshot")
+	}
+
+	value, err := snap.Get([]byte("a"))
+	c.Check(err, IsNil)
+	c.Check(string(value), Equals, "1")
+	value, err = snap.Get([]byte("b"))
+	c.Check(err, IsNil)
+	c.Check(value, IsNil)
+}
+
+// 模拟提交时只写入快照库后崩溃
+func commitSnapshotOnly(sdb *StateDB, data map[string][]byte) {
+	ts := sdb.NewCommittableTransaction()
+	originData := make(map[string][]byte)
+	for k := range data {
+		originData[k] = sdb.Get(k)
+	}
+	sdb.snapshot.commit(ts.ID(), 0, originData, data)
+	sdb.committableTransaction = nil
+}
+
+func testRecoverCommit(c *C) {
+	name := "trecovercommit" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/r/1": []byte("1"), "/r/2": []byte("2")})
+	ts.Commit()
+
+	commitSnapshotOnly(sdb, map[string][]byte{"/r/1": []byte("11"), "/r/2": nil, "/r/3": []byte("3")})
+	c.Check(sdb.LastVersion(), Equals, int64(1))
+	sdb.Close()
+
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	defer sdb.Close()
+
+	c.Check(sdb.LastVersion(), Equals, int64(2))
+	c.Check(string(sdb.Get("/r/1")), Equals, "11")
+	c.Check(sdb.Get("/r/2"), HasLen, 0)
+	c.Check(string(sdb.Get("/r/3")), Equals, "3")
+
+	// 恢复后可以继续提交和回滚
+	ts = sdb.NewCommittableTransaction()
+	c.Check(ts.ID(), Equals, int64(3))
+	ts.Set("/r/4", []byte("4"))
+	ts.Commit()
+	sdb.Rollback(2)
+	c.Check(string(sdb.Get("/r/1")), Equals, "1")
+	c.Check(string(sdb.Get("/r/2")), Equals, "2")
+}
+
+func testRecoverCommitNoSnapshot(c *C) {
+	name := "trecovernosn" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	sdb := NewWithBackend(MemDBBackend, name, 0)
+
+	ts := sdb.NewCommittableTransaction()
+	ts.Set("/r/1", []byte("1"))
+	ts.Commit()
+
+	commitSnapshotOnly(sdb, map[string][]byte{"/r/1": []byte("11")})
+	sdb.Close()
+
+	sdb = NewWithBackend(MemDBBackend, name, 0)
+	defer sdb.Close()
+
+	c.Check(sdb.LastVersion(), Equals, int64(1))
+	c.Check(getInt64(sdb.snapshot.snapshotDB, keyOfLastTransactionID()), Equals, int64(1))
+	c.Check(string(sdb.Get("/r/1")), Equals, "1")
+}
+
+func testRecoverRollback(c *C) {
+	name := "trecoverrb" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+
+	for i := 1; i <= 5; i++ {
+		ts := sdb.NewCommittableTransaction()
+		ts.Set("/r/a", []byte(strconv.Itoa(i)))
+		ts.Commit()
+	}
+
+	// 回滚 3 个交易，只完成了状态库中最后一个交易的回滚
+	sdb.snapshot.setIntent(&intent{Op: intentRollback, TransactionID: 3})
+	sdb.snapshot.rollbackStateDB(5)
+	sdb.Close()
+
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	defer sdb.Close()
+
+	c.Check(sdb.LastVersion(), Equals, int64(2))
+	c.Check(getInt64(sdb.snapshot.snapshotDB, keyOfLastTransactionID()), Equals, int64(2))
+	c.Check(string(sdb.Get("/r/a")), Equals, "2")
+	c.Check(sdb.snapshot.getIntent(), IsNil)
+}
+
+func testDiffDB(c *C) {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	from := NewWithBackend(MemDBBackend, "tdifffrom"+suffix, 10)
+	defer from.Close()
+	to := NewWithBackend(MemDBBackend, "tdiffto"+suffix, 10)
+	defer to.Close()
+
+	ts := from.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/d/1": []byte("1"), "/d/2": []byte("2"), "/d/3": []byte("3"), "/e/1": []byte("1")})
+	ts.Commit()
+
+	ts = to.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/d/2": []byte("22"), "/d/3": []byte("3"), "/d/4": []byte("4")})
+	ts.Commit()
+
+	c.Check(DiffDB(from, to, "/d/"), DeepEquals, []KeyDiff{
+		{Key: "/d/1", Type: DiffRemoved, Old: []byte("1")},
+		{Key: "/d/2", Type: DiffChanged, Old: []byte("2"), New: []byte("22")},
+		{Key: "/d/4", Type: DiffAdded, New: []byte("4")},
+	})
+	c.Check(DiffDB(from, from, "/"), HasLen, 0)
+}
+
+func testDiffVersions(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "tdiffversions"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/d/1": []byte("1"), "/d/2": []byte("2")})
+	ts.Commit()
+
+	ts = sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/d/1": nil, "/d/2": []byte("22"), "/d/3": []byte("3")})
+	ts.Commit()
+
+	// 先增加后删除的键不算差异
+	ts = sdb.NewCommittableTransaction()
+	ts.BatchSet(map[string][]byte{"/d/4": []byte("4"), "/x/1": []byte("1")})
+	ts.Commit()
+	ts = sdb.NewCommittableTransaction()
+	ts.Set("/d/4", nil)
+	ts.Commit()
+
+	diffs, err := sdb.DiffVersions(1, 4, "/d/")
+	c.Check(err, IsNil)
+	c.Check(diffs, DeepEquals, []KeyDiff{
+		{Key: "/d/1", Type: DiffRemoved, Old: []byte("1")},
+		{Key: "/d/2", Type: DiffChanged, Old: []byte("2"), New: []byte("22")},
+		{Key: "/d/3", Type: DiffAdded, New: []byte("3")},
+	})
+
+	diffs, err = sdb.DiffVersions(4, 1, "/d/3")
+	c.Check(err, IsNil)
+	c.Check(diffs, DeepEquals, []KeyDiff{{Key: "/d/3", Type: DiffRemoved, Old: []byte("3")}})
+
+	_, err = sdb.DiffVersions(1, 5, "/")
+	c.Check(err, NotNil)
+}
+
+func testOpenReadOnly(c *C) {
+	name := "treadonly" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	_, err := OpenReadOnly(name)
+	c.Check(err, NotNil)
+
+	sdb := New(name, 10)
+	ts := sdb.NewCommittableTransaction()
+	ts.Set("/r/1", []byte("1"))
+	ts.Commit()
+	ts = sdb.NewCommittableTransaction()
+	ts.Set("/r/1", []byte("2"))
+	ts.Commit()
+	sdb.Close()
+
+	sdb, err = OpenReadOnly(name)
+	c.Check(err, IsNil)
+	defer sdb.Close()
+
+	c.Check(string(sdb.Get("/r/1")), Equals, "2")
+	value, err := sdb.GetAtVersion("/r/1", 1)
+	c.Check(err, IsNil)
+	c.Check(string(value), Equals, "1")
+}
+
+func appStateHeight(get func(key string) []byte) int64 {
+	height, _ := strconv.ParseInt(string(get("/h")), 10, 64)
+	return height
+}
+
+func commitHeight(sdb *StateDB, height int, data map[string][]byte) {
+	ts := sdb.NewCommittableTransaction()
+	ts.BatchSet(data)
+	ts.Set("/h", []byte(strconv.Itoa(height)))
+	ts.Set("$internal", []byte(strconv.Itoa(height)))
+	ts.Commit()
+}
+
+func testSubscribe(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "tsubscribe"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+	sdb.SetHeightFunc(appStateHeight)
+
+	ch, err := sdb.Subscribe("s", 10)
+	c.Check(err, IsNil)
+	_, err = sdb.Subscribe("s", 10)
+	c.Check(err, NotNil)
+
+	commitHeight(sdb, 1, map[string][]byte{"/c/1": []byte("1")})
+	commitHeight(sdb, 2, map[string][]byte{"/c/1": []byte("11"), "/c/2": []byte("2")})
+	sdb.Rollback(1)
+
+	cs := <-ch
+	c.Check(cs.TransactionID, Equals, int64(1))
+	c.Check(cs.Height, Equals, int64(1))
+	c.Check(cs.Changes, DeepEquals, []Change{
+		{Key: "/c/1", New: []byte("1")},
+		{Key: "/h", New: []byte("1")},
+	})
+
+	cs = <-ch
+	c.Check(cs.TransactionID, Equals, int64(2))
+	c.Check(cs.Height, Equals, int64(2))
+	c.Check(cs.Changes, DeepEquals, []Change{
+		{Key: "/c/1", Old: []byte("1"), New: []byte("11")},
+		{Key: "/c/2", New: []byte("2")},
+		{Key: "/h", Old: []byte("1"), New: []byte("2")},
+	})
+
+	cs = <-ch
+	c.Check(cs.Rollback, Equals, true)
+	c.Check(cs.TransactionID, Equals, int64(1))
+	c.Check(cs.Height, Equals, int64(1))
+	c.Check(cs.Changes, DeepEquals, []Change{
+		{Key: "/c/1", Old: []byte("11"), New: []byte("1")},
+		{Key: "/c/2", Old: []byte("2")},
+		{Key: "/h", Old: []byte("2"), New: []byte("1")},
+	})
+
+	sdb.Unsubscribe("s")
+	_, ok := <-ch
+	c.Check(ok, Equals, false)
+}
+
+func testSubscribeSlow(c *C) {
+	sdb := NewWithBackend(MemDBBackend, "tsubscribeslow"+strconv.FormatInt(time.Now().UnixNano(), 10), 10)
+	defer sdb.Close()
+
+	ch, err := sdb.Subscribe("slow", 1)
+	c.Check(err, IsNil)
+
+	commitHeight(sdb, 1, nil)
+	commitHeight(sdb, 2, nil)
+
+	cs, ok := <-ch
+	c.Check(ok, Equals, true)
+	c.Check(cs.TransactionID, Equals, int64(1))
+	_, ok = <-ch
+	c.Check(ok, Equals, false)
+
+	// 被取消后可以重新订阅
+	_, err = sdb.Subscribe("slow", 1)
+	c.Check(err, IsNil)
+}
+
+func testOutbox(c *C) {
+	name := "toutbox" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	path := filepath.Join(os.TempDir(), name+".changes")
+	defer os.Remove(path)
+
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+	sdb.SetHeightFunc(appStateHeight)
+	commitHeight(sdb, 1, map[string][]byte{"/o/1": []byte("1")})
+
+	// 新的输出文件从当前状态开始
+	outbox, err := OpenOutbox(path, 0)
+	c.Check(err, IsNil)
+	c.Check(sdb.SetOutbox(outbox), IsNil)
+	commitHeight(sdb, 2, map[string][]byte{"/o/2": []byte("2")})
+	commitHeight(sdb, 3, map[string][]byte{"/o/3": []byte("3")})
+	sdb.Close()
+	c.Check(outbox.Close(), IsNil)
+
+	changeSets, cursor, err := ReadChangeSets(path, 0, 1)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 1)
+	c.Check(changeSets[0].TransactionID, Equals, int64(2))
+	c.Check(changeSets[0].Height, Equals, int64(2))
+
+	// 未接入输出文件时提交和回滚，重新接入后补齐
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	sdb.SetHeightFunc(appStateHeight)
+	commitHeight(sdb, 4, map[string][]byte{"/o/4": []byte("4")})
+	outbox, err = OpenOutbox(path, 0)
+	c.Check(err, IsNil)
+	c.Check(sdb.SetOutbox(outbox), IsNil)
+	sdb.Close()
+	c.Check(outbox.Close(), IsNil)
+
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	sdb.SetHeightFunc(appStateHeight)
+	sdb.Rollback(2)
+	outbox, err = OpenOutbox(path, 0)
+	c.Check(err, IsNil)
+	c.Check(sdb.SetOutbox(outbox), IsNil)
+	sdb.Close()
+	c.Check(outbox.Close(), IsNil)
+
+	changeSets, cursor, err = ReadChangeSets(path, cursor, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 3)
+	c.Check(changeSets[0].TransactionID, Equals, int64(3))
+	c.Check(changeSets[1].TransactionID, Equals, int64(4))
+	c.Check(changeSets[1].Height, Equals, int64(4))
+	c.Check(changeSets[1].Changes[1], DeepEquals, Change{Key: "/o/4", New: []byte("4")})
+	c.Check(changeSets[2].Rollback, Equals, true)
+	c.Check(changeSets[2].TransactionID, Equals, int64(2))
+	c.Check(changeSets[2].Height, Equals, int64(2))
+	c.Check(changeSets[2].Changes, DeepEquals, []Change{
+		{Key: "/h", New: []byte("2")},
+		{Key: "/o/3"},
+		{Key: "/o/4"},
+	})
+
+	changeSets, _, err = ReadChangeSets(path, cursor, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 0)
+}
+
+func testOutboxTruncate(c *C) {
+	path := filepath.Join(os.TempDir(), "toutboxtruncate"+strconv.FormatInt(time.Now().UnixNano(), 10)+".changes")
+	defer os.Remove(path)
+
+	outbox, err := OpenOutbox(path, 0)
+	c.Check(err, IsNil)
+	_, ok := outbox.LastID()
+	c.Check(ok, Equals, false)
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 1}), IsNil)
+	c.Check(outbox.Close(), IsNil)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	c.Check(err, IsNil)
+	_, err = file.WriteString(`{"transactionID":2,"chan`)
+	c.Check(err, IsNil)
+	file.Close()
+
+	// 正在写入的行不被读取
+	changeSets, _, err := ReadChangeSets(path, 0, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 1)
+
+	outbox, err = OpenOutbox(path, 0)
+	c.Check(err, IsNil)
+	id, ok := outbox.LastID()
+	c.Check(ok, Equals, true)
+	c.Check(id, Equals, int64(1))
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 2}), IsNil)
+	c.Check(outbox.Close(), IsNil)
+
+	changeSets, _, err = ReadChangeSets(path, 0, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 2)
+	c.Check(changeSets[1].TransactionID, Equals, int64(2))
+}
+
+func testOutboxRetain(c *C) {
+	path := filepath.Join(os.TempDir(), "toutboxretain"+strconv.FormatInt(time.Now().UnixNano(), 10)+".changes")
+	defer os.Remove(path)
+
+	outbox, err := OpenOutbox(path, 2)
+	c.Assert(err, IsNil)
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 1}), IsNil)
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 2}), IsNil)
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 3}), IsNil)
+	_, cursor, err := ReadChangeSets(path, 0, 2)
+	c.Check(err, IsNil)
+
+	// 第 4 个变化集合写入后删除前 2 个
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 4}), IsNil)
+	_, first, err := ReadChangeSets(path, 0, 10)
+	c.Check(err, Equals, ErrCursorTruncated)
+	c.Check(first, Equals, cursor)
+
+	changeSets, next, err := ReadChangeSets(path, cursor, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 2)
+	c.Check(changeSets[0].TransactionID, Equals, int64(3))
+	c.Check(outbox.Close(), IsNil)
+
+	// 重新打开后继续写入，游标仍然有效
+	outbox, err = OpenOutbox(path, 2)
+	c.Assert(err, IsNil)
+	id, _ := outbox.LastID()
+	c.Check(id, Equals, int64(4))
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 5}), IsNil)
+	c.Check(outbox.Close(), IsNil)
+
+	changeSets, _, err = ReadChangeSets(path, next, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 1)
+	c.Check(changeSets[0].TransactionID, Equals, int64(5))
+}
+
+func testOutboxBroken(c *C) {
+	name := "toutboxbroken" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	path := filepath.Join(os.TempDir(), name+".changes")
+	defer os.Remove(path)
+
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+	sdb.SetHeightFunc(appStateHeight)
+	outbox, err := OpenOutbox(path, 0)
+	c.Assert(err, IsNil)
+	c.Check(sdb.SetOutbox(outbox), IsNil)
+	commitHeight(sdb, 1, map[string][]byte{"/o/1": []byte("1")})
+
+	// 文件写入失败时提交不受影响
+	outbox.file.Close()
+	commitHeight(sdb, 2, map[string][]byte{"/o/2": []byte("2")})
+	commitHeight(sdb, 3, map[string][]byte{"/o/3": []byte("3")})
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 4}), NotNil)
+	sdb.Close()
+
+	sdb = NewWithBackend(MemDBBackend, name, 10)
+	defer sdb.Close()
+	sdb.SetHeightFunc(appStateHeight)
+	outbox, err = OpenOutbox(path, 0)
+	c.Assert(err, IsNil)
+	c.Check(sdb.SetOutbox(outbox), IsNil)
+	c.Check(outbox.Close(), IsNil)
+
+	changeSets, _, err := ReadChangeSets(path, 0, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 3)
+	c.Check(changeSets[2].TransactionID, Equals, int64(3))
+}
+
+func testOutboxRestore(c *C) {
+	path := filepath.Join(os.TempDir(), "toutboxrestore"+strconv.FormatInt(time.Now().UnixNano(), 10)+".changes")
+	defer os.Remove(path)
+
+	outbox, err := OpenOutbox(path, 0)
+	c.Assert(err, IsNil)
+	for id := int64(3); id <= 5; id++ {
+		c.Check(outbox.Append(&ChangeSet{TransactionID: id}), IsNil)
+	}
+
+	// 备份之后的变化集合都在 outbox 中时保留
+	c.Check(outbox.Restore(2), IsNil)
+	c.Check(outbox.Restore(4), IsNil)
+	id, ok := outbox.LastID()
+	c.Check(ok, Equals, true)
+	c.Check(id, Equals, int64(5))
+	_, end, err := ReadChangeSets(path, 0, 10)
+	c.Check(err, IsNil)
+
+	// 缺少备份之后的变化集合时清空，消费者从截断的游标重新同步
+	c.Check(outbox.Restore(1), IsNil)
+	_, ok = outbox.LastID()
+	c.Check(ok, Equals, false)
+	c.Check(outbox.Append(&ChangeSet{TransactionID: 1}), IsNil)
+	c.Check(outbox.Close(), IsNil)
+
+	_, first, err := ReadChangeSets(path, 0, 10)
+	c.Check(err, Equals, ErrCursorTruncated)
+	c.Check(first, Equals, end)
+	changeSets, _, err := ReadChangeSets(path, end, 10)
+	c.Check(err, IsNil)
+	c.Check(changeSets, HasLen, 1)
+	c.Check(changeSets[0].TransactionID, Equals, int64(1))
+}
+
+func testBackupWhileCommitting(c *C) {
+	name := "tbackup" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	dir := filepath.Join(os.TempDir(), name)
+	defer os.RemoveAll(dir)
+
+	sdb := NewWithBackend(MemDBBackend, name, 10)
+	defer sdb.Close()
+
+	for i := 1; i <= 3; i++ {
+		commitHeight(sdb, i, map[string][]byte{"/bk/a": []byte(strconv.Itoa(i))})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 4; i <= 50; i++ {
+			commitHeight(sdb, i, map[string][]byte{"/bk/a": []byte(strconv.Itoa(i)), "/bk/b": []byte(strconv.Itoa(i))})
+		}
+	}()
+
+	id, err := sdb.Backup(dir, name)
+	<-done
+	c.Check(err, IsNil)
+
+	backup, err := OpenReadOnly(filepath.Join(dir, name))
+	c.Check(err, IsNil)
+	defer backup.Close()
+
+	// 备份中的数据与最后提交的交易一致
+	c.Check(backup.LastVersion(), Equals, id)
+	c.Check(string(backup.Get("/h")), Equals, strconv.FormatInt(id, 10))
+	c.Check(string(backup.Get("/bk/a")), Equals, strconv.FormatInt(id, 10))
+	value, err := backup.GetAtVersion("/bk/a", id-1)
+	c.Check(err, IsNil)
+	c.Check(string(value), Equals, strconv.FormatInt(id-1, 10))
+
+	// 不覆盖已有的备份
+	_, err = sdb.Backup(dir, name)
+	c.Check(err, NotNil)
+}
+
+func iterKeys(it Iterator) []string {
+	defer it.Close()
+
+	keys := make([]string, 0)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
 func TestA(t *testing.T) {
 	var a map[string]string
 	_, ok := a["a"]
@@ -8,14 +8,17 @@ import (
 	"sync"
 )
 
-var muts sync.Mutex
-
 type Transaction struct {
 	transactionID int64
 	stateDB       *StateDB
+	mtx           sync.RWMutex // guards buffer and lastTxID, taken after the lock of tx
 	buffer        map[string][]byte
 	committable   bool
 	lastTxID      int64
+	version       int64 // state db is read at this version if it's not 0
+
+	errMtx sync.Mutex
+	err    error // the first error of reading state db at version, keys read after it are nil
 }
 
 func (t *Transaction) ID() int64 {
@@ -26,23 +29,48 @@ func (t *Transaction) NewTx() *Tx {
 	return &Tx{
 		txID:        t.calcTxID(),
 		buffer:      make(map[string][]byte),
+		readSet:     make(map[string]struct{}),
+		writeSet:    make(map[string]struct{}),
+		detached:    make(map[string]struct{}),
 		transaction: t,
 	}
 }
 
 func (t *Transaction) calcTxID() int64 {
-	muts.Lock()
-	defer muts.Unlock()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
 
 	t.lastTxID++
 	return t.lastTxID
 }
 
 func (t *Transaction) Get(key string) []byte {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return t.get(key)
+}
+
+// get reads buffer and state db, the caller holds lock.
+func (t *Transaction) get(key string) []byte {
 	if value, ok := t.buffer[key]; ok {
 		return value
 	}
 
+	if t.version != 0 {
+		value, err := t.stateDB.GetAtVersion(key, t.version)
+		if err != nil {
+			// version may be pruned while transaction is reading it
+			t.errMtx.Lock()
+			if t.err == nil {
+				t.err = err
+			}
+			t.errMtx.Unlock()
+			return nil
+		}
+		return value
+	}
+
 	value, err := t.stateDB.sdb.Get([]byte(key))
 	if err != nil {
 		panic(err)
@@ -50,11 +78,25 @@ func (t *Transaction) Get(key string) []byte {
 	return value
 }
 
+// Err returns error of reading state db at version, values read by transaction are wrong if it's not nil.
+func (t *Transaction) Err() error {
+	t.errMtx.Lock()
+	defer t.errMtx.Unlock()
+
+	return t.err
+}
+
 func (t *Transaction) Set(key string, value []byte) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	t.buffer[key] = value
 }
 
 func (t *Transaction) BatchSet(data map[string][]byte) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	for k, v := range data {
 		t.buffer[k] = v
 	}
@@ -65,6 +107,11 @@ func (t *Transaction) Commit() {
 		panic("can not commit rollback transaction")
 	}
 
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.stateDB.commitMtx.Lock()
+	defer t.stateDB.commitMtx.Unlock()
+
 	// check current transaction ID
 	t.checkID()
 
@@ -89,7 +136,7 @@ func (t *Transaction) Commit() {
 	}
 
 	// snapshot
-	t.stateDB.snapshot.commit(t.transactionID, originData, t.buffer)
+	t.stateDB.snapshot.commit(t.transactionID, t.stateDB.heightOfCommit(t.buffer), originData, t.buffer)
 
 	// set last transaction ID
 	value, err := jsoniter.Marshal(t.transactionID)
@@ -105,13 +152,21 @@ func (t *Transaction) Commit() {
 	}
 
 	t.stateDB.committableTransaction = nil
+
+	t.stateDB.publish(&ChangeSet{TransactionID: t.transactionID, Changes: changesOf(originData, t.buffer)})
 }
 
 func (t *Transaction) Rollback() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	t.buffer = make(map[string][]byte)
 }
 
 func (t *Transaction) GetBuffer() []byte {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
 	var keys []string
 
 	for k := range t.buffer {
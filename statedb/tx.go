@@ -3,40 +3,76 @@ package statedb
 import (
 	"bytes"
 	"sort"
+	"sync"
 )
 
+// Tx buffers data of a tx in transaction, it's safe for concurrent use.
+// It records keys read outside its own buffer, key ranges iterated and keys written,
+// the sets can be compared between txs to find conflicts.
 type Tx struct {
 	txID        int64
+	mtx         sync.RWMutex
 	buffer      map[string][]byte
+	readSet     map[string]struct{}
+	readRanges  []keyRange
+	writeSet    map[string]struct{}
+	detached    map[string]struct{} // keys committed to transaction apart from tx, they survive rollback
 	transaction *Transaction
 }
 
+// keyRange is [start, end) of keys, an empty end means unbounded.
+type keyRange struct {
+	start, end string
+}
+
 func (t *Tx) ID() int64 {
 	return t.txID
 }
 
+// Get returns value in tx buffer only, a key which isn't in buffer is recorded
+// as read because the caller reads it from transaction next.
 func (t *Tx) Get(key string) []byte {
-	return t.buffer[key]
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	value, ok := t.buffer[key]
+	if !ok {
+		t.readSet[key] = struct{}{}
+	}
+	return value
 }
 
 func (t *Tx) Set(key string, value []byte) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	t.buffer[key] = value
+	t.writeSet[key] = struct{}{}
 }
 
 func (t *Tx) BatchSet(data map[string][]byte) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	for k, v := range data {
 		t.buffer[k] = v
+		t.writeSet[k] = struct{}{}
 	}
 }
 
 func (t *Tx) Commit() ([]byte, map[string][]byte) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	var keys []string
 
 	// commit to transaction
+	t.transaction.mtx.Lock()
 	for k, v := range t.buffer {
 		keys = append(keys, k)
 		t.transaction.buffer[k] = v
 	}
+	t.transaction.mtx.Unlock()
 
 	sort.Strings(keys)
 	var buf bytes.Buffer
@@ -52,6 +88,95 @@ func (t *Tx) Commit() ([]byte, map[string][]byte) {
 	return buf.Bytes(), bufMap
 }
 
+// Detach removes keys from buffer and returns their values, the keys stay in write set
+// even if tx is rolled back. It's used for data which is committed to transaction apart
+// from the other data of tx.
+func (t *Tx) Detach(keys []string) map[string][]byte {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	data := make(map[string][]byte)
+	for _, k := range keys {
+		if v, ok := t.buffer[k]; ok {
+			data[k] = v
+			delete(t.buffer, k)
+			t.detached[k] = struct{}{}
+		}
+	}
+	return data
+}
+
+// Rollback discards buffer and write set except detached keys, read set and read ranges
+// are kept because the reads have been done.
 func (t *Tx) Rollback() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	t.buffer = make(map[string][]byte)
+	t.writeSet = make(map[string]struct{})
+	for k := range t.detached {
+		t.writeSet[k] = struct{}{}
+	}
+}
+
+// ReadSet returns sorted keys read by tx, including keys visited by its iterators.
+func (t *Tx) ReadSet() []string {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return sortedKeys(t.readSet)
+}
+
+// WriteSet returns sorted keys written by tx, committed or not.
+func (t *Tx) WriteSet() []string {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return sortedKeys(t.writeSet)
+}
+
+// Conflicts reports whether tx read or wrote a key written by other, a key written
+// in range iterated by tx is a conflict too, even though the iterator didn't visit it.
+func (t *Tx) Conflicts(other *Tx) bool {
+	written := other.WriteSet()
+
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	for _, k := range written {
+		if _, ok := t.readSet[k]; ok {
+			return true
+		}
+		if _, ok := t.writeSet[k]; ok {
+			return true
+		}
+		for _, r := range t.readRanges {
+			if inRange(k, r.start, r.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *Tx) recordRead(key string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.readSet[key] = struct{}{}
+}
+
+// recordReadRange must be called with t.mtx locked.
+func (t *Tx) recordReadRange(opts IterOptions) {
+	start, end := opts.bounds()
+	t.readRanges = append(t.readRanges, keyRange{start: start, end: end})
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
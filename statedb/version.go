@@ -0,0 +1,183 @@
+package statedb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// KeepAllSnapshots is the max snapshot count of archive mode, it's large enough
+// that no snapshot is ever pruned.
+const KeepAllSnapshots = math.MaxInt32
+
+// ErrVersionPruned is returned when snapshots of the version have been pruned.
+var ErrVersionPruned = errors.New("version has been pruned")
+
+// A version is the ID of a committed transaction, the value of a key at version V is
+// the origin data of the first transaction after V that changed the key, or the current
+// value if none changed it. To find that transaction without loading every snapshot,
+// each snapshot also writes "$v$<key>\x00<transactionID>" => origin data.
+
+func keyOfVersionIndexPrefix(key string) string {
+	return "$v$" + key + "\x00"
+}
+
+func keyOfVersionIndex(key string, transactionID int64) string {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, uint64(transactionID))
+	return keyOfVersionIndexPrefix(key) + string(id)
+}
+
+// keyOfVersionIndexFrom is the first transaction ID which has version index.
+func keyOfVersionIndexFrom() string {
+	return "$version_index_from"
+}
+
+// The last transaction committed at each block height is indexed as "$h$<height>" => transactionID,
+// "$t$<transactionID>" => height is kept to delete it with the snapshot. The index is in snapshot
+// db like version index, keys in state db count in state root.
+
+func keyOfHeightIndex(height int64) string {
+	h := make([]byte, 8)
+	binary.BigEndian.PutUint64(h, uint64(height))
+	return "$h$" + string(h)
+}
+
+func keyOfTransactionHeight(transactionID int64) string {
+	return fmt.Sprintf("$t$%d", transactionID)
+}
+
+// LastVersion returns ID of the last committed transaction.
+func (s *StateDB) LastVersion() int64 {
+	return getInt64(s.sdb, keyOfLastTransactionID())
+}
+
+// OldestVersion returns the oldest version which can be read by GetAtVersion.
+func (s *StateDB) OldestVersion() int64 {
+	last := s.LastVersion()
+
+	from := getInt64(s.snapshot.snapshotDB, keyOfVersionIndexFrom())
+	if from == 0 || from > last {
+		return last
+	}
+	return from - 1
+}
+
+// GetAtVersion returns value of key right after transaction with ID transactionID was committed.
+func (s *StateDB) GetAtVersion(key string, transactionID int64) ([]byte, error) {
+	// Read current value before index, a commit in between writes index first,
+	// so its origin data is found in index.
+	value := s.Get(key)
+
+	last := s.LastVersion()
+	if transactionID > last {
+		return nil, fmt.Errorf("version %d is not committed, last version is %d", transactionID, last)
+	}
+	if transactionID == last {
+		return value, nil
+	}
+	if transactionID < s.OldestVersion() {
+		return nil, ErrVersionPruned
+	}
+
+	it := s.snapshot.snapshotDB.Iterator(
+		[]byte(keyOfVersionIndex(key, transactionID+1)),
+		[]byte(prefixEndKey(keyOfVersionIndexPrefix(key))),
+		false)
+	defer it.Close()
+
+	if it.Valid() {
+		return it.Value(), nil
+	}
+	return value, nil
+}
+
+// setVersionIndex adds version index of snapshot to batch.
+func (s *snapshot) setVersionIndex(transactionID int64, originData map[string][]byte, batch Batch) {
+	for k, v := range originData {
+		batch.Set([]byte(keyOfVersionIndex(k, transactionID)), nonNilBytes(v))
+	}
+
+	if getInt64(s.snapshotDB, keyOfVersionIndexFrom()) == 0 {
+		setToBatch(batch, keyOfVersionIndexFrom(), transactionID)
+	}
+}
+
+// deleteVersionIndex adds deletion of version index of snapshot to batch.
+func (s *snapshot) deleteVersionIndex(transactionID int64, batch Batch) {
+	for k := range s.getNewData(transactionID) {
+		batch.Delete([]byte(keyOfVersionIndex(k, transactionID)))
+	}
+}
+
+// VersionOfHeight returns ID of the last transaction committed at block height, it's false
+// if the height is not indexed or the transaction can not be read by GetAtVersion.
+func (s *StateDB) VersionOfHeight(height int64) (int64, bool) {
+	id := getInt64(s.snapshot.snapshotDB, keyOfHeightIndex(height))
+	if id == 0 || id < s.OldestVersion() || id > s.LastVersion() {
+		return 0, false
+	}
+	return id, true
+}
+
+// setHeightIndex adds height index of snapshot to batch, transactions committed later at the
+// same height replace it.
+func (s *snapshot) setHeightIndex(transactionID, height int64, batch Batch) {
+	if height <= 0 {
+		return
+	}
+
+	setToBatch(batch, keyOfHeightIndex(height), transactionID)
+	setToBatch(batch, keyOfTransactionHeight(transactionID), height)
+}
+
+// deleteHeightIndex adds deletion of height index of snapshot to batch, the height is indexed
+// to keepID instead if it's the last transaction kept and committed at the same height.
+func (s *snapshot) deleteHeightIndex(transactionID, keepID int64, batch Batch) {
+	height := getInt64(s.snapshotDB, keyOfTransactionHeight(transactionID))
+	if height == 0 {
+		return
+	}
+	batch.Delete([]byte(keyOfTransactionHeight(transactionID)))
+
+	// the height is indexed to a later transaction
+	if getInt64(s.snapshotDB, keyOfHeightIndex(height)) != transactionID {
+		return
+	}
+
+	if keepID > 0 && getInt64(s.snapshotDB, keyOfTransactionHeight(keepID)) == height {
+		setToBatch(batch, keyOfHeightIndex(height), keepID)
+	} else {
+		batch.Delete([]byte(keyOfHeightIndex(height)))
+	}
+}
+
+// ChangedKeys returns sorted keys changed by transactions after fromVersion up to toVersion,
+// the snapshots of those transactions must be retained.
+func (s *StateDB) ChangedKeys(fromVersion, toVersion int64) ([]string, error) {
+	if fromVersion < s.OldestVersion() {
+		return nil, ErrVersionPruned
+	}
+	if toVersion > s.LastVersion() {
+		return nil, fmt.Errorf("version %d is not committed", toVersion)
+	}
+
+	changed := make(map[string]struct{})
+	for id := fromVersion + 1; id <= toVersion; id++ {
+		if !s.snapshot.snapshotDB.Has([]byte(keyOfNewData(id))) {
+			return nil, ErrVersionPruned
+		}
+		for k := range s.snapshot.getNewData(id) {
+			changed[k] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0, len(changed))
+	for k := range changed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}